@@ -1,22 +1,164 @@
 package main
 
 import (
-    "net/http"
-    "github.com/G1D0/Api-Gateway/internal/proxy"
-    "github.com/G1D0/Api-Gateway/internal/lb"
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/admin"
+	"github.com/G1D0/Api-Gateway/internal/gateway"
+	"github.com/G1D0/Api-Gateway/internal/health"
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/middleware"
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/proxy"
+	"github.com/G1D0/Api-Gateway/internal/router"
+	"github.com/G1D0/Api-Gateway/internal/server"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Set at build time: go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	commit  = "unknown"
 )
 
 func main() {
-	backends := []string{"http://localhost:8080", "http://localhost:8081", "http://localhost:8082"}
-	balancer := lb.NewRoundRobin(backends)
-	p := proxy.NewProxy(balancer)
-    // 2. Start server: http.ListenAndServe(":9000", p)
-	log.Println("Proxy listening on :9000")
-    err := http.ListenAndServe(":9000", p)
-    if err != nil {
-    log.Fatal(err)
-    }
-	
+	addr := flag.String("addr", ":9000", "proxy listen address")
+	adminAddr := flag.String("admin-addr", "127.0.0.1:9090", "admin listen address for /metrics, /healthz, /readyz (empty disables)")
+	enablePprof := flag.Bool("pprof", false, "serve /debug/pprof/ on the admin listener")
+	h2c := flag.Bool("h2c", false, "accept cleartext HTTP/2 on the proxy listener")
+	drainExitCode := flag.Int("drain-timeout-exit-code", 1, "exit code when shutdown had to force-close requests that outlived the drain timeout")
+	preDrain := flag.Duration("pre-drain-delay", 0, "time to keep serving after SIGTERM with /readyz failing, before draining")
+	logFormat := flag.String("log-format", observe.FormatJSON, "log output format: json or text")
+	configPath := flag.String("config", "", "route config file (YAML or JSON), hot reloaded; empty proxies to the built-in local backends")
+	trustedHops := flag.Int("trusted-hops", 0, "proxies in front of the gateway that append to X-Forwarded-For; the client IP for logs and rate limits is the entry that many hops from the right (0 uses the peer address)")
+	syntheticURL := flag.String("synthetic-url", "", "canary URL requested through the proxy listener, e.g. http://127.0.0.1:9000/canary; results in metrics and /status/synthetic on the admin listener (empty disables)")
+	syntheticInterval := flag.Duration("synthetic-interval", health.DefaultSyntheticInterval, "how often to request -synthetic-url")
+	flag.Parse()
+
+	logger := observe.NewLoggerWithConfig(observe.LoggerConfig{
+		Format: *logFormat,
+		Level:  observe.LevelInfo,
+	})
+	metrics := observe.NewMetrics(prometheus.DefaultRegisterer)
+	observe.RegisterBuildInfo(prometheus.DefaultRegisterer, observe.BuildInfo{Version: version, Commit: commit})
+
+	// One client IP for logs and rate limits alike
+	clientIP := middleware.ClientIPResolver(*trustedHops)
+
+	mws := []middleware.Middleware{
+		middleware.InflightMetrics(metrics),
+		middleware.Tracing(),
+		middleware.ContextLoggerWithClientIP(logger, clientIP),
+		middleware.LoggingWithConfig(logger, middleware.LoggingConfig{ClientIP: clientIP}),
+	}
+
+	// Routes from the config file, or a single round robin pool without one.
+	// With routes, Routing matches before Metrics and RouteRateLimit so they
+	// see the route, and the gateway reuses that match
+	var p http.Handler
+	var routes func() *router.Router
+	if *configPath != "" {
+		hr, err := router.NewHotReloader(*configPath, 5*time.Second)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hr.OnReload(metrics.RecordReload)
+		hr.ReloadOnSignal(syscall.SIGHUP)
+		routes = hr.Router
+		gw := gateway.New(gateway.Config{Router: hr.Router})
+		hr.OnSwap(gw.Update)
+		p = gw
+		mws = append(mws,
+			middleware.Routing(middleware.RoutingConfig{Router: hr.Router, Metrics: metrics}),
+			middleware.Metrics(metrics, middleware.RouteService),
+			middleware.RouteRateLimitWithConfig(middleware.RouteRateLimitConfig{KeyFunc: clientIP, Metrics: metrics}),
+		)
+	} else {
+		backends := []string{"http://localhost:8080", "http://localhost:8081", "http://localhost:8082"}
+		p = proxy.NewProxy(lb.NewRoundRobin(backends))
+		mws = append(mws, middleware.Metrics(metrics, func(*http.Request) string { return "default" }))
+	}
+
+	handler := middleware.Chain(mws...)(p)
+
+	// The synthetic check goes through the proxy listener, so it covers
+	// routing, middleware, and proxying end to end
+	var synthetic []*health.SyntheticChecker
+	if *syntheticURL != "" {
+		synthetic = append(synthetic, health.NewSyntheticChecker(health.SyntheticConfig{
+			Name:     "canary",
+			Target:   *syntheticURL,
+			Interval: *syntheticInterval,
+			Timeout:  5 * time.Second,
+			OnResult: func(r health.SyntheticResult) {
+				metrics.RecordSynthetic(r.Name, r.OK, r.Latency)
+			},
+		}))
+	}
+
+	// Readiness goes false on SIGTERM, before the proxy listener drains
+	var ready atomic.Bool
+	ready.Store(true)
+
+	// Admin endpoints live on their own listener, never on the proxy port.
+	// It ignores signals and is shut down after the proxy server returns,
+	// so /readyz keeps answering 503 for the whole drain
+	stopAdmin := func() {}
+	if *adminAddr != "" {
+		adminSrv := server.New(server.Config{
+			Addr: *adminAddr,
+			Handler: admin.NewHandler(admin.Config{
+				Ready:       ready.Load,
+				Drain:       func() { ready.Store(false) },
+				EnablePprof: *enablePprof,
+				Router:      routes,
+				Synthetic:   synthetic,
+			}),
+			Logger: logger,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		adminErr := make(chan error, 1)
+		go func() {
+			err := adminSrv.ListenAndServeContext(ctx)
+			if ctx.Err() == nil {
+				log.Fatal(err) // failed to start, or stopped serving
+			}
+			adminErr <- err
+		}()
+		stopAdmin = func() {
+			cancel()
+			if err := <-adminErr; err != nil {
+				logger.Error("admin server shutdown", "error", err)
+			}
+		}
+	}
 
+	srv := server.New(server.Config{
+		Addr:          *addr,
+		Handler:       handler,
+		Logger:        logger,
+		OnShutdown:    func() { ready.Store(false) },
+		PreDrainDelay: *preDrain,
+		EnableH2C:     *h2c,
+	})
+	err := srv.ListenAndServe()
+	for _, sc := range synthetic {
+		sc.Close()
+	}
+	stopAdmin()
+	if err != nil {
+		if errors.Is(err, server.ErrDrainTimeout) {
+			log.Print(err)
+			os.Exit(*drainExitCode)
+		}
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,227 @@
+// Package admin serves the gateway's operational endpoints (metrics, health
+// probes) on a listener separate from proxied traffic, so internal data is
+// never exposed on the public port.
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/G1D0/Api-Gateway/internal/circuitbreaker"
+	"github.com/G1D0/Api-Gateway/internal/health"
+	"github.com/G1D0/Api-Gateway/internal/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Config configures the admin handler. The zero value is valid.
+type Config struct {
+	// Gatherer supplies /metrics. Nil means prometheus.DefaultGatherer,
+	// which pairs with observe.NewMetrics(prometheus.DefaultRegisterer).
+	Gatherer prometheus.Gatherer
+
+	// Ready backs /readyz. Nil means always ready.
+	Ready func() bool
+
+	// Drain backs POST /admin/drain, which operators call before SIGTERM
+	// to start draining: it should make Ready report false, so load
+	// balancers stop sending traffic. Nil disables the endpoint.
+	Drain func()
+
+	// EnablePprof registers the net/http/pprof handlers under /debug/pprof/.
+	// Off by default: profiles expose internals and cost CPU while running.
+	EnablePprof bool
+
+	// Router backs /config, a JSON dump of the live routing table. Pass
+	// HotReloader.Router to always show the post-reload router. Nil
+	// disables the endpoint.
+	Router func() *router.Router
+
+	// Health backs /health/backends, a JSON list of each backend's active
+	// status, passive error rate, and combined verdict. Nil disables the
+	// endpoint.
+	Health *health.CombinedChecker
+
+	// Circuits backs POST /admin/circuits/{force-open,force-close,reset}
+	// ?backend=<addr>, which pin a backend's circuit open or closed during
+	// an incident, or hand it back to automatic control. Nil disables them.
+	Circuits *circuitbreaker.PerBackend
+
+	// Synthetic backs /status/synthetic, the latest result of each
+	// synthetic check as JSON: 200 if all passed, 503 otherwise. Empty
+	// disables the endpoint.
+	Synthetic []*health.SyntheticChecker
+}
+
+// NewHandler returns a mux serving:
+//
+//	/metrics  Prometheus metrics
+//	/healthz  liveness: 200 while the process can serve HTTP
+//	/readyz   readiness: 200 when Ready() is true, 503 otherwise
+//	/admin/drain  POST: calls Drain() to fail readiness, only if Drain is set
+//	/config   active routing table as JSON, only if Router is set
+//	/health/backends  per-backend health as JSON, only if Health is set
+//	/admin/circuits/{action}  POST: force-open, force-close, or reset a
+//	          backend's circuit, only if Circuits is set
+//	/status/synthetic  synthetic check results as JSON, only if Synthetic
+//	          is set
+//	/debug/pprof/*  runtime profiles, only if EnablePprof is set
+//
+// Serve it with its own server.Server on an internal address.
+func NewHandler(cfg Config) http.Handler {
+	if cfg.Gatherer == nil {
+		cfg.Gatherer = prometheus.DefaultGatherer
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(cfg.Gatherer, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Ready != nil && !cfg.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ready"))
+	})
+
+	if cfg.Drain != nil {
+		mux.HandleFunc("POST /admin/drain", func(w http.ResponseWriter, r *http.Request) {
+			cfg.Drain()
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("draining"))
+		})
+	}
+
+	if cfg.Router != nil {
+		mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(dumpRoutes(cfg.Router()))
+		})
+	}
+
+	if cfg.Health != nil {
+		mux.HandleFunc("/health/backends", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(dumpHealth(cfg.Health))
+		})
+	}
+
+	if cfg.Circuits != nil {
+		actions := map[string]func(string){
+			"force-open":  cfg.Circuits.ForceOpen,
+			"force-close": cfg.Circuits.ForceClose,
+			"reset":       cfg.Circuits.Reset,
+		}
+		mux.HandleFunc("POST /admin/circuits/{action}", func(w http.ResponseWriter, r *http.Request) {
+			action, ok := actions[r.PathValue("action")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			backend := r.URL.Query().Get("backend")
+			if backend == "" {
+				http.Error(w, "backend is required", http.StatusBadRequest)
+				return
+			}
+			action(backend)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(circuitDump{
+				Backend: backend,
+				State:   cfg.Circuits.State(backend).String(),
+				Forced:  cfg.Circuits.Forced(backend),
+			})
+		})
+	}
+
+	if len(cfg.Synthetic) > 0 {
+		mux.Handle("/status/synthetic", health.SyntheticStatusHandler(cfg.Synthetic...))
+	}
+
+	if cfg.EnablePprof {
+		// Registered explicitly: importing net/http/pprof only adds them to
+		// http.DefaultServeMux, which the admin listener doesn't use.
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// routeDump is the JSON form of a router.Route served by /config.
+type routeDump struct {
+	Order     int               `json:"order"` // position in match order, from 0
+	Pattern   string            `json:"pattern"`
+	Path      string            `json:"path,omitempty"`
+	Regex     string            `json:"regex,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Backends  []string          `json:"backends"`
+	Weights   []int             `json:"weights,omitempty"` // parallel to Backends for weighted routes
+	Timeout   string            `json:"timeout,omitempty"`
+	Default   bool              `json:"default,omitempty"`
+	RateLimit bool              `json:"rate_limited,omitempty"`
+}
+
+// dumpRoutes converts the router's routes, in match order, for /config.
+func dumpRoutes(rt *router.Router) []routeDump {
+	routes := rt.Routes()
+	out := make([]routeDump, len(routes))
+	for i, route := range routes {
+		d := routeDump{
+			Order:     i,
+			Pattern:   route.Pattern(),
+			Path:      route.Path,
+			Headers:   route.Headers,
+			Backends:  route.Backends,
+			Default:   route.Default,
+			RateLimit: route.RateLimit != nil,
+		}
+		if route.Regex != nil {
+			d.Regex = route.Regex.String()
+		}
+		for _, wb := range route.WeightedBackends {
+			d.Weights = append(d.Weights, wb.Weight)
+		}
+		if route.Timeout > 0 {
+			d.Timeout = route.Timeout.String()
+		}
+		out[i] = d
+	}
+	return out
+}
+
+// circuitDump is a backend's circuit after an /admin/circuits action.
+type circuitDump struct {
+	Backend string `json:"backend"`
+	State   string `json:"state"`
+	Forced  bool   `json:"forced"`
+}
+
+// backendHealth is one backend's entry in /health/backends.
+type backendHealth struct {
+	Backend          string  `json:"backend"`
+	ActiveStatus     string  `json:"active_status"`
+	PassiveStatus    string  `json:"passive_status"`
+	PassiveErrorRate float64 `json:"passive_error_rate"`
+	Healthy          bool    `json:"healthy"`
+}
+
+// dumpHealth reports every actively checked backend, sorted by address.
+func dumpHealth(c *health.CombinedChecker) []backendHealth {
+	backends := c.Backends()
+	out := make([]backendHealth, len(backends))
+	for i, b := range backends {
+		out[i] = backendHealth{
+			Backend:          b,
+			ActiveStatus:     c.ActiveStatus(b).String(),
+			PassiveStatus:    c.PassiveStatus(b).String(),
+			PassiveErrorRate: c.PassiveErrorRate(b),
+			Healthy:          c.IsHealthy(b),
+		}
+	}
+	return out
+}
@@ -0,0 +1,457 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/circuitbreaker"
+	"github.com/G1D0/Api-Gateway/internal/health"
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/proxy"
+	"github.com/G1D0/Api-Gateway/internal/router"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeBalancer always returns the same address.
+type fakeBalancer struct {
+	addr string
+}
+
+func (f *fakeBalancer) Next() string { return f.addr }
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// --- Listeners ---
+
+func TestMetricsOnlyOnAdminListener(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := observe.NewMetrics(reg)
+	m.RequestsTotal.WithLabelValues("api", "200", "GET").Inc()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer backend.Close()
+
+	public := httptest.NewServer(proxy.NewProxy(&fakeBalancer{addr: backend.URL}))
+	defer public.Close()
+	adminSrv := httptest.NewServer(NewHandler(Config{Gatherer: reg}))
+	defer adminSrv.Close()
+
+	code, body := get(t, adminSrv.URL+"/metrics")
+	if code != http.StatusOK || !strings.Contains(body, "gateway_requests_total") {
+		t.Fatalf("admin /metrics: expected 200 with gateway metrics, got %d", code)
+	}
+
+	// The public listener proxies everything; /metrics is just another backend path
+	code, body = get(t, public.URL+"/metrics")
+	if code != http.StatusNotFound || strings.Contains(body, "gateway_requests_total") {
+		t.Fatalf("public /metrics: expected backend 404 without metrics, got %d", code)
+	}
+}
+
+// --- Probes ---
+
+func TestHealthz(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry()}))
+	defer srv.Close()
+
+	if code, _ := get(t, srv.URL+"/healthz"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	var ready atomic.Bool
+	srv := httptest.NewServer(NewHandler(Config{
+		Gatherer: prometheus.NewRegistry(),
+		Ready:    ready.Load,
+	}))
+	defer srv.Close()
+
+	if code, _ := get(t, srv.URL+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("not ready: expected 503, got %d", code)
+	}
+	ready.Store(true)
+	if code, _ := get(t, srv.URL+"/readyz"); code != http.StatusOK {
+		t.Fatalf("ready: expected 200, got %d", code)
+	}
+}
+
+func TestDrainFailsReadiness(t *testing.T) {
+	var ready atomic.Bool
+	ready.Store(true)
+	srv := httptest.NewServer(NewHandler(Config{
+		Gatherer: prometheus.NewRegistry(),
+		Ready:    ready.Load,
+		Drain:    func() { ready.Store(false) },
+	}))
+	defer srv.Close()
+
+	if code, _ := get(t, srv.URL+"/readyz"); code != http.StatusOK {
+		t.Fatalf("before drain: expected 200, got %d", code)
+	}
+
+	// Only POST drains
+	if code, _ := get(t, srv.URL+"/admin/drain"); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /admin/drain: expected 405, got %d", code)
+	}
+	if code, _ := get(t, srv.URL+"/readyz"); code != http.StatusOK {
+		t.Fatalf("after GET: expected still ready, got %d", code)
+	}
+
+	resp, err := http.Post(srv.URL+"/admin/drain", "", nil)
+	if err != nil {
+		t.Fatalf("POST /admin/drain: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /admin/drain: expected 202, got %d", resp.StatusCode)
+	}
+	if code, _ := get(t, srv.URL+"/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("after drain: expected 503, got %d", code)
+	}
+}
+
+func TestDrainDisabledByDefault(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry()}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/admin/drain", "", nil)
+	if err != nil {
+		t.Fatalf("POST /admin/drain: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 without Drain, got %d", resp.StatusCode)
+	}
+}
+
+// --- Config Dump ---
+
+func TestConfigDumpShowsSortedRoutes(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "gateway.yaml")
+	err := os.WriteFile(cfgPath, []byte(`
+routes:
+  - default: true
+    backends: ["http://fallback:8080"]
+  - path: /api/*
+    backends: ["http://api:8080"]
+  - path: /users/{id}
+    timeout: 2s
+    backends: ["http://users:8080"]
+  - path: /api/reports
+    headers: {X-Version: v2}
+    weighted_backends:
+      - {addr: "http://r1:8080", weight: 3}
+      - {addr: "http://r2:8080", weight: 1}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hr, err := router.NewHotReloader(cfgPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewHotReloader: %v", err)
+	}
+	defer hr.Close()
+
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry(), Router: hr.Router}))
+	defer srv.Close()
+
+	code, body := get(t, srv.URL+"/config")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var routes []routeDump
+	if err := json.Unmarshal([]byte(body), &routes); err != nil {
+		t.Fatalf("/config is not JSON: %v", err)
+	}
+
+	// Match order: longest literal first, default last
+	var patterns []string
+	for _, r := range routes {
+		patterns = append(patterns, r.Pattern)
+	}
+	want := []string{"/api/reports", "/users/{id}", "/api/*", "default"}
+	if strings.Join(patterns, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected order %v, got %v", want, patterns)
+	}
+
+	reports, users, api := routes[0], routes[1], routes[2]
+	if reports.Headers["X-Version"] != "v2" || len(reports.Weights) != 2 || reports.Weights[0] != 3 {
+		t.Errorf("weighted header route not compiled as expected: %+v", reports)
+	}
+	if users.Regex == "" || users.Timeout != "2s" {
+		t.Errorf("template route should show its regex and timeout: %+v", users)
+	}
+	if api.Path != "/api" || api.Backends[0] != "http://api:8080" {
+		t.Errorf("wildcard route should show its stripped prefix: %+v", api)
+	}
+	if !routes[3].Default || routes[3].Order != 3 {
+		t.Errorf("expected default route last: %+v", routes[3])
+	}
+}
+
+func TestConfigDumpDisabledByDefault(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry()}))
+	defer srv.Close()
+
+	if code, _ := get(t, srv.URL+"/config"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a Router, got %d", code)
+	}
+}
+
+// --- Backend health ---
+
+func TestHealthBackendsReportsEachBackend(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer flaky.Close()
+
+	active := health.NewActiveChecker([]string{up.URL, down.URL, flaky.URL}, health.Config{
+		Interval:           20 * time.Millisecond,
+		Timeout:            time.Second,
+		HealthPath:         "/",
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+	passive := health.NewPassiveChecker(health.PassiveConfig{
+		WindowSize:     time.Minute,
+		ErrorThreshold: 0.5,
+		MinRequests:    4,
+	})
+	checker := health.NewCombined(active, passive)
+	defer checker.Close()
+
+	// flaky passes probes but fails 3 of 4 real requests
+	passive.RecordSuccess(flaky.URL)
+	for range 3 {
+		passive.RecordFailure(flaky.URL)
+	}
+	passive.RecordSuccess(up.URL)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for active.Status(up.URL) != health.StatusHealthy || active.Status(down.URL) != health.StatusUnhealthy ||
+		active.Status(flaky.URL) != health.StatusHealthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("active checks never settled: %v", active.AllStatus())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry(), Health: checker}))
+	defer srv.Close()
+
+	code, body := get(t, srv.URL+"/health/backends")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var got []backendHealth
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", body, err)
+	}
+	byAddr := map[string]backendHealth{}
+	for _, b := range got {
+		byAddr[b.Backend] = b
+	}
+	if len(got) != 3 || len(byAddr) != 3 {
+		t.Fatalf("expected 3 backends, got %s", body)
+	}
+
+	want := map[string]backendHealth{
+		up.URL:    {Backend: up.URL, ActiveStatus: "healthy", PassiveStatus: "healthy", PassiveErrorRate: 0, Healthy: true},
+		down.URL:  {Backend: down.URL, ActiveStatus: "unhealthy", PassiveStatus: "healthy", PassiveErrorRate: 0, Healthy: false},
+		flaky.URL: {Backend: flaky.URL, ActiveStatus: "healthy", PassiveStatus: "unhealthy", PassiveErrorRate: 0.75, Healthy: false},
+	}
+	for addr, w := range want {
+		if byAddr[addr] != w {
+			t.Errorf("%s: expected %+v, got %+v", addr, w, byAddr[addr])
+		}
+	}
+}
+
+func TestHealthBackendsDisabledByDefault(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry()}))
+	defer srv.Close()
+
+	if code, _ := get(t, srv.URL+"/health/backends"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a checker, got %d", code)
+	}
+}
+
+// --- Synthetic checks ---
+
+func TestSyntheticStatusReportsChecks(t *testing.T) {
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer canary.Close()
+
+	ran := make(chan struct{}, 1)
+	sc := health.NewSyntheticChecker(health.SyntheticConfig{
+		Name:     "canary",
+		Target:   canary.URL,
+		Interval: time.Hour,
+		Timeout:  time.Second,
+		OnResult: func(health.SyntheticResult) { ran <- struct{}{} },
+	})
+	defer sc.Close()
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("synthetic check never ran")
+	}
+
+	srv := httptest.NewServer(NewHandler(Config{
+		Gatherer:  prometheus.NewRegistry(),
+		Synthetic: []*health.SyntheticChecker{sc},
+	}))
+	defer srv.Close()
+
+	code, body := get(t, srv.URL+"/status/synthetic")
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a failing check, got %d", code)
+	}
+	var results []health.SyntheticResult
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if len(results) != 1 || results[0].Name != "canary" || results[0].Status != http.StatusBadGateway {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestSyntheticStatusDisabledByDefault(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry()}))
+	defer srv.Close()
+
+	if code, _ := get(t, srv.URL+"/status/synthetic"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without checks, got %d", code)
+	}
+}
+
+// --- Circuit controls ---
+
+func TestCircuitControlsForceOpenUntilReset(t *testing.T) {
+	circuits := circuitbreaker.NewPerBackend(3, 10*time.Millisecond)
+	srv := httptest.NewServer(NewHandler(Config{
+		Gatherer: prometheus.NewRegistry(),
+		Circuits: circuits,
+	}))
+	defer srv.Close()
+
+	const backend = "http://10.0.0.1:8080"
+	post := func(action string) (int, circuitDump) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/admin/circuits/"+action+"?backend="+url.QueryEscape(backend), "", nil)
+		if err != nil {
+			t.Fatalf("POST %s: %v", action, err)
+		}
+		defer resp.Body.Close()
+		var d circuitDump
+		json.NewDecoder(resp.Body).Decode(&d)
+		return resp.StatusCode, d
+	}
+
+	code, d := post("force-open")
+	if code != http.StatusOK || d != (circuitDump{Backend: backend, State: "open", Forced: true}) {
+		t.Fatalf("force-open: got %d %+v", code, d)
+	}
+	for range 5 {
+		circuits.RecordSuccess(backend)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if circuits.Allow(backend) {
+		t.Fatal("force-opened circuit should reject despite successes")
+	}
+
+	if code, d := post("reset"); code != http.StatusOK || d.State != "closed" || d.Forced {
+		t.Fatalf("reset: got %d %+v", code, d)
+	}
+	if !circuits.Allow(backend) {
+		t.Fatal("reset circuit should allow requests")
+	}
+
+	if code, d := post("force-close"); code != http.StatusOK || d.State != "closed" || !d.Forced {
+		t.Fatalf("force-close: got %d %+v", code, d)
+	}
+
+	if code, _ := post("explode"); code != http.StatusNotFound {
+		t.Fatalf("unknown action: expected 404, got %d", code)
+	}
+	resp, err := http.Post(srv.URL+"/admin/circuits/force-open", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("missing backend: expected 400, got %d", resp.StatusCode)
+	}
+	if code, _ := get(t, srv.URL+"/admin/circuits/reset?backend=x"); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: expected 405, got %d", code)
+	}
+}
+
+func TestCircuitControlsDisabledByDefault(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry()}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/admin/circuits/force-open?backend=x", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 without Circuits, got %d", resp.StatusCode)
+	}
+}
+
+// --- pprof ---
+
+func TestPprofEnabled(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{
+		Gatherer:    prometheus.NewRegistry(),
+		EnablePprof: true,
+	}))
+	defer srv.Close()
+
+	code, body := get(t, srv.URL+"/debug/pprof/goroutine?debug=1")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if !strings.Contains(body, "goroutine profile") {
+		t.Fatalf("expected goroutine profile, got %q", body[:min(len(body), 200)])
+	}
+}
+
+func TestPprofDisabledByDefault(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(Config{Gatherer: prometheus.NewRegistry()}))
+	defer srv.Close()
+
+	if code, _ := get(t, srv.URL+"/debug/pprof/goroutine?debug=1"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 when pprof disabled, got %d", code)
+	}
+}
@@ -35,6 +35,9 @@ func (s State) String() string {
 //   Open → Half-Open:   after timeout duration
 //   Half-Open → Closed: after one successful request
 //   Half-Open → Open:   after one failed request
+//
+// ForceOpen and ForceClose pin a state for operators; a forced circuit
+// makes no automatic transitions until Reset.
 type CircuitBreaker struct {
 	maxFailures int
 	timeout     time.Duration
@@ -43,6 +46,9 @@ type CircuitBreaker struct {
 	state           atomic.Uint32 // State (for fast reads without lock)
 	failures        int
 	lastFailureTime time.Time
+	forced          bool // state set by ForceOpen/ForceClose; no automatic transitions
+
+	onChange func(from, to State) // see Config.OnStateChange
 }
 
 // New creates a circuit breaker that opens after maxFailures consecutive
@@ -68,7 +74,7 @@ func (cb *CircuitBreaker) Allow() bool {
 	case StateOpen:
 		// Check if timeout has passed → transition to half-open
 		cb.mu.Lock()
-		if time.Since(cb.lastFailureTime) >= cb.timeout {
+		if !cb.forced && time.Since(cb.lastFailureTime) >= cb.timeout {
 			cb.setState(StateHalfOpen)
 			cb.mu.Unlock()
 			return true // allow the test request
@@ -105,6 +111,9 @@ func (cb *CircuitBreaker) RecordFailure() {
 
 	cb.failures++
 	cb.lastFailureTime = time.Now()
+	if cb.forced {
+		return
+	}
 
 	state := State(cb.state.Load())
 
@@ -119,12 +128,70 @@ func (cb *CircuitBreaker) RecordFailure() {
 	}
 }
 
+// probe applies an out-of-band health result to an open circuit whose
+// timeout has passed: healthy stands in for a successful test request and
+// closes it (via half-open), unhealthy keeps it open for another timeout.
+func (cb *CircuitBreaker) probe(healthy bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.forced || State(cb.state.Load()) != StateOpen || time.Since(cb.lastFailureTime) < cb.timeout {
+		return
+	}
+	if !healthy {
+		cb.lastFailureTime = time.Now()
+		return
+	}
+	cb.failures = 0
+	cb.setState(StateHalfOpen)
+	cb.setState(StateClosed)
+}
+
+// ForceOpen opens the circuit and keeps it open, whatever requests or
+// probes report, until Reset.
+func (cb *CircuitBreaker) ForceOpen() {
+	cb.force(StateOpen)
+}
+
+// ForceClose closes the circuit and keeps it closed, however many requests
+// fail, until Reset.
+func (cb *CircuitBreaker) ForceClose() {
+	cb.force(StateClosed)
+}
+
+func (cb *CircuitBreaker) force(s State) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.forced = true
+	cb.setState(s)
+}
+
+// Reset lifts a forced state and returns the circuit to closed with a
+// clean failure count, under automatic control again.
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.forced = false
+	cb.failures = 0
+	cb.setState(StateClosed)
+}
+
+// Forced reports whether the state was pinned by ForceOpen or ForceClose.
+func (cb *CircuitBreaker) Forced() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.forced
+}
+
 // State returns the current circuit breaker state.
 func (cb *CircuitBreaker) State() State {
 	return State(cb.state.Load())
 }
 
-// setState updates the state (must hold mu).
+// setState updates the state and reports a transition (must hold mu).
 func (cb *CircuitBreaker) setState(s State) {
-	cb.state.Store(uint32(s))
+	from := State(cb.state.Swap(uint32(s)))
+	if cb.onChange != nil && from != s {
+		cb.onChange(from, s)
+	}
 }
@@ -1,9 +1,15 @@
 package circuitbreaker
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/health"
 )
 
 // --- Circuit Breaker State Machine ---
@@ -212,4 +218,108 @@ func TestPerBackendRecovery(t *testing.T) {
 	if pb.State("X") != StateClosed {
 		t.Fatal("should be closed after recovery")
 	}
-}
\ No newline at end of file
+}
+func TestPerBackendProbeRecoversWithoutTraffic(t *testing.T) {
+	var up atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	active := health.NewActiveChecker([]string{backend.URL}, health.Config{
+		Interval:           20 * time.Millisecond,
+		Timeout:            time.Second,
+		HealthPath:         "/",
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+	defer active.Close()
+
+	var transitions []string
+	var mu sync.Mutex
+	pb := NewPerBackendWithConfig(Config{
+		MaxFailures:   2,
+		Timeout:       50 * time.Millisecond,
+		Probe:         active.IsHealthy,
+		ProbeInterval: 10 * time.Millisecond,
+		OnStateChange: func(_ string, from, to State) {
+			mu.Lock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+			mu.Unlock()
+		},
+	})
+	defer pb.Close()
+
+	pb.RecordFailure(backend.URL)
+	pb.RecordFailure(backend.URL)
+
+	// Still down: the prober keeps the circuit open
+	time.Sleep(150 * time.Millisecond)
+	if got := pb.State(backend.URL); got != StateOpen {
+		t.Fatalf("expected circuit to stay open while the backend is down, got %s", got)
+	}
+
+	// No client traffic from here on; the active checker sees recovery
+	up.Store(true)
+	deadline := time.Now().Add(2 * time.Second)
+	for pb.State(backend.URL) != StateClosed {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected circuit closed after the backend recovered, got %s", pb.State(backend.URL))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := "closed->open,open->half-open,half-open->closed"
+	if got := strings.Join(transitions, ","); got != want {
+		t.Fatalf("expected transitions %s, got %s", want, got)
+	}
+}
+
+func TestPerBackendForceOpenRejectsUntilReset(t *testing.T) {
+	pb := NewPerBackend(3, 10*time.Millisecond)
+
+	pb.ForceOpen("http://A:8080")
+	for range 5 {
+		pb.RecordSuccess("http://A:8080")
+	}
+	time.Sleep(20 * time.Millisecond) // past the timeout: no half-open either
+	if pb.Allow("http://A:8080") {
+		t.Fatal("force-opened circuit should reject despite successes")
+	}
+	if pb.State("http://A:8080") != StateOpen || !pb.Forced("http://A:8080") {
+		t.Fatalf("expected forced open, got %s (forced=%v)", pb.State("http://A:8080"), pb.Forced("http://A:8080"))
+	}
+
+	pb.Reset("http://A:8080")
+	if !pb.Allow("http://A:8080") || pb.Forced("http://A:8080") {
+		t.Fatal("reset circuit should allow requests under automatic control")
+	}
+	for range 3 {
+		pb.RecordFailure("http://A:8080")
+	}
+	if pb.State("http://A:8080") != StateOpen {
+		t.Fatal("after reset, failures should open the circuit again")
+	}
+}
+
+func TestPerBackendForceCloseIgnoresFailures(t *testing.T) {
+	pb := NewPerBackend(2, time.Minute)
+
+	pb.RecordFailure("http://A:8080")
+	pb.RecordFailure("http://A:8080")
+	if pb.State("http://A:8080") != StateOpen {
+		t.Fatal("expected circuit open")
+	}
+
+	pb.ForceClose("http://A:8080")
+	for range 5 {
+		pb.RecordFailure("http://A:8080")
+	}
+	if !pb.Allow("http://A:8080") || pb.State("http://A:8080") != StateClosed {
+		t.Fatalf("force-closed circuit should stay closed, got %s", pb.State("http://A:8080"))
+	}
+}
@@ -10,20 +10,90 @@ import (
 // This ensures that one failing backend doesn't cause the gateway to
 // reject requests to healthy backends.
 type PerBackend struct {
-	mu          sync.RWMutex
-	breakers    map[string]*CircuitBreaker
-	maxFailures int
-	timeout     time.Duration
+	mu            sync.RWMutex
+	breakers      map[string]*CircuitBreaker
+	maxFailures   int
+	timeout       time.Duration
+	onStateChange func(backend string, from, to State)
+	stop          chan struct{} // nil without a prober
+}
+
+// Config configures NewPerBackendWithConfig.
+type Config struct {
+	MaxFailures int           // consecutive failures that open a circuit
+	Timeout     time.Duration // time open before a circuit goes half-open
+
+	// OnStateChange, if set, is called on every transition of a backend's
+	// circuit, e.g. to keep the gateway_circuit_state gauge current. It runs
+	// under that circuit's lock, so it should be quick.
+	OnStateChange func(backend string, from, to State)
+
+	// Probe, if set, lets circuits recover without client traffic: every
+	// ProbeInterval, each circuit that has been open past Timeout is closed
+	// if Probe reports its backend healthy (e.g. ActiveChecker.IsHealthy),
+	// or kept open for another Timeout if not. Without it, an open circuit
+	// only goes half-open when a request arrives. Call Close to stop it.
+	Probe         func(backend string) bool
+	ProbeInterval time.Duration // default Timeout
 }
 
 // NewPerBackend creates a per-backend circuit breaker manager.
 // Each backend gets a circuit that opens after maxFailures consecutive
 // failures and transitions to half-open after timeout.
 func NewPerBackend(maxFailures int, timeout time.Duration) *PerBackend {
-	return &PerBackend{
-		breakers:    make(map[string]*CircuitBreaker),
-		maxFailures: maxFailures,
-		timeout:     timeout,
+	return NewPerBackendWithConfig(Config{MaxFailures: maxFailures, Timeout: timeout})
+}
+
+// NewPerBackendWithConfig creates a per-backend circuit breaker manager
+// that reports state changes.
+func NewPerBackendWithConfig(cfg Config) *PerBackend {
+	pb := &PerBackend{
+		breakers:      make(map[string]*CircuitBreaker),
+		maxFailures:   cfg.MaxFailures,
+		timeout:       cfg.Timeout,
+		onStateChange: cfg.OnStateChange,
+	}
+	if cfg.Probe != nil {
+		if cfg.ProbeInterval <= 0 {
+			cfg.ProbeInterval = cfg.Timeout
+		}
+		pb.stop = make(chan struct{})
+		go pb.probeLoop(cfg.Probe, cfg.ProbeInterval)
+	}
+	return pb
+}
+
+// Close stops the background prober, if there is one.
+func (pb *PerBackend) Close() {
+	if pb.stop != nil {
+		close(pb.stop)
+	}
+}
+
+// probeLoop offers open circuits a recovery check every interval.
+func (pb *PerBackend) probeLoop(probe func(backend string) bool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			pb.mu.RLock()
+			open := make(map[string]*CircuitBreaker)
+			for backend, cb := range pb.breakers {
+				if cb.State() == StateOpen {
+					open[backend] = cb
+				}
+			}
+			pb.mu.RUnlock()
+
+			// Probe outside pb.mu: it may be slow, and may call back in
+			for backend, cb := range open {
+				cb.probe(probe(backend))
+			}
+		case <-pb.stop:
+			return
+		}
 	}
 }
 
@@ -45,6 +115,29 @@ func (pb *PerBackend) RecordFailure(backend string) {
 	cb.RecordFailure()
 }
 
+// ForceOpen trips the backend's circuit and holds it open until Reset,
+// e.g. to stop traffic to a backend during an incident.
+func (pb *PerBackend) ForceOpen(backend string) {
+	pb.get(backend).ForceOpen()
+}
+
+// ForceClose closes the backend's circuit and holds it closed until Reset,
+// e.g. to override an open circuit that is a false positive.
+func (pb *PerBackend) ForceClose(backend string) {
+	pb.get(backend).ForceClose()
+}
+
+// Reset returns the backend's circuit to closed and to automatic control.
+func (pb *PerBackend) Reset(backend string) {
+	pb.get(backend).Reset()
+}
+
+// Forced reports whether the backend's circuit is held by ForceOpen or
+// ForceClose.
+func (pb *PerBackend) Forced(backend string) bool {
+	return pb.get(backend).Forced()
+}
+
 // State returns the current state of the circuit for the given backend.
 func (pb *PerBackend) State(backend string) State {
 	cb := pb.get(backend)
@@ -72,6 +165,9 @@ func (pb *PerBackend) get(backend string) *CircuitBreaker {
 	}
 
 	cb = New(pb.maxFailures, pb.timeout)
+	if pb.onStateChange != nil {
+		cb.onChange = func(from, to State) { pb.onStateChange(backend, from, to) }
+	}
 	pb.breakers[backend] = cb
 	return cb
 }
@@ -0,0 +1,308 @@
+// Package gateway composes routing, per-route load balancing, and proxying
+// into the single handler that serves gateway traffic.
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/middleware"
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/proxy"
+	"github.com/G1D0/Api-Gateway/internal/router"
+)
+
+// Config configures New.
+type Config struct {
+	// Router returns the active router; called per request, so
+	// HotReloader.Router can be passed to follow reloads. Required.
+	Router func() *router.Router
+
+	// Balancer builds a route's balancer from its backends. On reload it is
+	// only called for new routes and routes whose backends changed. Nil
+	// means DefaultBalancer.
+	Balancer func(route *router.Route) lb.Balancer
+
+	// Proxy configures the proxy shared by all routes.
+	Proxy proxy.ProxyConfig
+
+	// Metrics, if set, counts gateway_route_matched_total for requests
+	// Gateway matches itself, i.e. those without middleware.Routing in
+	// front, which counts its own.
+	Metrics *observe.Metrics
+
+	// NotFound handles requests that match no route. Nil means
+	// middleware.NotFoundJSON.
+	NotFound http.Handler
+}
+
+// DefaultBalancer is weighted round robin for routes configured with
+// weighted_backends, and plain round robin otherwise.
+func DefaultBalancer(route *router.Route) lb.Balancer {
+	if len(route.WeightedBackends) > 0 {
+		return lb.NewWeightedRoundRobin(route.WeightedBackends)
+	}
+	return lb.NewRoundRobin(route.Backends)
+}
+
+// Gateway matches each request to a route, picks a backend with that
+// route's own balancer, and proxies to it.
+//
+// Put middleware.Routing in front of it, on the same router, so
+// route-aware middleware such as RouteRateLimit and Metrics with
+// RouteService see the route; Gateway then reuses Routing's match instead
+// of matching again. Without Routing, Gateway matches, counts
+// Config.Metrics, and serves Config.NotFound itself.
+//
+// Balancers are built per router and stored with it in one atomic.Value,
+// so a request always sees a router and the balancers built for exactly
+// that router. On a hot reload a fresh set is built (by Update, or by the
+// first request to see the new router) and swapped in whole; requests
+// already in flight keep the set they started with, and release their
+// least-connections counts on it. Once Update has been called, the
+// snapshot is the only source of the router: Config.Router is no longer
+// polled, so a reloader can build the snapshot before it publishes.
+type Gateway struct {
+	router     func() *router.Router
+	newBalance func(*router.Route) lb.Balancer
+	metrics    *observe.Metrics
+	notFound   http.Handler
+	proxy      http.Handler
+
+	snap   atomic.Value // *snapshot for the current router
+	mu     sync.Mutex   // serializes snapshot builds
+	pushed atomic.Bool  // routers arrive through Update; don't poll g.router
+}
+
+// snapshot is a router and the balancers built for its routes.
+type snapshot struct {
+	router    *router.Router
+	balancers map[*router.Route]lb.Balancer
+	byKey     map[string]lb.Balancer // same balancers, by routeKey
+}
+
+// New creates a gateway handler.
+func New(cfg Config) *Gateway {
+	if cfg.Balancer == nil {
+		cfg.Balancer = DefaultBalancer
+	}
+	if cfg.NotFound == nil {
+		cfg.NotFound = middleware.NotFoundJSON
+	}
+	g := &Gateway{
+		router:     cfg.Router,
+		newBalance: cfg.Balancer,
+		metrics:    cfg.Metrics,
+		notFound:   cfg.NotFound,
+		proxy:      proxy.NewProxyWithConfig(routeBalancer{}, cfg.Proxy),
+	}
+	g.use(cfg.Router())
+	return g
+}
+
+// Update builds balancers for rt and swaps them in together with it. Pass
+// it to HotReloader.OnSwap so the rebuild happens on the reload path, and
+// before the reloader publishes rt. From the first call on, the gateway
+// serves the routers passed to Update and stops polling Config.Router;
+// without it, a router the gateway hasn't seen is picked up by the next
+// request. No-op if rt is already current.
+func (g *Gateway) Update(rt *router.Router) {
+	g.pushed.Store(true)
+	g.use(rt)
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := g.current()
+
+	// Reuse the route an outer middleware.Routing matched. Match here only
+	// without one, or if a reload landed in between and the route has no
+	// balancer in this snapshot; matching against the snapshot's router,
+	// not g.router(), guarantees the route has one
+	route := router.RouteFrom(r.Context())
+	balancer := snap.balancer(route)
+	if balancer == nil {
+		var params router.Params
+		route, params = snap.router.MatchWithParams(r)
+		if g.metrics != nil && router.RouteFrom(r.Context()) == nil {
+			pattern := "no_match"
+			if route != nil {
+				pattern = route.Pattern()
+			}
+			g.metrics.RouteMatched.WithLabelValues(pattern).Inc()
+		}
+		if route == nil {
+			g.notFound.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := router.WithRoute(r.Context(), route)
+		if params != nil {
+			ctx = router.WithParams(ctx, params)
+		}
+		r = r.WithContext(ctx)
+		balancer = snap.balancers[route]
+	}
+
+	pick := &routePick{balancer: balancer}
+	defer pick.release()
+	g.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), pickKey{}, pick)))
+}
+
+// current returns the snapshot for the active router.
+func (g *Gateway) current() *snapshot {
+	snap := g.snap.Load().(*snapshot)
+	if g.pushed.Load() {
+		return snap // Update keeps it current
+	}
+	rt := g.router()
+	if snap.router == rt {
+		return snap // lock-free fast path: no reload since the last request
+	}
+	return g.use(rt)
+}
+
+// use returns the snapshot for rt, building and storing it if rt isn't
+// the current router.
+//
+// Routes whose pattern, headers, and backends are unchanged from the
+// previous router keep their balancer, so a reload that edits one route
+// doesn't reset round robin positions or reshuffle another route's
+// consistent-hash keys. Only changed or new routes get a fresh balancer.
+func (g *Gateway) use(rt *router.Router) *snapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	prev, _ := g.snap.Load().(*snapshot)
+	if prev != nil && prev.router == rt {
+		return prev // built by a concurrent caller
+	}
+
+	snap := &snapshot{
+		router:    rt,
+		balancers: make(map[*router.Route]lb.Balancer),
+		byKey:     make(map[string]lb.Balancer),
+	}
+	rt.Each(func(route *router.Route) {
+		key := routeKey(route)
+		b, ok := prev.reuse(key)
+		if !ok {
+			b = g.newBalance(route)
+		}
+		snap.balancers[route] = b
+		snap.byKey[key] = b
+	})
+	g.snap.Store(snap)
+	return snap
+}
+
+// balancer returns the balancer for route, matched on this snapshot's
+// router or an identical route on another, or nil.
+func (s *snapshot) balancer(route *router.Route) lb.Balancer {
+	if route == nil {
+		return nil
+	}
+	if b, ok := s.balancers[route]; ok {
+		return b
+	}
+	return s.byKey[routeKey(route)]
+}
+
+// reuse returns the balancer the snapshot built for a route with key.
+func (s *snapshot) reuse(key string) (lb.Balancer, bool) {
+	if s == nil {
+		return nil, false
+	}
+	b, ok := s.byKey[key]
+	return b, ok
+}
+
+// routeKey is equal for two routes exactly when they match the same
+// requests and balance over the same weighted backends, in order.
+func routeKey(route *router.Route) string {
+	var b strings.Builder
+	b.WriteString(route.Pattern())
+
+	headers := make([]string, 0, len(route.Headers))
+	for k, v := range route.Headers {
+		headers = append(headers, http.CanonicalHeaderKey(k)+"="+v)
+	}
+	sort.Strings(headers)
+	for _, h := range headers {
+		b.WriteString("\x00h:" + h)
+	}
+
+	for i, addr := range route.Backends {
+		b.WriteString("\x00b:" + addr)
+		if i < len(route.WeightedBackends) {
+			b.WriteString("*" + strconv.Itoa(route.WeightedBackends[i].Weight))
+		}
+	}
+	return b.String()
+}
+
+// doner is a balancer that tracks in-flight requests per backend, such as
+// lb.LeastConnections, or health.HealthyPool, whose counts Drain waits on.
+type doner interface {
+	Done(backend string)
+}
+
+// pickKey is the context key for the request's routePick.
+type pickKey struct{}
+
+// routePick is the matched route's balancer and the backends picked from
+// it for one request (several, if the proxy retried).
+type routePick struct {
+	balancer lb.Balancer
+	picked   []string
+}
+
+// release tells a least-connections style balancer the request is over.
+// It goes to the balancer that counted the picks, even if a reload has
+// replaced it since.
+func (p *routePick) release() {
+	if d, ok := p.balancer.(doner); ok {
+		for _, backend := range p.picked {
+			d.Done(backend)
+		}
+	}
+}
+
+// routeBalancer is the proxy's balancer. It delegates to the route
+// balancer ServeHTTP stored in the request context.
+type routeBalancer struct{}
+
+// Next has no request, so no route; the proxy always calls NextWithRequest.
+func (routeBalancer) Next() string { return "" }
+
+// NextWithRequest picks a backend with the request's route balancer.
+func (routeBalancer) NextWithRequest(r *http.Request) string {
+	pick, _ := r.Context().Value(pickKey{}).(*routePick)
+	if pick == nil || pick.balancer == nil {
+		return ""
+	}
+
+	var backend string
+	if kb, ok := pick.balancer.(lb.KeyBalancer); ok {
+		backend = kb.NextWithRequest(r)
+	} else {
+		backend = pick.balancer.Next()
+	}
+	if backend != "" {
+		pick.picked = append(pick.picked, backend)
+	}
+	return backend
+}
+
+// Pin forwards to the route balancer if it is sticky.
+func (routeBalancer) Pin(w http.ResponseWriter, r *http.Request, backend string) {
+	if pick, _ := r.Context().Value(pickKey{}).(*routePick); pick != nil {
+		if sb, ok := pick.balancer.(lb.StickyBalancer); ok {
+			sb.Pin(w, r, backend)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/health"
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/middleware"
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// backendNamed returns a backend that answers with its name and the path it saw.
+func backendNamed(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name+" "+r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func mustRouter(t *testing.T, yaml string) *router.Router {
+	t.Helper()
+	cfg, err := router.ParseConfig([]byte(yaml))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+	return rt
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestGatewayRoutesToEachRoutesBackends(t *testing.T) {
+	users1, users2 := backendNamed(t, "users1"), backendNamed(t, "users2")
+	orders := backendNamed(t, "orders")
+
+	rt := mustRouter(t, `
+routes:
+  - path: /users/*
+    backends: ["`+users1.URL+`", "`+users2.URL+`"]
+  - path: /orders/*
+    backends: ["`+orders.URL+`"]
+`)
+	gw := httptest.NewServer(New(Config{Router: func() *router.Router { return rt }}))
+	defer gw.Close()
+
+	// Round robin within the route's own backend set
+	seen := map[string]int{}
+	for range 4 {
+		code, body := get(t, gw.URL+"/users/42")
+		if code != http.StatusOK {
+			t.Fatalf("/users/42: expected 200, got %d", code)
+		}
+		seen[body]++
+	}
+	if seen["users1 /users/42"] != 2 || seen["users2 /users/42"] != 2 {
+		t.Fatalf("expected /users split evenly across its two backends, got %v", seen)
+	}
+
+	for range 3 {
+		if _, body := get(t, gw.URL+"/orders/7"); body != "orders /orders/7" {
+			t.Fatalf("/orders/7: expected the orders backend, got %q", body)
+		}
+	}
+
+	if code, _ := get(t, gw.URL+"/nowhere"); code != http.StatusNotFound {
+		t.Fatalf("unmatched path: expected 404, got %d", code)
+	}
+}
+
+func TestGatewayRebuildsBalancersOnReload(t *testing.T) {
+	oldBackend, newBackend := backendNamed(t, "old"), backendNamed(t, "new")
+
+	var current atomic.Pointer[router.Router]
+	current.Store(mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+oldBackend.URL+`"]
+`))
+	gw := httptest.NewServer(New(Config{Router: current.Load}))
+	defer gw.Close()
+
+	if _, body := get(t, gw.URL+"/api"); body != "old /api" {
+		t.Fatalf("before reload: expected old backend, got %q", body)
+	}
+
+	current.Store(mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+newBackend.URL+`"]
+`))
+	if _, body := get(t, gw.URL+"/api"); body != "new /api" {
+		t.Fatalf("after reload: expected new backend, got %q", body)
+	}
+}
+
+func TestGatewayUpdateSwapsRouterAndBalancersTogether(t *testing.T) {
+	a, b := backendNamed(t, "a"), backendNamed(t, "b")
+	configs := []*router.Router{
+		mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+a.URL+`"]
+`),
+		mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+b.URL+`"]
+  - path: /new
+    backends: ["`+b.URL+`"]
+`),
+	}
+
+	var current atomic.Pointer[router.Router]
+	current.Store(configs[0])
+	g := New(Config{Router: current.Load})
+	gw := httptest.NewServer(g)
+	defer gw.Close()
+
+	// Flip between the two configs while requests are in flight. Every
+	// request must find a balancer for its route: a router paired with
+	// another router's balancers would yield "no backends" (503).
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			rt := configs[i%2]
+			current.Store(rt)
+			g.Update(rt)
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+	for range 200 {
+		code, body := get(t, gw.URL+"/api")
+		if code != http.StatusOK || (body != "a /api" && body != "b /api") {
+			close(stop)
+			t.Fatalf("request during reloads: got %d %q", code, body)
+		}
+	}
+	close(stop)
+	<-done
+
+	current.Store(configs[1])
+	g.Update(configs[1])
+	if _, body := get(t, gw.URL+"/api"); body != "b /api" {
+		t.Fatalf("after reload: expected new backend set, got %q", body)
+	}
+	if _, body := get(t, gw.URL+"/new"); body != "b /new" {
+		t.Fatalf("after reload: expected new route, got %q", body)
+	}
+}
+
+func TestGatewayHotReloaderSwapsBalancers(t *testing.T) {
+	oldBackend, newBackend := backendNamed(t, "old"), backendNamed(t, "new")
+	cfgPath := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig := func(backend string) {
+		t.Helper()
+		yaml := "routes:\n  - path: /api\n    backends: [\"" + backend + "\"]\n"
+		if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(oldBackend.URL)
+	hr, err := router.NewHotReloader(cfgPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewHotReloader: %v", err)
+	}
+	defer hr.Close()
+	g := New(Config{Router: hr.Router})
+	hr.OnSwap(g.Update)
+	gw := httptest.NewServer(g)
+	defer gw.Close()
+
+	writeConfig(newBackend.URL)
+	if err := hr.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, body := get(t, gw.URL+"/api"); body != "new /api" {
+		t.Fatalf("after reload: expected new backend, got %q", body)
+	}
+
+	// An invalid config keeps the old router and its balancers
+	if err := os.WriteFile(cfgPath, []byte("routes: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := hr.Reload(); err == nil {
+		t.Fatal("expected invalid config to be rejected")
+	}
+	if _, body := get(t, gw.URL+"/api"); body != "new /api" {
+		t.Fatalf("after invalid reload: expected previous backend, got %q", body)
+	}
+}
+
+func TestGatewayUpdateTakesOverFromConfigRouter(t *testing.T) {
+	a, b := backendNamed(t, "a"), backendNamed(t, "b")
+	oldRouter := mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+a.URL+`"]
+`)
+	g := New(Config{Router: func() *router.Router { return oldRouter }})
+	gw := httptest.NewServer(g)
+	defer gw.Close()
+
+	// Like HotReloader.OnSwap: the gateway gets the new router before the
+	// reloader publishes it, and serves it without waiting for Config.Router
+	g.Update(mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+b.URL+`"]
+`))
+	for range 3 {
+		if _, body := get(t, gw.URL+"/api"); body != "b /api" {
+			t.Fatalf("expected the updated router, got %q", body)
+		}
+	}
+}
+
+func TestGatewayReleasesLeastConnections(t *testing.T) {
+	a, b := backendNamed(t, "a"), backendNamed(t, "b")
+	rt := mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+a.URL+`", "`+b.URL+`"]
+`)
+	gw := httptest.NewServer(New(Config{
+		Router: func() *router.Router { return rt },
+		Balancer: func(route *router.Route) lb.Balancer {
+			return lb.NewLeastConnections(route.Backends)
+		},
+	}))
+	defer gw.Close()
+
+	// With every request released, both backends stay at zero active and
+	// the first one keeps winning the tie. A leak would alternate a, b, a...
+	for range 4 {
+		if _, body := get(t, gw.URL+"/api"); body != "a /api" {
+			t.Fatalf("expected counts released after each request, got %q", body)
+		}
+	}
+}
+
+func TestGatewayReloadKeepsUnchangedRouteBalancers(t *testing.T) {
+	config := func(bBackends string) *router.Router {
+		return mustRouter(t, `
+routes:
+  - path: /a
+    backends: ["http://a1:8080", "http://a2:8080", "http://a3:8080"]
+  - path: /b
+    backends: [`+bBackends+`]
+`)
+	}
+
+	builds := map[string]int{}
+	var current atomic.Pointer[router.Router]
+	current.Store(config(`"http://b1:8080"`))
+	g := New(Config{
+		Router: current.Load,
+		Balancer: func(route *router.Route) lb.Balancer {
+			builds[route.Pattern()]++
+			return lb.NewConsistentHash(50, route.Backends)
+		},
+	})
+
+	balancerFor := func(pattern string) *lb.ConsistentHash {
+		t.Helper()
+		snap := g.snap.Load().(*snapshot)
+		for route, b := range snap.balancers {
+			if route.Pattern() == pattern {
+				return b.(*lb.ConsistentHash)
+			}
+		}
+		t.Fatalf("no balancer for %s", pattern)
+		return nil
+	}
+	keys := []string{"alice", "bob", "carol", "dave", "erin", "frank"}
+	mapping := func(ch *lb.ConsistentHash) []string {
+		out := make([]string, len(keys))
+		for i, k := range keys {
+			out[i] = ch.NextWithKey(k)
+		}
+		return out
+	}
+
+	aBefore := balancerFor("/a")
+	mappingBefore := mapping(aBefore)
+
+	// Change only route /b
+	next := config(`"http://b1:8080", "http://b2:8080"`)
+	current.Store(next)
+	g.Update(next)
+
+	if aAfter := balancerFor("/a"); aAfter != aBefore {
+		t.Fatal("unchanged route /a got a new balancer")
+	}
+	if got := mapping(balancerFor("/a")); strings.Join(got, ",") != strings.Join(mappingBefore, ",") {
+		t.Fatalf("route /a mapping changed: %v -> %v", mappingBefore, got)
+	}
+	if builds["/a"] != 1 || builds["/b"] != 2 {
+		t.Fatalf("expected /a built once and /b rebuilt, got %v", builds)
+	}
+	if got := balancerFor("/b").NextWithKey("x"); got != "http://b1:8080" && got != "http://b2:8080" {
+		t.Fatalf("route /b should balance over its new backends, got %s", got)
+	}
+}
+
+func TestGatewayDrainWaitsForProxiedRequest(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			return
+		}
+		close(started)
+		<-release
+		io.WriteString(w, "slow")
+	}))
+	defer slow.Close()
+	other := backendNamed(t, "other")
+
+	backends := []string{slow.URL, other.URL}
+	active := health.NewActiveChecker(backends, health.Config{
+		Interval:           time.Hour,
+		Timeout:            time.Second,
+		HealthPath:         "/healthz",
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+	defer active.Close()
+	passive := health.NewPassiveChecker(health.PassiveConfig{WindowSize: time.Minute, ErrorThreshold: 0.5, MinRequests: 100})
+	pool := health.NewHealthyPool(backends, health.NewCombined(active, passive))
+	defer pool.Close()
+
+	rt := mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+slow.URL+`", "`+other.URL+`"]
+`)
+	gw := httptest.NewServer(New(Config{
+		Router:   func() *router.Router { return rt },
+		Balancer: func(*router.Route) lb.Balancer { return pool },
+	}))
+	defer gw.Close()
+
+	// The pool's first pick is slow; hold that request open
+	result := make(chan string, 1)
+	go func() {
+		_, body := get(t, gw.URL+"/api")
+		result <- body
+	}()
+	<-started
+	if n := pool.InFlight(slow.URL); n != 1 {
+		t.Fatalf("expected the proxied request counted in flight, got %d", n)
+	}
+
+	drained := pool.Drain(slow.URL, 5*time.Second)
+	select {
+	case <-drained:
+		t.Fatal("drain finished while a proxied request was still in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// New requests avoid the draining backend
+	if _, body := get(t, gw.URL+"/api"); body != "other /api" {
+		t.Fatalf("expected new traffic on the other backend, got %q", body)
+	}
+
+	close(release)
+	if body := <-result; body != "slow" {
+		t.Fatalf("in-flight request should complete, got %q", body)
+	}
+	select {
+	case <-drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain did not finish once the request completed")
+	}
+	if all := pool.All(); len(all) != 1 || all[0] != other.URL {
+		t.Fatalf("expected the drained backend removed, got %v", all)
+	}
+}
+
+func TestGatewayReusesRoutingMatch(t *testing.T) {
+	api := backendNamed(t, "api")
+	rt := mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+api.URL+`"]
+    rate_limit:
+      burst: 1
+      rate: 1
+      per: 1h
+`)
+	m := observe.NewMetrics(prometheus.NewRegistry())
+	routes := func() *router.Router { return rt }
+	gw := httptest.NewServer(middleware.Chain(
+		middleware.Routing(middleware.RoutingConfig{Router: routes, Metrics: m}),
+		middleware.RouteRateLimit(lb.ClientIPKey),
+	)(New(Config{Router: routes, Metrics: m})))
+	defer gw.Close()
+
+	if code, body := get(t, gw.URL+"/api"); code != http.StatusOK || body != "api /api" {
+		t.Fatalf("expected api /api, got %d %q", code, body)
+	}
+	// The route limiter sees the route Routing matched
+	if code, _ := get(t, gw.URL+"/api"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the route's rate limit to apply, got %d", code)
+	}
+	if code, _ := get(t, gw.URL+"/missing"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unmatched path, got %d", code)
+	}
+
+	// Routing counted each request; the gateway didn't count them again
+	if got := testutil.ToFloat64(m.RouteMatched.WithLabelValues("/api")); got != 2 {
+		t.Fatalf("expected /api counted once per request, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.RouteMatched.WithLabelValues("no_match")); got != 1 {
+		t.Fatalf("expected one no_match, got %v", got)
+	}
+}
+
+func TestGatewayRematchesRouteFromReplacedRouter(t *testing.T) {
+	oldBackend, newBackend := backendNamed(t, "old"), backendNamed(t, "new")
+	oldRT := mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+oldBackend.URL+`"]
+`)
+	var current atomic.Pointer[router.Router]
+	current.Store(mustRouter(t, `
+routes:
+  - path: /api
+    backends: ["`+newBackend.URL+`"]
+`))
+	gw := New(Config{Router: current.Load})
+
+	// A route Routing matched on a router that was reloaded away before
+	// the gateway saw the request
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req = req.WithContext(router.WithRoute(req.Context(), oldRT.Match(req)))
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, req)
+	if rec.Body.String() != "new /api" {
+		t.Fatalf("expected the current router's backend, got %d %q", rec.Code, rec.Body.String())
+	}
+}
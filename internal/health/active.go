@@ -2,7 +2,11 @@ package health
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"maps"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,6 +18,7 @@ const (
 	StatusUnknown Status = iota
 	StatusHealthy
 	StatusUnhealthy
+	StatusDegraded // serving, but with elevated errors; gets reduced traffic
 )
 
 func (s Status) String() string {
@@ -22,6 +27,8 @@ func (s Status) String() string {
 		return "healthy"
 	case StatusUnhealthy:
 		return "unhealthy"
+	case StatusDegraded:
+		return "degraded"
 	default:
 		return "unknown"
 	}
@@ -33,6 +40,7 @@ type backendStatus struct {
 	status            Status
 	consecutiveSuccesses int
 	consecutiveFailures  int
+	probed               bool // at least one probe has completed
 }
 
 // ActiveChecker periodically probes backends with health check requests.
@@ -43,12 +51,17 @@ type ActiveChecker struct {
 	interval            time.Duration
 	timeout             time.Duration
 	healthPath          string
+	healthPaths         map[string]string // per-backend overrides of healthPath
 	healthyThreshold    int // consecutive successes to mark healthy
 	unhealthyThreshold  int // consecutive failures to mark unhealthy
+	onStatusChange      func(backend string, from, to Status)
+	jsonField           []string // JSONField split on "."; nil to skip body checks
+	jsonValue           string
 
 	client *http.Client
 	ctx    context.Context
 	cancel context.CancelFunc
+	done   chan struct{} // closed when run returns
 }
 
 // Config holds active health check configuration.
@@ -56,10 +69,31 @@ type Config struct {
 	Interval           time.Duration // how often to probe
 	Timeout            time.Duration // per-probe timeout
 	HealthPath         string        // e.g., "/health"
+
 	HealthyThreshold   int           // consecutive successes
 	UnhealthyThreshold int           // consecutive failures
+
+	// HealthPaths overrides HealthPath for individual backends, keyed by
+	// backend address, for pools mixing e.g. "/healthz" and "/health".
+	HealthPaths map[string]string
+
+	// OnStatusChange, if set, is called whenever a backend's status changes,
+	// e.g. to start lb.LeastConnections slow start on Unhealthy -> Healthy.
+	// It runs on the probe goroutine, so it should be quick.
+	OnStatusChange func(backend string, from, to Status)
+
+	// JSONField, if set, also requires the 2xx response body to be JSON
+	// with JSONValue at this dot-separated path, for backends that report
+	// their own health, e.g. Spring Boot Actuator's {"status":"UP"} with
+	// JSONField "status" and JSONValue "UP". Non-string values are compared
+	// in their JSON form ("true", "1").
+	JSONField string
+	JSONValue string
 }
 
+// maxHealthBody caps how much of a health response is read for JSONField.
+const maxHealthBody = 1 << 20 // 1 MiB
+
 // NewActiveChecker creates and starts an active health checker.
 func NewActiveChecker(backends []string, cfg Config) *ActiveChecker {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -69,13 +103,21 @@ func NewActiveChecker(backends []string, cfg Config) *ActiveChecker {
 		interval:           cfg.Interval,
 		timeout:            cfg.Timeout,
 		healthPath:         cfg.HealthPath,
+		healthPaths:        maps.Clone(cfg.HealthPaths),
 		healthyThreshold:   cfg.HealthyThreshold,
 		unhealthyThreshold: cfg.UnhealthyThreshold,
+		onStatusChange:     cfg.OnStatusChange,
+		jsonValue:          cfg.JSONValue,
 		client: &http.Client{
 			Timeout: cfg.Timeout,
 		},
 		ctx:    ctx,
 		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	if cfg.JSONField != "" {
+		ac.jsonField = strings.Split(cfg.JSONField, ".")
 	}
 
 	// Initialize backends as unknown
@@ -119,13 +161,33 @@ func (ac *ActiveChecker) Status(backend string) Status {
 	return bs.status
 }
 
-// Close stops the health checker.
+// Ready reports whether every backend has been probed at least once.
+// Until then IsHealthy optimistically passes unprobed backends, so gate
+// readiness (/readyz) on it to keep traffic away until health is known.
+func (ac *ActiveChecker) Ready() bool {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	for _, bs := range ac.backends {
+		bs.mu.RLock()
+		probed := bs.probed
+		bs.mu.RUnlock()
+		if !probed {
+			return false
+		}
+	}
+	return true
+}
+
+// Close stops the health checker. Probes in flight are cancelled rather
+// than left to run out Timeout, and Close returns once they have exited.
 func (ac *ActiveChecker) Close() {
 	ac.cancel()
+	<-ac.done
 }
 
 // run is the background goroutine that probes backends.
 func (ac *ActiveChecker) run() {
+	defer close(ac.done)
 	ticker := time.NewTicker(ac.interval)
 	defer ticker.Stop()
 
@@ -164,7 +226,11 @@ func (ac *ActiveChecker) probeAll() {
 
 // probe sends a health check request to one backend.
 func (ac *ActiveChecker) probe(backend string) {
-	url := backend + ac.healthPath
+	path, ok := ac.healthPaths[backend]
+	if !ok {
+		path = ac.healthPath
+	}
+	url := backend + path
 
 	req, err := http.NewRequestWithContext(ac.ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -174,51 +240,105 @@ func (ac *ActiveChecker) probe(backend string) {
 
 	resp, err := ac.client.Do(req)
 	if err != nil {
+		if ac.ctx.Err() != nil {
+			return // cancelled by Close; says nothing about the backend
+		}
 		ac.recordFailure(backend)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Consider 2xx as healthy
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+	// Consider 2xx as healthy, if the body agrees when JSONField is set
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && ac.bodyHealthy(resp.Body) {
 		ac.recordSuccess(backend)
 	} else {
 		ac.recordFailure(backend)
 	}
 }
 
+// bodyHealthy reports whether a health response body has jsonValue at
+// jsonField. Always true when no field is configured.
+func (ac *ActiveChecker) bodyHealthy(body io.Reader) bool {
+	if ac.jsonField == nil {
+		return true
+	}
+	var v any
+	if err := json.NewDecoder(io.LimitReader(body, maxHealthBody)).Decode(&v); err != nil {
+		return false
+	}
+	for _, key := range ac.jsonField {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		if v, ok = obj[key]; !ok {
+			return false
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s == ac.jsonValue
+	}
+	b, _ := json.Marshal(v)
+	return string(b) == ac.jsonValue
+}
+
 // recordSuccess updates state after a successful health check.
 func (ac *ActiveChecker) recordSuccess(backend string) {
-	ac.mu.RLock()
-	bs := ac.backends[backend]
-	ac.mu.RUnlock()
+	bs := ac.lookup(backend)
+	if bs == nil {
+		return // removed while the probe was in flight
+	}
 
 	bs.mu.Lock()
-	defer bs.mu.Unlock()
-
+	from := bs.status
+	bs.probed = true
 	bs.consecutiveSuccesses++
 	bs.consecutiveFailures = 0
 
 	if bs.consecutiveSuccesses >= ac.healthyThreshold {
 		bs.status = StatusHealthy
 	}
+	to := bs.status
+	bs.mu.Unlock()
+
+	ac.notify(backend, from, to)
 }
 
 // recordFailure updates state after a failed health check.
 func (ac *ActiveChecker) recordFailure(backend string) {
-	ac.mu.RLock()
-	bs := ac.backends[backend]
-	ac.mu.RUnlock()
+	bs := ac.lookup(backend)
+	if bs == nil {
+		return // removed while the probe was in flight
+	}
 
 	bs.mu.Lock()
-	defer bs.mu.Unlock()
-
+	from := bs.status
+	bs.probed = true
 	bs.consecutiveFailures++
 	bs.consecutiveSuccesses = 0
 
 	if bs.consecutiveFailures >= ac.unhealthyThreshold {
 		bs.status = StatusUnhealthy
 	}
+	to := bs.status
+	bs.mu.Unlock()
+
+	ac.notify(backend, from, to)
+}
+
+// lookup returns the backend's status, or nil if it is no longer checked.
+func (ac *ActiveChecker) lookup(backend string) *backendStatus {
+	ac.mu.RLock()
+	defer ac.mu.RUnlock()
+	return ac.backends[backend]
+}
+
+// notify calls the OnStatusChange hook if the status actually changed.
+// Called without bs.mu held so the hook may query the checker.
+func (ac *ActiveChecker) notify(backend string, from, to Status) {
+	if from != to && ac.onStatusChange != nil {
+		ac.onStatusChange(backend, from, to)
+	}
 }
 
 // AddBackend dynamically adds a new backend to monitor.
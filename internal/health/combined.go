@@ -1,5 +1,10 @@
 package health
 
+import (
+	"sort"
+	"time"
+)
+
 // CombinedChecker combines active and passive health checks.
 //
 // A backend is considered healthy only if BOTH active and passive checks pass.
@@ -23,6 +28,23 @@ func (c *CombinedChecker) IsHealthy(backend string) bool {
 	return c.active.IsHealthy(backend) && c.passive.IsHealthy(backend)
 }
 
+// Weight returns the share of normal traffic a backend should get, for a
+// weighted balancer: 1.0 when healthy, 0.5 when degraded (passive error rate
+// above DegradedThreshold), 0.0 when unhealthy by either check.
+func (c *CombinedChecker) Weight(backend string) float64 {
+	if !c.active.IsHealthy(backend) {
+		return 0
+	}
+	switch c.passive.Status(backend) {
+	case StatusUnhealthy:
+		return 0
+	case StatusDegraded:
+		return 0.5
+	default:
+		return 1
+	}
+}
+
 // RecordSuccess records a successful request (for passive checks).
 func (c *CombinedChecker) RecordSuccess(backend string) {
 	c.passive.RecordSuccess(backend)
@@ -33,6 +55,11 @@ func (c *CombinedChecker) RecordFailure(backend string) {
 	c.passive.RecordFailure(backend)
 }
 
+// RecordLatency records a request's latency (for passive checks).
+func (c *CombinedChecker) RecordLatency(backend string, d time.Duration) {
+	c.passive.RecordLatency(backend, d)
+}
+
 // ActiveStatus returns the active health check status.
 func (c *CombinedChecker) ActiveStatus(backend string) Status {
 	return c.active.Status(backend)
@@ -43,6 +70,34 @@ func (c *CombinedChecker) PassiveErrorRate(backend string) float64 {
 	return c.passive.ErrorRate(backend)
 }
 
+// PassiveStatus returns the passive health check status.
+func (c *CombinedChecker) PassiveStatus(backend string) Status {
+	return c.passive.Status(backend)
+}
+
+// Backends returns the backends under active checking, sorted.
+func (c *CombinedChecker) Backends() []string {
+	all := c.active.AllStatus()
+	backends := make([]string, 0, len(all))
+	for addr := range all {
+		backends = append(backends, addr)
+	}
+	sort.Strings(backends)
+	return backends
+}
+
+// RemoveBackend stops probing backend and forgets its passive history.
+func (c *CombinedChecker) RemoveBackend(backend string) {
+	c.active.RemoveBackend(backend)
+	c.passive.Remove(backend)
+}
+
+// Ready reports whether the active checker has probed every backend once
+// (see ActiveChecker.Ready).
+func (c *CombinedChecker) Ready() bool {
+	return c.active.Ready()
+}
+
 // Close stops the active health checker.
 func (c *CombinedChecker) Close() {
 	c.active.Close()
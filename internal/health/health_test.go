@@ -1,10 +1,22 @@
 package health
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // --- Active Health Checks ---
@@ -93,6 +105,49 @@ func TestActiveHealthCheckRecovery(t *testing.T) {
 	}
 }
 
+func TestActiveHealthCheckStatusChangeStartsSlowStart(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+
+	lc := lb.NewLeastConnectionsWithConfig([]string{"http://other", backend.URL}, lb.LeastConnConfig{SlowStart: time.Minute})
+	recovered := make(chan struct{}, 1)
+	ac := NewActiveChecker([]string{backend.URL}, Config{
+		Interval:           20 * time.Millisecond,
+		Timeout:            1 * time.Second,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+		OnStatusChange: func(b string, from, to Status) {
+			if from == StatusUnhealthy && to == StatusHealthy {
+				lc.Recovered(b)
+				recovered <- struct{}{}
+			}
+		},
+	})
+	defer ac.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	failing.Store(false)
+	select {
+	case <-recovered:
+	case <-time.After(time.Second):
+		t.Fatal("expected an Unhealthy -> Healthy transition")
+	}
+
+	// "other" already has a request in flight, but the recovered backend is
+	// still ramping up, so least-connections keeps picking "other"
+	lc.Next()
+	if got := lc.Next(); got != "http://other" {
+		t.Fatalf("recovered backend should be in slow start, got %s", got)
+	}
+}
+
 func TestActiveHealthCheckUnreachable(t *testing.T) {
 	// Point at non-existent backend
 	ac := NewActiveChecker([]string{"http://127.0.0.1:1"}, Config{
@@ -111,6 +166,215 @@ func TestActiveHealthCheckUnreachable(t *testing.T) {
 	}
 }
 
+func TestActiveHealthCheckPerBackendHealthPath(t *testing.T) {
+	servePath := func(path string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != path {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	healthz := servePath("/healthz")
+	health := servePath("/health")
+
+	ac := NewActiveChecker([]string{healthz.URL, health.URL}, Config{
+		Interval:           20 * time.Millisecond,
+		Timeout:            time.Second,
+		HealthPath:         "/healthz",
+		HealthPaths:        map[string]string{health.URL: "/health"},
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+	defer ac.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for ac.Status(healthz.URL) != StatusHealthy || ac.Status(health.URL) != StatusHealthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected both backends healthy at their own paths, got %v", ac.AllStatus())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestActiveHealthCheckReadyAfterFirstProbe(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // hold the first probe so construction can't race it
+	}))
+	defer backend.Close()
+
+	ac := NewActiveChecker([]string{backend.URL}, Config{
+		Interval:           time.Hour,
+		Timeout:            5 * time.Second,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	})
+	defer ac.Close()
+
+	if ac.Ready() {
+		t.Fatal("expected not ready before any probe completed")
+	}
+	if !ac.IsHealthy(backend.URL) {
+		t.Fatal("unprobed backend is still optimistically healthy")
+	}
+
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for !ac.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected ready after the first probe cycle")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// One success is below HealthyThreshold: probed, but status still unknown
+	if got := ac.Status(backend.URL); got != StatusUnknown {
+		t.Fatalf("expected status unknown after one probe, got %s", got)
+	}
+}
+
+func TestActiveHealthCheckJSONField(t *testing.T) {
+	serve := func(body string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	up := serve(`{"status":"UP","checks":[{"name":"db","status":"UP"}]}`)
+	down := serve(`{"status":"DOWN","checks":[{"name":"db","status":"DOWN"}]}`)
+	nested := serve(`{"components":{"db":{"status":"UP"}}}`)
+	notJSON := serve(`UP`)
+
+	check := func(field string, backends ...string) *ActiveChecker {
+		ac := NewActiveChecker(backends, Config{
+			Interval:           time.Hour, // the startup probe is enough
+			Timeout:            time.Second,
+			HealthPath:         "/actuator/health",
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 1,
+			JSONField:          field,
+			JSONValue:          "UP",
+		})
+		t.Cleanup(ac.Close)
+		deadline := time.Now().Add(2 * time.Second)
+		for _, b := range backends {
+			for ac.Status(b) == StatusUnknown && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+		return ac
+	}
+
+	ac := check("status", up.URL, down.URL, notJSON.URL)
+	if got := ac.Status(up.URL); got != StatusHealthy {
+		t.Fatalf(`{"status":"UP"}: expected healthy, got %s`, got)
+	}
+	if got := ac.Status(down.URL); got != StatusUnhealthy {
+		t.Fatalf(`{"status":"DOWN"}: expected unhealthy, got %s`, got)
+	}
+	if got := ac.Status(notJSON.URL); got != StatusUnhealthy {
+		t.Fatalf("non-JSON body: expected unhealthy, got %s", got)
+	}
+
+	ac = check("components.db.status", nested.URL, up.URL)
+	if got := ac.Status(nested.URL); got != StatusHealthy {
+		t.Fatalf("nested path: expected healthy, got %s", got)
+	}
+	if got := ac.Status(up.URL); got != StatusUnhealthy {
+		t.Fatalf("missing nested path: expected unhealthy, got %s", got)
+	}
+}
+
+func TestActiveHealthCheckCloseCancelsInFlightProbe(t *testing.T) {
+	probed := make(chan struct{}, 1)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case probed <- struct{}{}:
+		default:
+		}
+		select { // hang until the probe is cancelled
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	ac := NewActiveChecker([]string{backend.URL}, Config{
+		Interval:           time.Hour,
+		Timeout:            time.Minute,
+		HealthPath:         "/",
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+
+	select {
+	case <-probed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("probe never reached the backend")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		ac.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Close waited on the hanging probe instead of cancelling it")
+	}
+
+	if got := ac.Status(backend.URL); got != StatusUnknown {
+		t.Fatalf("a cancelled probe should not count as a failure, got %s", got)
+	}
+}
+
+func TestActiveHealthCheckRemoveDuringProbe(t *testing.T) {
+	probed := make(chan struct{})
+	var once sync.Once
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(probed) })
+		<-release
+	}))
+	defer backend.Close()
+
+	// No backends at start, so the checker's own first round probes nothing
+	ac := NewActiveChecker(nil, Config{
+		Interval:           time.Hour,
+		Timeout:            time.Minute,
+		HealthPath:         "/",
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 1,
+	})
+	defer ac.Close()
+	ac.AddBackend(backend.URL)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ac.probe(backend.URL)
+	}()
+	<-probed
+	ac.RemoveBackend(backend.URL)
+	close(release)
+
+	select {
+	case <-done: // the result is dropped rather than recorded on a nil status
+	case <-time.After(2 * time.Second):
+		t.Fatal("probe never finished")
+	}
+	if _, ok := ac.AllStatus()[backend.URL]; ok {
+		t.Fatal("a late probe result should not bring the backend back")
+	}
+}
+
 // --- Passive Health Checks ---
 
 func TestPassiveHealthCheckErrorRate(t *testing.T) {
@@ -185,6 +449,65 @@ func TestPassiveHealthCheckSlidingWindow(t *testing.T) {
 	}
 }
 
+func TestPassiveHealthCheckSlowBackend(t *testing.T) {
+	pc := NewPassiveChecker(PassiveConfig{
+		WindowSize:       10 * time.Second,
+		ErrorThreshold:   0.5,
+		MinRequests:      10,
+		LatencyThreshold: 500 * time.Millisecond,
+	})
+
+	// Every request succeeds, but takes 2s
+	for i := 0; i < 10; i++ {
+		pc.RecordSuccess("slow")
+		pc.RecordLatency("slow", 2*time.Second)
+	}
+	if pc.IsHealthy("slow") {
+		t.Fatal("all-200 but slow backend should be unhealthy with a latency threshold")
+	}
+	if got := pc.P95Latency("slow"); got != 2*time.Second {
+		t.Fatalf("expected p95 2s, got %s", got)
+	}
+
+	// Same traffic without a threshold stays healthy
+	lenient := NewPassiveChecker(PassiveConfig{WindowSize: 10 * time.Second, ErrorThreshold: 0.5, MinRequests: 10})
+	for i := 0; i < 10; i++ {
+		lenient.RecordSuccess("slow")
+		lenient.RecordLatency("slow", 2*time.Second)
+	}
+	if !lenient.IsHealthy("slow") {
+		t.Fatal("latency should not affect health when LatencyThreshold is unset")
+	}
+}
+
+func TestPassiveLatencyStats(t *testing.T) {
+	pc := NewPassiveChecker(PassiveConfig{
+		WindowSize:       10 * time.Second,
+		ErrorThreshold:   0.5,
+		MinRequests:      10,
+		LatencyThreshold: 500 * time.Millisecond,
+	})
+
+	// 19 fast requests and one slow outlier: p95 ignores the outlier
+	for i := 0; i < 19; i++ {
+		pc.RecordLatency("b", 100*time.Millisecond)
+	}
+	pc.RecordLatency("b", 2100*time.Millisecond)
+
+	if got := pc.P95Latency("b"); got != 100*time.Millisecond {
+		t.Fatalf("expected p95 100ms, got %s", got)
+	}
+	if got := pc.AverageLatency("b"); got != 200*time.Millisecond {
+		t.Fatalf("expected average 200ms, got %s", got)
+	}
+	if !pc.IsHealthy("b") {
+		t.Fatal("a single outlier should not mark the backend unhealthy")
+	}
+	if pc.P95Latency("unknown") != 0 || pc.AverageLatency("unknown") != 0 {
+		t.Fatal("expected zero latency for a backend with no samples")
+	}
+}
+
 // --- Combined Checker ---
 
 func TestCombinedCheckerBothPass(t *testing.T) {
@@ -258,6 +581,54 @@ func TestCombinedCheckerEitherFails(t *testing.T) {
 	}
 }
 
+func TestCombinedCheckerWeightBands(t *testing.T) {
+	active := NewActiveChecker(nil, Config{Interval: time.Hour, Timeout: time.Second, HealthPath: "/"})
+	defer active.Close()
+	passive := NewPassiveChecker(PassiveConfig{
+		WindowSize:        10 * time.Second,
+		ErrorThreshold:    0.5,
+		DegradedThreshold: 0.2,
+		MinRequests:       10,
+	})
+	combined := NewCombined(active, passive)
+
+	// record sends 10 requests to backend, the given number of which fail
+	record := func(backend string, failures int) {
+		for i := 0; i < 10; i++ {
+			if i < failures {
+				combined.RecordFailure(backend)
+			} else {
+				combined.RecordSuccess(backend)
+			}
+		}
+	}
+	record("healthy", 1)  // 10%
+	record("degraded", 3) // 30%
+	record("down", 6)     // 60%
+
+	tests := []struct {
+		backend string
+		status  Status
+		weight  float64
+		healthy bool
+	}{
+		{"healthy", StatusHealthy, 1.0, true},
+		{"degraded", StatusDegraded, 0.5, true},
+		{"down", StatusUnhealthy, 0.0, false},
+	}
+	for _, tt := range tests {
+		if got := passive.Status(tt.backend); got != tt.status {
+			t.Errorf("%s: expected status %s, got %s", tt.backend, tt.status, got)
+		}
+		if got := combined.Weight(tt.backend); got != tt.weight {
+			t.Errorf("%s: expected weight %.1f, got %.1f", tt.backend, tt.weight, got)
+		}
+		if got := combined.IsHealthy(tt.backend); got != tt.healthy {
+			t.Errorf("%s: expected IsHealthy=%v, got %v", tt.backend, tt.healthy, got)
+		}
+	}
+}
+
 // --- Healthy Pool ---
 
 func TestHealthyPoolFiltersUnhealthy(t *testing.T) {
@@ -290,6 +661,7 @@ func TestHealthyPoolFiltersUnhealthy(t *testing.T) {
 
 	combined := NewCombined(active, passive)
 	pool := NewHealthyPool(backends, combined)
+	defer pool.Close()
 
 	// Wait for health checks
 	time.Sleep(200 * time.Millisecond)
@@ -323,6 +695,7 @@ func TestHealthyPoolAllUnhealthyFailOpen(t *testing.T) {
 
 	combined := NewCombined(active, passive)
 	pool := NewHealthyPool(backends, combined)
+	defer pool.Close()
 
 	time.Sleep(200 * time.Millisecond)
 
@@ -353,6 +726,7 @@ func TestHealthyPoolAllUnhealthyFailClosed(t *testing.T) {
 
 	combined := NewCombined(active, passive)
 	pool := NewHealthyPool(backends, combined)
+	defer pool.Close()
 
 	time.Sleep(200 * time.Millisecond)
 
@@ -360,4 +734,456 @@ func TestHealthyPoolAllUnhealthyFailClosed(t *testing.T) {
 	if err != ErrAllBackendsUnhealthy {
 		t.Fatalf("expected ErrAllBackendsUnhealthy, got %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestHealthyPoolFailMode(t *testing.T) {
+	backends := []string{"http://127.0.0.1:1", "http://127.0.0.1:2"}
+
+	active := NewActiveChecker(backends, Config{
+		Interval:           50 * time.Millisecond,
+		Timeout:            100 * time.Millisecond,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 1,
+	})
+	defer active.Close()
+	combined := NewCombined(active, NewPassiveChecker(PassiveConfig{
+		WindowSize:     10 * time.Second,
+		ErrorThreshold: 0.5,
+		MinRequests:    100,
+	}))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for combined.IsHealthy(backends[0]) || combined.IsHealthy(backends[1]) {
+		if time.Now().After(deadline) {
+			t.Fatalf("backends never marked unhealthy: %v", active.AllStatus())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	open := NewHealthyPoolWithConfig(backends, combined, PoolConfig{FailMode: FailOpen})
+	defer open.Close()
+	if healthy := open.Healthy(); len(healthy) != 2 {
+		t.Fatalf("fail-open: expected all backends, got %v", healthy)
+	}
+
+	closed := NewHealthyPoolWithConfig(backends, combined, PoolConfig{FailMode: FailClosed})
+	defer closed.Close()
+	if healthy := closed.Healthy(); len(healthy) != 0 {
+		t.Fatalf("fail-closed: expected no backends, got %v", healthy)
+	}
+	if _, err := closed.HealthyOrError(); err != ErrAllBackendsUnhealthy {
+		t.Fatalf("fail-closed: expected ErrAllBackendsUnhealthy, got %v", err)
+	}
+}
+
+// newIdlePool builds a pool whose active checker probes once at startup and
+// never again, so every backend stays StatusUnknown (healthy) for the test.
+func newIdlePool(t *testing.T, backends []string) *HealthyPool {
+	t.Helper()
+	active := NewActiveChecker(backends, Config{
+		Interval:           time.Hour,
+		Timeout:            100 * time.Millisecond,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	})
+	t.Cleanup(active.Close)
+	passive := NewPassiveChecker(PassiveConfig{
+		WindowSize:     10 * time.Second,
+		ErrorThreshold: 0.5,
+		MinRequests:    100,
+	})
+	pool := NewHealthyPool(backends, NewCombined(active, passive))
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestHealthyPoolCachedSetFollowsStatusFlip(t *testing.T) {
+	a, b := "http://127.0.0.1:1", "http://127.0.0.1:2"
+	active := NewActiveChecker([]string{a, b}, Config{
+		Interval:           time.Hour,
+		Timeout:            100 * time.Millisecond,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	})
+	defer active.Close()
+	passive := NewPassiveChecker(PassiveConfig{
+		WindowSize:     10 * time.Second,
+		ErrorThreshold: 0.5,
+		MinRequests:    1,
+	})
+	const refresh = 50 * time.Millisecond
+	pool := NewHealthyPoolWithConfig([]string{a, b}, NewCombined(active, passive), PoolConfig{RefreshInterval: refresh})
+	defer pool.Close()
+
+	if healthy := pool.Healthy(); len(healthy) != 2 {
+		t.Fatalf("expected both backends healthy, got %v", healthy)
+	}
+
+	passive.RecordFailure(a) // a is now unhealthy
+	flipped := time.Now()
+	for {
+		healthy := pool.Healthy()
+		if len(healthy) == 1 && healthy[0] == b {
+			break
+		}
+		// One interval, plus slack for a loaded test machine
+		if time.Since(flipped) > refresh+25*time.Millisecond {
+			t.Fatalf("cached set not updated within one refresh interval: %v", healthy)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHealthyPoolHealthyReturnsCopy(t *testing.T) {
+	a, b := "http://127.0.0.1:1", "http://127.0.0.1:2"
+	pool := newIdlePool(t, []string{a, b})
+
+	healthy := pool.Healthy()
+	healthy[0] = "http://evil:1"
+	if got := pool.Healthy(); got[0] != a {
+		t.Fatalf("modifying the returned slice changed the pool: %v", got)
+	}
+	healthy, _ = pool.HealthyOrError()
+	healthy[0] = "http://evil:1"
+	if got, _ := pool.HealthyOrError(); got[0] != a {
+		t.Fatalf("modifying the returned slice changed the pool: %v", got)
+	}
+}
+
+func TestHealthyPoolStartsNoGoroutine(t *testing.T) {
+	backends := []string{"http://127.0.0.1:1"}
+	combined := NewCombined(NewActiveChecker(backends, Config{
+		Interval:           time.Hour,
+		Timeout:            100 * time.Millisecond,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	}), NewPassiveChecker(PassiveConfig{WindowSize: 10 * time.Second, ErrorThreshold: 0.5, MinRequests: 100}))
+	defer combined.active.Close()
+
+	before := runtime.NumGoroutine()
+	for range 50 {
+		NewHealthyPool(backends, combined) // never closed
+	}
+	if after := runtime.NumGoroutine(); after-before >= 50 {
+		t.Fatalf("expected pools without BackgroundRefresh to start no goroutines, went from %d to %d", before, after)
+	}
+}
+
+func TestHealthyPoolDrainWaitsForInFlight(t *testing.T) {
+	a, b := "http://127.0.0.1:1", "http://127.0.0.1:2"
+	pool := newIdlePool(t, []string{a, b})
+
+	pool.Begin(a) // one outstanding request
+	done := pool.Drain(a, 5*time.Second)
+
+	// New requests stop going to a immediately...
+	if healthy := pool.Healthy(); len(healthy) != 1 || healthy[0] != b {
+		t.Fatalf("draining backend should leave rotation, got %v", healthy)
+	}
+	// ...but it isn't removed while the request is still running
+	select {
+	case <-done:
+		t.Fatal("drain finished with a request still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(pool.All()) != 2 {
+		t.Fatalf("backend removed before its request finished: %v", pool.All())
+	}
+
+	pool.Done(a)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("drain should finish once in-flight reaches zero")
+	}
+	if all := pool.All(); len(all) != 1 || all[0] != b {
+		t.Fatalf("expected only %s left, got %v", b, all)
+	}
+}
+
+func TestHealthyPoolDrainTimeout(t *testing.T) {
+	a, b := "http://127.0.0.1:1", "http://127.0.0.1:2"
+	pool := newIdlePool(t, []string{a, b})
+
+	pool.Begin(a) // never finishes
+	select {
+	case <-pool.Drain(a, 50*time.Millisecond):
+	case <-time.After(time.Second):
+		t.Fatal("drain should give up after the timeout")
+	}
+	if len(pool.All()) != 1 {
+		t.Fatalf("expected backend removed after timeout, got %v", pool.All())
+	}
+}
+
+func TestHealthyPoolReportsHealthyCount(t *testing.T) {
+	backends := []string{"http://127.0.0.1:1", "http://127.0.0.1:2", "http://127.0.0.1:3"}
+	active := NewActiveChecker(backends, Config{
+		Interval:           time.Hour,
+		Timeout:            100 * time.Millisecond,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	})
+	defer active.Close()
+	passive := NewPassiveChecker(PassiveConfig{
+		WindowSize:     10 * time.Second,
+		ErrorThreshold: 0.5,
+		MinRequests:    1,
+	})
+	m := observe.NewMetrics(prometheus.NewRegistry())
+	pool := NewHealthyPoolWithConfig(backends, NewCombined(active, passive), PoolConfig{
+		RefreshInterval:   20 * time.Millisecond,
+		BackgroundRefresh: true,
+		Name:              "users",
+		OnRefresh:         m.RecordHealthyBackends,
+	})
+	defer pool.Close()
+	gauge := m.HealthyBackends.WithLabelValues("users")
+
+	if got := testutil.ToFloat64(gauge); got != 3 {
+		t.Fatalf("expected 3 healthy backends, got %v", got)
+	}
+
+	passive.RecordFailure(backends[1])
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(gauge) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected gauge to drop to 2, got %v", testutil.ToFloat64(gauge))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The gauge counts healthy backends, not the fail-open fallback
+	passive.RecordFailure(backends[0])
+	passive.RecordFailure(backends[2])
+	deadline = time.Now().Add(time.Second)
+	for testutil.ToFloat64(gauge) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected gauge 0 with every backend down, got %v", testutil.ToFloat64(gauge))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(pool.Healthy()) != 3 {
+		t.Fatalf("fail-open should still serve all backends, got %v", pool.Healthy())
+	}
+}
+
+func TestHealthyPoolRemoveForgetsPassiveHistory(t *testing.T) {
+	backends := []string{"http://127.0.0.1:1", "http://127.0.0.1:2"}
+	active := NewActiveChecker(backends, Config{
+		Interval:           time.Hour,
+		Timeout:            100 * time.Millisecond,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	})
+	defer active.Close()
+	passive := NewPassiveChecker(PassiveConfig{
+		WindowSize:     10 * time.Second,
+		ErrorThreshold: 0.5,
+		MinRequests:    2,
+	})
+	pool := NewHealthyPool(backends, NewCombined(active, passive))
+	defer pool.Close()
+
+	passive.RecordFailure(backends[1])
+	passive.RecordFailure(backends[1])
+	if passive.IsHealthy(backends[1]) {
+		t.Fatal("expected failures to mark the backend unhealthy")
+	}
+
+	pool.RemoveBackend(backends[1])
+	if rate := passive.ErrorRate(backends[1]); rate != 0 {
+		t.Fatalf("expected passive history forgotten on removal, got error rate %v", rate)
+	}
+	if _, probed := active.AllStatus()[backends[1]]; probed {
+		t.Fatal("expected removed backend to no longer be probed")
+	}
+
+	// Re-added, it starts with a clean slate rather than the old failures
+	pool.AddBackend(backends[1])
+	if !slices.Contains(pool.Healthy(), backends[1]) {
+		t.Fatalf("expected re-added backend in the healthy set, got %v", pool.Healthy())
+	}
+	passive.RecordFailure(backends[1])
+	if !passive.IsHealthy(backends[1]) {
+		t.Fatal("one new failure is below MinRequests; old failures must not count")
+	}
+}
+
+func BenchmarkHealthyPoolHealthy(b *testing.B) {
+	backends := make([]string, 500)
+	for i := range backends {
+		backends[i] = fmt.Sprintf("http://127.0.0.1:%d", 20000+i)
+	}
+	active := NewActiveChecker(backends, Config{
+		Interval:           time.Hour,
+		Timeout:            100 * time.Millisecond,
+		HealthPath:         "/",
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	})
+	defer active.Close()
+	passive := NewPassiveChecker(PassiveConfig{
+		WindowSize:     10 * time.Second,
+		ErrorThreshold: 0.5,
+		MinRequests:    100,
+	})
+	pool := NewHealthyPool(backends, NewCombined(active, passive))
+	defer pool.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if len(pool.Healthy()) == 0 {
+				b.Fatal("empty healthy set")
+			}
+		}
+	})
+}
+
+// --- Synthetic Checks ---
+
+func TestSyntheticCheckSuccess(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/canary" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	results := make(chan SyntheticResult, 10)
+	sc := NewSyntheticChecker(SyntheticConfig{
+		Name:     "canary",
+		Target:   gateway.URL + "/canary",
+		Interval: time.Hour,
+		Timeout:  time.Second,
+		OnResult: func(r SyntheticResult) { results <- r },
+	})
+	defer sc.Close()
+
+	select {
+	case res := <-results:
+		if !res.OK {
+			t.Fatalf("expected success, got failure: %s", res.Reason)
+		}
+		if res.Status != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", res.Status)
+		}
+		if res.Latency <= 0 {
+			t.Fatal("latency should be recorded")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("synthetic check never ran")
+	}
+
+	if !sc.Last().OK {
+		t.Fatal("Last() should report the successful run")
+	}
+}
+
+func TestSyntheticCheckFailureReason(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer gateway.Close()
+
+	results := make(chan SyntheticResult, 10)
+	sc := NewSyntheticChecker(SyntheticConfig{
+		Name:     "canary",
+		Target:   gateway.URL + "/canary",
+		Interval: time.Hour,
+		Timeout:  time.Second,
+		OnResult: func(r SyntheticResult) { results <- r },
+	})
+	defer sc.Close()
+
+	select {
+	case res := <-results:
+		if res.OK {
+			t.Fatal("expected failure for 502 response")
+		}
+		if !strings.Contains(res.Reason, "unexpected status 502") {
+			t.Fatalf("reason should mention the status, got %q", res.Reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("synthetic check never ran")
+	}
+
+	rec := httptest.NewRecorder()
+	SyntheticStatusHandler(sc).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/synthetic", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status endpoint should return 503 on failing check, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "unexpected status 502") {
+		t.Fatalf("status endpoint should include the failure reason, got %s", rec.Body.String())
+	}
+}
+
+func TestSyntheticCheckDefaultsInterval(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer gateway.Close()
+
+	// A zero Interval would panic time.NewTicker in the background goroutine
+	results := make(chan SyntheticResult, 10)
+	sc := NewSyntheticChecker(SyntheticConfig{
+		Name:     "canary",
+		Target:   gateway.URL,
+		Timeout:  time.Second,
+		OnResult: func(r SyntheticResult) { results <- r },
+	})
+	defer sc.Close()
+
+	select {
+	case res := <-results:
+		if !res.OK {
+			t.Fatalf("expected success, got failure: %s", res.Reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("synthetic check never ran")
+	}
+}
+
+func TestSyntheticCheckNoResultsAfterClose(t *testing.T) {
+	started := make(chan struct{}, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer gateway.Close()
+
+	var closed atomic.Bool
+	sc := NewSyntheticChecker(SyntheticConfig{
+		Name:     "canary",
+		Target:   gateway.URL,
+		Interval: time.Hour,
+		Timeout:  5 * time.Second,
+		OnResult: func(SyntheticResult) {
+			if closed.Load() {
+				t.Error("OnResult called after Close returned")
+			}
+		},
+	})
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("synthetic check never ran")
+	}
+	sc.Close()
+	closed.Store(true)
+	time.Sleep(50 * time.Millisecond)
+}
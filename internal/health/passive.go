@@ -1,6 +1,8 @@
 package health
 
 import (
+	"math"
+	"slices"
 	"sync"
 	"time"
 )
@@ -11,10 +13,17 @@ type requestOutcome struct {
 	success   bool
 }
 
+// latencySample tracks a single request's backend latency.
+type latencySample struct {
+	timestamp time.Time
+	latency   time.Duration
+}
+
 // passiveBackend tracks passive health metrics for one backend.
 type passiveBackend struct {
-	mu       sync.Mutex
-	outcomes []requestOutcome
+	mu        sync.Mutex
+	outcomes  []requestOutcome
+	latencies []latencySample
 }
 
 // PassiveChecker infers backend health from real traffic patterns.
@@ -22,9 +31,11 @@ type PassiveChecker struct {
 	mu       sync.RWMutex
 	backends map[string]*passiveBackend
 
-	windowSize       time.Duration // how far back to look
-	errorThreshold   float64       // e.g., 0.5 = 50% error rate triggers unhealthy
-	minRequests      int           // minimum requests in window before judging
+	windowSize        time.Duration // how far back to look
+	errorThreshold    float64       // e.g., 0.5 = 50% error rate triggers unhealthy
+	minRequests       int           // minimum requests in window before judging
+	latencyThreshold  time.Duration // p95 above this triggers unhealthy; 0 = off
+	degradedThreshold float64       // error rate that triggers degraded; 0 = off
 }
 
 // PassiveConfig holds passive health check configuration.
@@ -32,15 +43,27 @@ type PassiveConfig struct {
 	WindowSize     time.Duration // e.g., 30s
 	ErrorThreshold float64       // e.g., 0.5 (50%)
 	MinRequests    int           // e.g., 10
+
+	// LatencyThreshold marks a backend unhealthy when its p95 latency over
+	// the window exceeds it ("up but slow"). Needs MinRequests samples
+	// recorded via RecordLatency. Zero disables the latency check.
+	LatencyThreshold time.Duration
+
+	// DegradedThreshold is an error rate, below ErrorThreshold, at which a
+	// backend is StatusDegraded: still in rotation, but at reduced weight
+	// (see CombinedChecker.Weight). Zero disables the degraded band.
+	DegradedThreshold float64
 }
 
 // NewPassiveChecker creates a passive health checker.
 func NewPassiveChecker(cfg PassiveConfig) *PassiveChecker {
 	return &PassiveChecker{
-		backends:       make(map[string]*passiveBackend),
-		windowSize:     cfg.WindowSize,
-		errorThreshold: cfg.ErrorThreshold,
-		minRequests:    cfg.MinRequests,
+		backends:          make(map[string]*passiveBackend),
+		windowSize:        cfg.WindowSize,
+		errorThreshold:    cfg.ErrorThreshold,
+		minRequests:       cfg.MinRequests,
+		latencyThreshold:  cfg.LatencyThreshold,
+		degradedThreshold: cfg.DegradedThreshold,
 	}
 }
 
@@ -54,6 +77,18 @@ func (pc *PassiveChecker) RecordFailure(backend string) {
 	pc.record(backend, false)
 }
 
+// RecordLatency records how long a request to backend took.
+func (pc *PassiveChecker) RecordLatency(backend string, d time.Duration) {
+	pb := pc.getOrCreate(backend)
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	now := time.Now()
+	pb.latencies = append(pb.latencies, latencySample{timestamp: now, latency: d})
+	pb.trimLatencies(now.Add(-pc.windowSize))
+}
+
 // record adds an outcome to the sliding window.
 func (pc *PassiveChecker) record(backend string, success bool) {
 	pb := pc.getOrCreate(backend)
@@ -76,14 +111,31 @@ func (pc *PassiveChecker) record(backend string, success bool) {
 	pb.outcomes = pb.outcomes[i:]
 }
 
+// Remove forgets everything recorded for backend, so a backend that is
+// removed and later re-added starts with a clean window. A request still
+// in flight when it is removed may record once more and recreate it.
+func (pc *PassiveChecker) Remove(backend string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	delete(pc.backends, backend)
+}
+
 // IsHealthy returns true if the backend's error rate is below threshold.
+// A degraded backend still counts as healthy.
 func (pc *PassiveChecker) IsHealthy(backend string) bool {
+	return pc.Status(backend) != StatusUnhealthy
+}
+
+// Status classifies the backend from its recent traffic: StatusUnhealthy at
+// or above ErrorThreshold (or over LatencyThreshold), StatusDegraded at or
+// above DegradedThreshold, StatusHealthy otherwise or without enough data.
+func (pc *PassiveChecker) Status(backend string) Status {
 	pc.mu.RLock()
 	pb, exists := pc.backends[backend]
 	pc.mu.RUnlock()
 
 	if !exists {
-		return true // no data = assume healthy
+		return StatusHealthy // no data = assume healthy
 	}
 
 	pb.mu.Lock()
@@ -98,8 +150,15 @@ func (pc *PassiveChecker) IsHealthy(backend string) bool {
 	}
 	pb.outcomes = pb.outcomes[i:]
 
+	if pc.latencyThreshold > 0 {
+		pb.trimLatencies(cutoff)
+		if len(pb.latencies) >= pc.minRequests && pb.percentile(0.95) > pc.latencyThreshold {
+			return StatusUnhealthy // up but slow
+		}
+	}
+
 	if len(pb.outcomes) < pc.minRequests {
-		return true // not enough data
+		return StatusHealthy // not enough data
 	}
 
 	failures := 0
@@ -110,7 +169,14 @@ func (pc *PassiveChecker) IsHealthy(backend string) bool {
 	}
 
 	errorRate := float64(failures) / float64(len(pb.outcomes))
-	return errorRate < pc.errorThreshold
+	switch {
+	case errorRate >= pc.errorThreshold:
+		return StatusUnhealthy
+	case pc.degradedThreshold > 0 && errorRate >= pc.degradedThreshold:
+		return StatusDegraded
+	default:
+		return StatusHealthy
+	}
 }
 
 // ErrorRate returns the current error rate for a backend (for monitoring).
@@ -139,6 +205,75 @@ func (pc *PassiveChecker) ErrorRate(backend string) float64 {
 	return float64(failures) / float64(len(pb.outcomes))
 }
 
+// AverageLatency returns the mean latency over the window (0 with no samples).
+func (pc *PassiveChecker) AverageLatency(backend string) time.Duration {
+	pb := pc.lookupTrimmed(backend)
+	if pb == nil {
+		return 0
+	}
+	defer pb.mu.Unlock()
+
+	if len(pb.latencies) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, s := range pb.latencies {
+		total += s.latency
+	}
+	return total / time.Duration(len(pb.latencies))
+}
+
+// P95Latency returns the 95th percentile latency over the window
+// (0 with no samples).
+func (pc *PassiveChecker) P95Latency(backend string) time.Duration {
+	pb := pc.lookupTrimmed(backend)
+	if pb == nil {
+		return 0
+	}
+	defer pb.mu.Unlock()
+	return pb.percentile(0.95)
+}
+
+// lookupTrimmed returns the backend with its latency window trimmed and
+// pb.mu held, or nil if the backend has no data.
+func (pc *PassiveChecker) lookupTrimmed(backend string) *passiveBackend {
+	pc.mu.RLock()
+	pb, exists := pc.backends[backend]
+	pc.mu.RUnlock()
+
+	if !exists {
+		return nil
+	}
+	pb.mu.Lock()
+	pb.trimLatencies(time.Now().Add(-pc.windowSize))
+	return pb
+}
+
+// trimLatencies drops latency samples older than cutoff. Caller holds pb.mu.
+func (pb *passiveBackend) trimLatencies(cutoff time.Time) {
+	i := 0
+	for i < len(pb.latencies) && pb.latencies[i].timestamp.Before(cutoff) {
+		i++
+	}
+	pb.latencies = pb.latencies[i:]
+}
+
+// percentile returns the q-th quantile (nearest rank) of the latency
+// samples, or 0 if there are none. Caller holds pb.mu.
+func (pb *passiveBackend) percentile(q float64) time.Duration {
+	if len(pb.latencies) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(pb.latencies))
+	for i, s := range pb.latencies {
+		sorted[i] = s.latency
+	}
+	slices.Sort(sorted)
+
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
 // getOrCreate returns the passive backend, creating it if needed.
 func (pc *PassiveChecker) getOrCreate(backend string) *passiveBackend {
 	pc.mu.RLock()
@@ -160,4 +295,4 @@ func (pc *PassiveChecker) getOrCreate(backend string) *passiveBackend {
 	pb = &passiveBackend{}
 	pc.backends[backend] = pb
 	return pb
-}
\ No newline at end of file
+}
@@ -2,7 +2,10 @@ package health
 
 import (
 	"errors"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -10,60 +13,201 @@ var (
 	ErrAllBackendsUnhealthy = errors.New("all backends are unhealthy")
 )
 
+// FailMode is what a HealthyPool serves when every backend is unhealthy.
+type FailMode int
+
+const (
+	// FailOpen serves all backends, on the theory that the health checks
+	// are more likely wrong than every backend down at once.
+	FailOpen FailMode = iota
+
+	// FailClosed serves none, so requests get a 503 instead of being sent
+	// to a pool that is known to be dead.
+	FailClosed
+)
+
+// DefaultPoolRefresh is how often a HealthyPool recomputes its healthy set.
+const DefaultPoolRefresh = 100 * time.Millisecond
+
+// PoolConfig configures NewHealthyPoolWithConfig.
+type PoolConfig struct {
+	FailMode FailMode // default FailOpen
+
+	// RefreshInterval is how long a computed healthy set is reused before
+	// the next read recomputes it from the checker; status changes show up
+	// in Healthy within one interval. Default DefaultPoolRefresh.
+	RefreshInterval time.Duration
+
+	// BackgroundRefresh also recomputes the set every RefreshInterval on a
+	// goroutine, so OnRefresh keeps reporting while the pool sees no
+	// traffic. Stop it with Close.
+	BackgroundRefresh bool
+
+	// Name identifies the pool (e.g. its route) to OnRefresh.
+	Name string
+
+	// OnRefresh, if set, is called after every refresh with the number of
+	// healthy backends, not counting the FailOpen fallback, e.g. to feed
+	// gateway_healthy_backends via observe.Metrics.RecordHealthyBackends
+	// (with BackgroundRefresh, so an idle pool's gauge stays current).
+	OnRefresh func(pool string, healthy int)
+}
+
 // HealthyPool manages a pool of backends, filtering out unhealthy ones.
+//
+// It is also a balancer (lb.Balancer): Next picks round robin from Healthy
+// and counts the request as in flight until Done, which gateway.Gateway
+// calls when the request ends. Those counts are what Drain waits on.
+//
+// The healthy set is cached for RefreshInterval (and recomputed right away
+// on AddBackend, RemoveBackend, and Drain), so between refreshes a read is
+// a lock-free atomic load however large the pool is. The first read after
+// the interval recomputes it; readers arriving meanwhile keep the previous
+// set rather than wait. The pool starts no goroutine unless
+// PoolConfig.BackgroundRefresh asks for one.
 type HealthyPool struct {
-	mu       sync.RWMutex
-	all      []string          // all configured backends
-	checker  *CombinedChecker
+	mu        sync.RWMutex
+	all       []string // all configured backends
+	checker   *CombinedChecker
+	failMode  FailMode
+	name      string
+	onRefresh func(pool string, healthy int)
+	inflight  map[string]*atomic.Int64 // requests in progress, see Begin/Done
+	draining  map[string]chan struct{} // signalled when a draining backend goes idle
+
+	next atomic.Uint64 // round robin position for Next
+
+	view      atomic.Pointer[poolView]
+	interval  time.Duration
+	refreshMu sync.Mutex // orders refreshes so a stale one can't overwrite a newer one
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// poolView is a precomputed healthy set.
+type poolView struct {
+	healthy []string  // healthy, non-draining backends
+	serve   []string  // what Healthy returns: healthy, or the FailMode fallback
+	at      time.Time // when it was computed
 }
 
 // NewHealthyPool creates a pool that filters backends based on health checks.
+// It fails open; use NewHealthyPoolWithConfig to fail closed.
 func NewHealthyPool(backends []string, checker *CombinedChecker) *HealthyPool {
-	return &HealthyPool{
-		all:     backends,
-		checker: checker,
+	return NewHealthyPoolWithConfig(backends, checker, PoolConfig{})
+}
+
+// NewHealthyPoolWithConfig creates a pool with the given fail mode and
+// refresh interval.
+func NewHealthyPoolWithConfig(backends []string, checker *CombinedChecker, cfg PoolConfig) *HealthyPool {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultPoolRefresh
+	}
+	hp := &HealthyPool{
+		all:       backends,
+		checker:   checker,
+		failMode:  cfg.FailMode,
+		name:      cfg.Name,
+		onRefresh: cfg.OnRefresh,
+		inflight:  make(map[string]*atomic.Int64),
+		draining:  make(map[string]chan struct{}),
+		interval:  cfg.RefreshInterval,
+		stop:      make(chan struct{}),
 	}
+	hp.refresh()
+	if cfg.BackgroundRefresh {
+		go hp.run(cfg.RefreshInterval)
+	}
+	return hp
 }
 
-// Healthy returns a slice of currently healthy backends.
-// Returns all backends if all are unhealthy (fail-open strategy).
+// Healthy returns a copy of the currently healthy backends. If all are
+// unhealthy it returns all backends under FailOpen, and none under
+// FailClosed, so the proxy answers 503.
 func (hp *HealthyPool) Healthy() []string {
-	hp.mu.RLock()
-	defer hp.mu.RUnlock()
+	return slices.Clone(hp.current().serve)
+}
 
-	healthy := make([]string, 0, len(hp.all))
-	for _, backend := range hp.all {
-		if hp.checker.IsHealthy(backend) {
-			healthy = append(healthy, backend)
-		}
+// HealthyOrError returns a copy of the healthy backends, or an error if
+// none are healthy, regardless of the pool's FailMode.
+func (hp *HealthyPool) HealthyOrError() ([]string, error) {
+	healthy := hp.current().healthy
+	if len(healthy) == 0 {
+		return nil, ErrAllBackendsUnhealthy
 	}
+	return slices.Clone(healthy), nil
+}
 
-	// Fail-open: if all unhealthy, return all (maybe health checks are wrong)
-	if len(healthy) == 0 {
-		return append([]string(nil), hp.all...) // return copy
+// current returns the cached healthy set, recomputing it first if it is
+// older than the refresh interval and no other refresh is under way.
+func (hp *HealthyPool) current() *poolView {
+	v := hp.view.Load()
+	if time.Since(v.at) < hp.interval || !hp.refreshMu.TryLock() {
+		return v
+	}
+	defer hp.refreshMu.Unlock()
+	if v = hp.view.Load(); time.Since(v.at) < hp.interval {
+		return v // refreshed while we took the lock
 	}
+	return hp.refreshLocked()
+}
 
-	return healthy
+// Close stops the background refresh, if any. Safe to call more than once.
+func (hp *HealthyPool) Close() {
+	hp.closeOnce.Do(func() { close(hp.stop) })
 }
 
-// HealthyOrError returns healthy backends or an error if none are healthy.
-// Use this if you prefer fail-closed (return error) instead of fail-open.
-func (hp *HealthyPool) HealthyOrError() ([]string, error) {
-	hp.mu.RLock()
-	defer hp.mu.RUnlock()
+// run refreshes the healthy set every interval until Close.
+func (hp *HealthyPool) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
+	for {
+		select {
+		case <-ticker.C:
+			hp.refresh()
+		case <-hp.stop:
+			return
+		}
+	}
+}
+
+// refresh recomputes the healthy set from the checker.
+func (hp *HealthyPool) refresh() {
+	hp.refreshMu.Lock()
+	defer hp.refreshMu.Unlock()
+	hp.refreshLocked()
+}
+
+// refreshLocked is refresh with refreshMu held. It returns the new set.
+func (hp *HealthyPool) refreshLocked() *poolView {
+	hp.mu.RLock()
 	healthy := make([]string, 0, len(hp.all))
 	for _, backend := range hp.all {
-		if hp.checker.IsHealthy(backend) {
+		if hp.draining[backend] == nil && hp.checker.IsHealthy(backend) {
 			healthy = append(healthy, backend)
 		}
 	}
 
-	if len(healthy) == 0 {
-		return nil, ErrAllBackendsUnhealthy
+	// Fail-open: if all unhealthy, serve all (maybe health checks are wrong).
+	// Draining backends stay out either way: they're going away on purpose.
+	serve := healthy
+	if len(healthy) == 0 && hp.failMode == FailOpen {
+		serve = make([]string, 0, len(hp.all))
+		for _, backend := range hp.all {
+			if hp.draining[backend] == nil {
+				serve = append(serve, backend)
+			}
+		}
 	}
+	hp.mu.RUnlock()
 
-	return healthy, nil
+	v := &poolView{healthy: healthy, serve: serve, at: time.Now()}
+	hp.view.Store(v)
+	if hp.onRefresh != nil {
+		hp.onRefresh(hp.name, len(healthy))
+	}
+	return v
 }
 
 // All returns all backends regardless of health.
@@ -76,15 +220,16 @@ func (hp *HealthyPool) All() []string {
 // AddBackend adds a new backend to the pool.
 func (hp *HealthyPool) AddBackend(backend string) {
 	hp.mu.Lock()
-	defer hp.mu.Unlock()
 	hp.all = append(hp.all, backend)
 	hp.checker.active.AddBackend(backend)
+	hp.mu.Unlock()
+	hp.refresh()
 }
 
-// RemoveBackend removes a backend from the pool.
+// RemoveBackend removes a backend from the pool, and stops probing it and
+// forgets its passive history (see CombinedChecker.RemoveBackend).
 func (hp *HealthyPool) RemoveBackend(backend string) {
 	hp.mu.Lock()
-	defer hp.mu.Unlock()
 
 	for i, b := range hp.all {
 		if b == backend {
@@ -92,5 +237,111 @@ func (hp *HealthyPool) RemoveBackend(backend string) {
 			break
 		}
 	}
-	hp.checker.active.RemoveBackend(backend)
-}
\ No newline at end of file
+	delete(hp.inflight, backend)
+	delete(hp.draining, backend)
+	hp.checker.RemoveBackend(backend)
+	hp.mu.Unlock()
+	hp.refresh()
+}
+
+// Next picks a backend round robin from Healthy and records it as in
+// flight (see Begin), or returns "" if there is none. Call Done with the
+// backend when the request finishes; gateway.Gateway does this for any
+// route balancer with a Done method.
+func (hp *HealthyPool) Next() string {
+	healthy := hp.current().serve
+	if len(healthy) == 0 {
+		return ""
+	}
+	backend := healthy[(hp.next.Add(1)-1)%uint64(len(healthy))]
+	hp.Begin(backend)
+	return backend
+}
+
+// Begin records a request starting on backend. Pair every Begin with a
+// Done; Drain uses the count to know when a backend is idle. Next calls
+// it for you.
+func (hp *HealthyPool) Begin(backend string) {
+	hp.mu.RLock()
+	n := hp.inflight[backend]
+	hp.mu.RUnlock()
+	if n == nil {
+		hp.mu.Lock()
+		if n = hp.inflight[backend]; n == nil {
+			n = new(atomic.Int64)
+			hp.inflight[backend] = n
+		}
+		hp.mu.Unlock()
+	}
+	n.Add(1)
+}
+
+// Done records a request on backend finishing.
+func (hp *HealthyPool) Done(backend string) {
+	hp.mu.RLock()
+	n := hp.inflight[backend]
+	idle := hp.draining[backend]
+	hp.mu.RUnlock()
+	if n == nil {
+		return
+	}
+	if n.Add(-1) <= 0 && idle != nil {
+		select {
+		case idle <- struct{}{}:
+		default: // already signalled
+		}
+	}
+}
+
+// InFlight returns the number of requests in progress on backend.
+func (hp *HealthyPool) InFlight(backend string) int64 {
+	hp.mu.RLock()
+	defer hp.mu.RUnlock()
+	if n := hp.inflight[backend]; n != nil {
+		return n.Load()
+	}
+	return 0
+}
+
+// Drain takes backend out of rotation gracefully: Healthy stops returning it
+// right away, but it is only removed (as by RemoveBackend) once its
+// in-flight requests finish or timeout elapses, whichever comes first.
+// The returned channel is closed after removal. Draining an unknown or
+// already-draining backend returns a channel that closes immediately.
+func (hp *HealthyPool) Drain(backend string, timeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	hp.mu.Lock()
+	known := false
+	for _, b := range hp.all {
+		known = known || b == backend
+	}
+	if !known || hp.draining[backend] != nil {
+		hp.mu.Unlock()
+		close(done)
+		return done
+	}
+	idle := make(chan struct{}, 1)
+	hp.draining[backend] = idle
+	hp.mu.Unlock()
+	hp.refresh()
+
+	go func() {
+		defer close(done)
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+
+		// Re-check after each signal: a request picked just before Drain
+		// may still Begin afterwards.
+		for hp.InFlight(backend) > 0 {
+			select {
+			case <-idle:
+			case <-deadline.C:
+				hp.RemoveBackend(backend)
+				return
+			}
+		}
+		hp.RemoveBackend(backend)
+	}()
+	return done
+}
@@ -0,0 +1,176 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultSyntheticInterval is how often a SyntheticChecker runs when
+// SyntheticConfig.Interval is unset.
+const DefaultSyntheticInterval = 30 * time.Second
+
+// SyntheticResult is the outcome of one synthetic check run.
+type SyntheticResult struct {
+	Name      string        `json:"name"`
+	OK        bool          `json:"ok"`
+	Status    int           `json:"status,omitempty"`
+	Latency   time.Duration `json:"latency_ns"`
+	Reason    string        `json:"reason,omitempty"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// SyntheticConfig holds synthetic check configuration.
+type SyntheticConfig struct {
+	Name           string        // identifies the check in metrics and status output
+	Target         string        // full URL routed through the gateway, e.g. "http://127.0.0.1:9000/canary"
+	Method         string        // defaults to GET
+	ExpectedStatus int           // defaults to 200
+	Interval       time.Duration // how often to run; default DefaultSyntheticInterval
+	Timeout        time.Duration // per-request timeout
+
+	// OnResult is called after every run (e.g., to record Prometheus metrics),
+	// never after Close returns.
+	OnResult func(SyntheticResult)
+}
+
+// SyntheticChecker periodically sends a request through the gateway's own
+// routing/proxy path to a canary endpoint.
+//
+// Component health checks probe backends directly, so they miss breakage in
+// the gateway itself (bad route config, broken middleware, proxy bugs).
+// A synthetic check exercises the full request path end to end.
+type SyntheticChecker struct {
+	cfg    SyntheticConfig
+	client *http.Client
+
+	mu   sync.RWMutex
+	last SyntheticResult
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed when run returns
+}
+
+// NewSyntheticChecker creates and starts a synthetic checker.
+func NewSyntheticChecker(cfg SyntheticConfig) *SyntheticChecker {
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+	if cfg.ExpectedStatus == 0 {
+		cfg.ExpectedStatus = http.StatusOK
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultSyntheticInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sc := &SyntheticChecker{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		last:   SyntheticResult{Name: cfg.Name, Reason: "not run yet"},
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go sc.run()
+	return sc
+}
+
+// Last returns the result of the most recent run.
+func (sc *SyntheticChecker) Last() SyntheticResult {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.last
+}
+
+// Close stops the synthetic checker. A request in flight is cancelled, and
+// Close returns once it has exited, so OnResult isn't called afterwards.
+func (sc *SyntheticChecker) Close() {
+	sc.cancel()
+	<-sc.done
+}
+
+// run is the background goroutine that sends synthetic requests.
+func (sc *SyntheticChecker) run() {
+	defer close(sc.done)
+	ticker := time.NewTicker(sc.cfg.Interval)
+	defer ticker.Stop()
+
+	// Run immediately on startup
+	sc.check()
+
+	for {
+		select {
+		case <-ticker.C:
+			sc.check()
+		case <-sc.ctx.Done():
+			return
+		}
+	}
+}
+
+// check sends one synthetic request and records the result.
+func (sc *SyntheticChecker) check() {
+	result := SyntheticResult{Name: sc.cfg.Name}
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(sc.ctx, sc.cfg.Method, sc.cfg.Target, nil)
+	if err != nil {
+		result.Reason = fmt.Sprintf("build request: %v", err)
+	} else {
+		resp, err := sc.client.Do(req)
+		if err != nil {
+			if sc.ctx.Err() != nil {
+				return // shutting down, don't record a bogus failure
+			}
+			result.Reason = fmt.Sprintf("request failed: %v", err)
+		} else {
+			resp.Body.Close()
+			result.Status = resp.StatusCode
+			if resp.StatusCode == sc.cfg.ExpectedStatus {
+				result.OK = true
+			} else {
+				result.Reason = fmt.Sprintf("unexpected status %d, want %d", resp.StatusCode, sc.cfg.ExpectedStatus)
+			}
+		}
+	}
+
+	result.Latency = time.Since(start)
+	result.CheckedAt = time.Now()
+
+	sc.mu.Lock()
+	sc.last = result
+	sc.mu.Unlock()
+
+	if sc.cfg.OnResult != nil {
+		sc.cfg.OnResult(result)
+	}
+}
+
+// SyntheticStatusHandler serves the latest result of each checker as JSON.
+// Responds 200 if every check passed, 503 otherwise.
+func SyntheticStatusHandler(checkers ...*SyntheticChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results := make([]SyntheticResult, 0, len(checkers))
+		status := http.StatusOK
+		for _, sc := range checkers {
+			res := sc.Last()
+			if !res.OK {
+				status = http.StatusServiceUnavailable
+			}
+			results = append(results, res)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(results)
+	})
+}
@@ -0,0 +1,135 @@
+package lb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAffinityCookie is the cookie Affinity uses when none is configured.
+const DefaultAffinityCookie = "gw_affinity"
+
+// StickyBalancer is a KeyBalancer that pins clients to a backend with a
+// response cookie. After picking backend for r, the proxy calls Pin so the
+// client's next request carries the pin.
+type StickyBalancer interface {
+	KeyBalancer
+	Pin(w http.ResponseWriter, r *http.Request, backend string)
+}
+
+// AffinityConfig configures NewAffinity.
+type AffinityConfig struct {
+	Secret     []byte        // HMAC key signing the cookie; required
+	CookieName string        // default DefaultAffinityCookie
+	MaxAge     time.Duration // cookie lifetime; zero means a session cookie
+}
+
+// Affinity is cookie-based session affinity in front of another balancer.
+//
+// The cookie names the backend by a hash of its address, not its position,
+// so reordering the backend list keeps live sessions where they are. The
+// cookie is HMAC-signed against tampering. Requests without a valid cookie,
+// or whose backend has since been removed, fall back to the wrapped balancer.
+type Affinity struct {
+	fallback Balancer
+	byID     map[string]string // backend ID -> address
+	secret   []byte
+	cookie   string
+	maxAge   time.Duration
+}
+
+// NewAffinity pins clients to backends, picking new pins with fallback.
+// backends lists the addresses a cookie may name; usually the same set
+// fallback balances over. It panics on an empty Secret: anyone could sign
+// a cookie pinning themselves wherever they like.
+func NewAffinity(fallback Balancer, backends []string, cfg AffinityConfig) *Affinity {
+	if len(cfg.Secret) == 0 {
+		panic("lb: NewAffinity requires a Secret")
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = DefaultAffinityCookie
+	}
+	a := &Affinity{
+		fallback: fallback,
+		byID:     make(map[string]string, len(backends)),
+		secret:   cfg.Secret,
+		cookie:   cfg.CookieName,
+		maxAge:   cfg.MaxAge,
+	}
+	for _, b := range backends {
+		a.byID[affinityID(b)] = b
+	}
+	return a
+}
+
+// Next picks with the fallback balancer; there is no cookie to honor.
+func (a *Affinity) Next() string {
+	return a.fallback.Next()
+}
+
+// NextWithRequest returns the backend named by r's affinity cookie, or the
+// fallback's pick if the cookie is missing, forged, or names an unknown
+// backend. Satisfies KeyBalancer.
+func (a *Affinity) NextWithRequest(r *http.Request) string {
+	if backend, ok := a.pinned(r); ok {
+		return backend
+	}
+	if kb, ok := a.fallback.(KeyBalancer); ok {
+		return kb.NextWithRequest(r)
+	}
+	return a.fallback.Next()
+}
+
+// Pin sets the affinity cookie for backend on w, unless r already carries
+// a valid pin to it. Satisfies StickyBalancer.
+func (a *Affinity) Pin(w http.ResponseWriter, r *http.Request, backend string) {
+	if current, ok := a.pinned(r); ok && current == backend {
+		return
+	}
+	id := affinityID(backend)
+	cookie := &http.Cookie{
+		Name:     a.cookie,
+		Value:    id + "." + a.sign(id),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if a.maxAge > 0 {
+		cookie.MaxAge = int(a.maxAge.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
+
+// pinned returns the backend r's cookie names, if the cookie is valid and
+// the backend is still known.
+func (a *Affinity) pinned(r *http.Request) (string, bool) {
+	c, err := r.Cookie(a.cookie)
+	if err != nil {
+		return "", false
+	}
+	id, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(a.sign(id))) {
+		return "", false
+	}
+	backend, ok := a.byID[id]
+	return backend, ok
+}
+
+// sign returns the base64url HMAC-SHA256 of id.
+func (a *Affinity) sign(id string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// affinityID is a stable, order-independent ID for a backend address.
+func affinityID(addr string) string {
+	h := fnv.New64a()
+	h.Write([]byte(addr))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -3,6 +3,7 @@ package lb
 import (
 	"fmt"
 	"hash/crc32"
+	"net/http"
 	"sort"
 	"sync"
 )
@@ -20,6 +21,7 @@ type ConsistentHash struct {
 	ring     []uint32            // sorted hash values (virtual nodes)
 	nodeMap  map[uint32]string   // hash value -> backend address
 	replicas int                 // virtual nodes per backend
+	keyFunc  KeyFunc             // for NextWithRequest; ClientIPKey by default
 }
 
 // NewConsistentHash creates a hash ring with the given number of virtual nodes
@@ -28,6 +30,7 @@ func NewConsistentHash(replicas int, backends []string) *ConsistentHash {
 	ch := &ConsistentHash{
 		replicas: replicas,
 		nodeMap:  make(map[uint32]string),
+		keyFunc:  ClientIPKey,
 	}
 	for _, b := range backends {
 		ch.add(b)
@@ -56,6 +59,22 @@ func (ch *ConsistentHash) Next() string {
 	return ch.NextWithKey("")
 }
 
+// NextWithRequest hashes the request's key (see SetKeyFunc) and returns its
+// backend. Satisfies KeyBalancer.
+func (ch *ConsistentHash) NextWithRequest(r *http.Request) string {
+	ch.mu.RLock()
+	keyFunc := ch.keyFunc
+	ch.mu.RUnlock()
+	return ch.NextWithKey(keyFunc(r))
+}
+
+// SetKeyFunc changes how NextWithRequest derives the key (default ClientIPKey).
+func (ch *ConsistentHash) SetKeyFunc(fn KeyFunc) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.keyFunc = fn
+}
+
 // NextWithKey returns the backend for a specific key.
 func (ch *ConsistentHash) NextWithKey(key string) string {
 	ch.mu.RLock()
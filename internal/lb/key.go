@@ -0,0 +1,48 @@
+package lb
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// KeyBalancer is a Balancer that can pick using the request itself, so the
+// same client (or user, or tenant) keeps landing on the same backend.
+// The proxy prefers NextWithRequest when a balancer implements it.
+type KeyBalancer interface {
+	Balancer
+	NextWithRequest(r *http.Request) string
+}
+
+// KeyFunc extracts the hashing key from a request.
+type KeyFunc func(r *http.Request) string
+
+// ClientIPKey keys on the client IP from RemoteAddr (port stripped, so all
+// of a client's connections hash alike). The default for hash balancers.
+func ClientIPKey(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// HeaderKey keys on a request header, e.g. HeaderKey("X-User-ID").
+// Requests without the header share the empty key.
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// PathSegmentKey keys on the n-th path segment, counting from 0:
+// PathSegmentKey(1) on "/tenants/acme/orders" gives "acme". Paths with
+// fewer segments share the empty key.
+func PathSegmentKey(n int) KeyFunc {
+	return func(r *http.Request) string {
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if n < 0 || n >= len(segments) {
+			return ""
+		}
+		return segments[n]
+	}
+}
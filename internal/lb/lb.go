@@ -2,6 +2,8 @@ package lb
 
 import "sync/atomic"
 
+// Balancer picks a backend address for each request. Next returns "" when
+// there are no backends to pick from; callers must not dial it.
 type Balancer interface {
 	Next() string
 }
@@ -17,7 +19,26 @@ func NewRoundRobin(backends []string) *RoundRobin {
 	}
 }
 
+// Next returns the next backend in rotation, or "" if there are none.
 func (rr *RoundRobin) Next() string {
+	if len(rr.backends) == 0 {
+		return ""
+	}
 	idx := atomic.AddUint64(&rr.counter, 1)
 	return rr.backends[idx%uint64(len(rr.backends))]
-}
\ No newline at end of file
+}
+
+// NextHealthy is like Next but skips backends for which isHealthy returns
+// false, checking health at pick time rather than when a pool was filtered.
+// It advances the counter at most once per backend and returns false if
+// none is healthy.
+func (rr *RoundRobin) NextHealthy(isHealthy func(string) bool) (string, bool) {
+	n := uint64(len(rr.backends))
+	for i := uint64(0); i < n; i++ {
+		idx := atomic.AddUint64(&rr.counter, 1)
+		if b := rr.backends[idx%n]; isHealthy(b) {
+			return b, true
+		}
+	}
+	return "", false
+}
@@ -3,10 +3,33 @@ package lb
 import (
 	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
+// --- Empty Backend Sets ---
+
+func TestBalancersEmpty(t *testing.T) {
+	balancers := map[string]Balancer{
+		"RoundRobin":         NewRoundRobin(nil),
+		"WeightedRoundRobin": NewWeightedRoundRobin(nil),
+		"LeastConnections":   NewLeastConnections(nil),
+		"Random":             NewRandom(nil),
+		"WeightedRandom":     NewWeightedRandom(nil),
+		"ConsistentHash":     NewConsistentHash(150, nil),
+		"Maglev":             NewMaglev(nil, 0),
+	}
+	for name, b := range balancers {
+		if got := b.Next(); got != "" {
+			t.Errorf("%s: expected empty address with no backends, got %q", name, got)
+		}
+	}
+}
+
 // --- Round Robin ---
 
 func TestRoundRobinCycles(t *testing.T) {
@@ -67,6 +90,96 @@ func TestRoundRobinConcurrent(t *testing.T) {
 	}
 }
 
+func TestRoundRobinNextHealthy(t *testing.T) {
+	rr := NewRoundRobin([]string{"A", "B", "C", "D"})
+	onlyC := func(addr string) bool { return addr == "C" }
+
+	for i := 0; i < 10; i++ {
+		got, ok := rr.NextHealthy(onlyC)
+		if !ok || got != "C" {
+			t.Fatalf("pick %d: expected C, got %q (ok=%v)", i, got, ok)
+		}
+	}
+
+	if got, ok := rr.NextHealthy(func(string) bool { return false }); ok || got != "" {
+		t.Fatalf("expected no pick when all unhealthy, got %q (ok=%v)", got, ok)
+	}
+	if _, ok := NewRoundRobin(nil).NextHealthy(onlyC); ok {
+		t.Fatal("expected no pick with no backends")
+	}
+}
+
+// --- Random ---
+
+func TestRandomDistribution(t *testing.T) {
+	backends := []string{"A", "B", "C", "D"}
+	r := NewRandom(backends)
+	counts := map[string]int{}
+
+	const n = 40000
+	for i := 0; i < n; i++ {
+		counts[r.Next()]++
+	}
+
+	// Expect ~10000 each; 5% tolerance is > 10 standard deviations
+	for _, b := range backends {
+		if math.Abs(float64(counts[b])-n/4) > n/4*0.05 {
+			t.Errorf("%s: expected ~%d picks, got %d", b, n/4, counts[b])
+		}
+	}
+}
+
+func TestRandomConcurrent(t *testing.T) {
+	backends := []string{"A", "B", "C"}
+	r := NewRandom(backends)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counts := map[string]int{}
+
+	for i := 0; i < 300; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addr := r.Next()
+			mu.Lock()
+			counts[addr]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, b := range backends {
+		total += counts[b]
+	}
+	if total != 300 {
+		t.Fatalf("expected 300 picks of known backends, got %d (%v)", total, counts)
+	}
+}
+
+func TestWeightedRandomDistribution(t *testing.T) {
+	wr := NewWeightedRandom([]WeightedBackend{
+		{Addr: "A", Weight: 5},
+		{Addr: "B", Weight: 1},
+		{Addr: "C", Weight: 0}, // defaults to 1
+	})
+	counts := map[string]int{}
+
+	const n = 70000
+	for i := 0; i < n; i++ {
+		counts[wr.Next()]++
+	}
+
+	// Expect 5:1:1 -> 50000, 10000, 10000 within 5%
+	want := map[string]float64{"A": n * 5 / 7, "B": n / 7, "C": n / 7}
+	for addr, w := range want {
+		if math.Abs(float64(counts[addr])-w) > w*0.05 {
+			t.Errorf("%s: expected ~%.0f picks, got %d", addr, w, counts[addr])
+		}
+	}
+}
+
 // --- Weighted Round Robin ---
 
 func TestWRRDistribution(t *testing.T) {
@@ -165,6 +278,42 @@ func TestWRRConcurrent(t *testing.T) {
 	}
 }
 
+func TestWRRSetWeight(t *testing.T) {
+	wrr := NewWeightedRoundRobin([]WeightedBackend{
+		{Addr: "A", Weight: 3},
+		{Addr: "B", Weight: 1},
+	})
+
+	// count returns picks per backend over n calls
+	count := func(n int) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			counts[wrr.Next()]++
+		}
+		return counts
+	}
+
+	before := count(400)
+	if before["A"] != 300 || before["B"] != 100 {
+		t.Fatalf("before: expected 300/100, got %v", before)
+	}
+
+	// Shift weight from A to B mid-stream
+	wrr.SetWeight("A", 1)
+	wrr.SetWeight("B", 3)
+	after := count(400)
+	if after["A"] != 100 || after["B"] != 300 {
+		t.Fatalf("after: expected 100/300, got %v", after)
+	}
+
+	// Non-positive weights default to 1; unknown backends are ignored
+	wrr.SetWeight("B", 0)
+	wrr.SetWeight("nope", 10)
+	if even := count(400); even["A"] != 200 || even["B"] != 200 {
+		t.Fatalf("expected 200/200 after resetting B to 1, got %v", even)
+	}
+}
+
 // --- Least Connections ---
 
 func TestLeastConnPicksLowest(t *testing.T) {
@@ -228,6 +377,58 @@ func TestLeastConnConcurrent(t *testing.T) {
 	}
 }
 
+func TestLeastConnSlowStartRamps(t *testing.T) {
+	lc := NewLeastConnectionsWithConfig([]string{"A", "B"}, LeastConnConfig{SlowStart: 10 * time.Second})
+	clock := time.Unix(1000, 0)
+	lc.now = func() time.Time { return clock }
+
+	// share keeps 20 requests in flight and returns B's fraction of new picks
+	var inflight []string
+	share := func() float64 {
+		b := 0
+		for i := 0; i < 1000; i++ {
+			addr := lc.Next()
+			if addr == "B" {
+				b++
+			}
+			inflight = append(inflight, addr)
+			if len(inflight) > 20 {
+				lc.Done(inflight[0])
+				inflight = inflight[1:]
+			}
+		}
+		return float64(b) / 1000
+	}
+
+	lc.Recovered("B")
+	early := share()
+	clock = clock.Add(5 * time.Second)
+	mid := share()
+	clock = clock.Add(5 * time.Second)
+	full := share()
+
+	if early > 0.15 {
+		t.Errorf("just recovered: expected a small share, got %.2f", early)
+	}
+	if mid <= early || mid >= full {
+		t.Errorf("expected ramp early < mid < full, got %.2f, %.2f, %.2f", early, mid, full)
+	}
+	if math.Abs(full-0.5) > 0.05 {
+		t.Errorf("after ramp: expected ~50%% share, got %.2f", full)
+	}
+}
+
+func TestLeastConnRecoveredWithoutSlowStart(t *testing.T) {
+	lc := NewLeastConnections([]string{"A", "B"})
+	lc.Next() // A=1
+
+	// Slow start disabled: a recovered backend is picked immediately
+	lc.Recovered("B")
+	if got := lc.Next(); got != "B" {
+		t.Fatalf("expected B, got %s", got)
+	}
+}
+
 // --- Consistent Hash ---
 
 func TestConsistentHashSameKeysSameBackend(t *testing.T) {
@@ -293,4 +494,202 @@ func TestConsistentHashEmptyReturnsEmpty(t *testing.T) {
 	if got := ch.NextWithKey("anything"); got != "" {
 		t.Fatalf("expected empty string, got %s", got)
 	}
-}
\ No newline at end of file
+}
+func TestKeyFuncs(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tenants/acme/orders", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set("X-User-ID", "u-42")
+
+	if got := ClientIPKey(r); got != "203.0.113.7" {
+		t.Errorf("ClientIPKey: expected port stripped, got %q", got)
+	}
+	if got := HeaderKey("X-User-ID")(r); got != "u-42" {
+		t.Errorf("HeaderKey: got %q", got)
+	}
+	if got := PathSegmentKey(1)(r); got != "acme" {
+		t.Errorf("PathSegmentKey(1): got %q", got)
+	}
+	if got := PathSegmentKey(5)(r); got != "" {
+		t.Errorf("PathSegmentKey out of range: expected empty, got %q", got)
+	}
+}
+
+func TestConsistentHashNextWithRequest(t *testing.T) {
+	var kb KeyBalancer = NewConsistentHash(150, []string{"A", "B", "C", "D"})
+
+	// Same client IP on different ports -> same backend
+	r1 := httptest.NewRequest(http.MethodGet, "/", nil)
+	r1.RemoteAddr = "198.51.100.1:1000"
+	r2 := httptest.NewRequest(http.MethodGet, "/other", nil)
+	r2.RemoteAddr = "198.51.100.1:2000"
+	if kb.NextWithRequest(r1) != kb.NextWithRequest(r2) {
+		t.Fatal("same client IP should map to the same backend")
+	}
+
+	// Different clients spread across backends
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+		seen[kb.NextWithRequest(r)] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected clients spread over backends, all went to %v", seen)
+	}
+}
+
+func TestConsistentHashSetKeyFunc(t *testing.T) {
+	ch := NewConsistentHash(150, []string{"A", "B", "C"})
+	ch.SetKeyFunc(HeaderKey("X-User-ID"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-User-ID", "user-123")
+	if got, want := ch.NextWithRequest(r), ch.NextWithKey("user-123"); got != want {
+		t.Fatalf("expected header-keyed backend %s, got %s", want, got)
+	}
+}
+
+// --- Maglev ---
+
+func TestMaglevDistribution(t *testing.T) {
+	backends := []string{"A", "B", "C", "D", "E"}
+	m := NewMaglev(backends, 0)
+
+	// Table slots are split within one of M/N per backend
+	slots := map[int]int{}
+	for _, idx := range m.table {
+		slots[idx]++
+	}
+	for i, b := range backends {
+		if slots[i] < len(m.table)/len(backends) || slots[i] > len(m.table)/len(backends)+1 {
+			t.Errorf("%s owns %d of %d slots", b, slots[i], len(m.table))
+		}
+	}
+
+	counts := map[string]int{}
+	const n = 100000
+	for i := 0; i < n; i++ {
+		counts[m.NextWithKey(fmt.Sprintf("key-%d", i))]++
+	}
+	expected := float64(n) / float64(len(backends))
+	for _, b := range backends {
+		if deviation := math.Abs(float64(counts[b])-expected) / expected; deviation > 0.05 {
+			t.Errorf("%s: got %d (%.1f%% deviation from %d)", b, counts[b], deviation*100, int(expected))
+		}
+	}
+}
+
+func TestMaglevMinimalRemapping(t *testing.T) {
+	before := NewMaglev([]string{"A", "B", "C", "D", "E"}, 0)
+	after := NewMaglev([]string{"A", "B", "C", "D"}, 0) // E removed
+
+	moved, total := 0, 10000
+	for i := 0; i < total; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		was, now := before.NextWithKey(key), after.NextWithKey(key)
+		if was != "E" && was != now {
+			moved++ // a key that didn't need to move
+		}
+	}
+
+	// Ideally only E's ~20% move; Maglev moves a few percent more
+	if ratio := float64(moved) / float64(total); ratio > 0.05 {
+		t.Errorf("%.1f%% of keys on surviving backends were remapped", ratio*100)
+	}
+}
+
+func TestMaglevTableSizeRoundsToPrime(t *testing.T) {
+	m := NewMaglev([]string{"A", "B"}, 100)
+	if len(m.table) != 101 {
+		t.Fatalf("expected table size rounded up to prime 101, got %d", len(m.table))
+	}
+	if got := m.NextWithKey("k"); got != m.NextWithKey("k") || got == "" {
+		t.Fatalf("expected a stable backend for the same key, got %q", got)
+	}
+}
+
+// --- Cookie Affinity ---
+
+// affinityCookie runs Pin for backend and returns the cookie it set.
+func affinityCookie(t *testing.T, a *Affinity, backend string) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	a.Pin(rec, httptest.NewRequest(http.MethodGet, "/", nil), backend)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one affinity cookie, got %d", len(cookies))
+	}
+	return cookies[0]
+}
+
+func TestAffinityStableAcrossReorder(t *testing.T) {
+	secret := []byte("test-secret")
+	backends := []string{"A", "B", "C"}
+	before := NewAffinity(NewRoundRobin(backends), backends, AffinityConfig{Secret: secret})
+
+	reordered := []string{"C", "A", "B"}
+	after := NewAffinity(NewRoundRobin(reordered), reordered, AffinityConfig{Secret: secret})
+
+	for _, backend := range backends {
+		cookie := affinityCookie(t, before, backend)
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(cookie)
+			if got := after.NextWithRequest(req); got != backend {
+				t.Fatalf("cookie for %s routed to %s after reorder", backend, got)
+			}
+		}
+	}
+}
+
+func TestAffinityRequiresSecret(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewAffinity should panic without a secret")
+		}
+	}()
+	NewAffinity(NewRoundRobin([]string{"A"}), []string{"A"}, AffinityConfig{})
+}
+
+func TestAffinityFallsBackOnInvalidCookie(t *testing.T) {
+	secret := []byte("test-secret")
+	a := NewAffinity(&fixedBalancer{addr: "fallback"}, []string{"A", "B"}, AffinityConfig{Secret: secret})
+	valid := affinityCookie(t, a, "A")
+	id, _, _ := strings.Cut(valid.Value, ".")
+
+	// Removed backend: a correctly signed cookie for an address no longer listed
+	removed := NewAffinity(&fixedBalancer{addr: "x"}, []string{"A", "B", "Gone"}, AffinityConfig{Secret: secret})
+	gone := affinityCookie(t, removed, "Gone")
+	otherKey := NewAffinity(&fixedBalancer{addr: "x"}, []string{"A"}, AffinityConfig{Secret: []byte("other")})
+
+	for name, value := range map[string]string{
+		"tampered signature": id + ".AAAA",
+		"no signature":       id,
+		"garbage":            "not-a-cookie",
+		"removed backend":    gone.Value,
+		"different secret":   affinityCookie(t, otherKey, "A").Value,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: DefaultAffinityCookie, Value: value})
+		if got := a.NextWithRequest(req); got != "fallback" {
+			t.Errorf("%s: expected fallback, got %s", name, got)
+		}
+	}
+
+	// A valid pin is honored and not re-sent
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(valid)
+	if got := a.NextWithRequest(req); got != "A" {
+		t.Fatalf("valid cookie: expected A, got %s", got)
+	}
+	rec := httptest.NewRecorder()
+	a.Pin(rec, req, "A")
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("Pin should not re-send a cookie the client already has")
+	}
+}
+
+// fixedBalancer always returns addr.
+type fixedBalancer struct{ addr string }
+
+func (f *fixedBalancer) Next() string { return f.addr }
@@ -1,11 +1,19 @@
 package lb
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
+
+// minSlowStartFactor is the share of normal capacity a backend is assumed to
+// have at the very start of its slow-start ramp.
+const minSlowStartFactor = 0.1
 
 // leastConnEntry tracks active connections for a single backend.
 type leastConnEntry struct {
-	addr   string
-	active atomic.Int64
+	addr        string
+	active      atomic.Int64
+	recoveredAt atomic.Int64 // unix nanos of the last Recovered call; 0 if none
 }
 
 // LeastConnections picks the backend with the fewest active connections.
@@ -18,16 +26,31 @@ type leastConnEntry struct {
 // The caller MUST call Done() when the request completes (success or error),
 // otherwise the counter leaks and the backend appears permanently busy.
 type LeastConnections struct {
-	entries []leastConnEntry
+	entries   []leastConnEntry
+	slowStart time.Duration
+	now       func() time.Time // swapped in tests
+}
+
+// LeastConnConfig holds optional least-connections settings.
+type LeastConnConfig struct {
+	// SlowStart is how long a recovered backend takes to ramp up to its full
+	// share of traffic (see Recovered). Zero disables slow start.
+	SlowStart time.Duration
 }
 
 // NewLeastConnections creates a new least-connections balancer.
 func NewLeastConnections(backends []string) *LeastConnections {
+	return NewLeastConnectionsWithConfig(backends, LeastConnConfig{})
+}
+
+// NewLeastConnectionsWithConfig creates a least-connections balancer with
+// custom settings.
+func NewLeastConnectionsWithConfig(backends []string, cfg LeastConnConfig) *LeastConnections {
 	entries := make([]leastConnEntry, len(backends))
 	for i, addr := range backends {
 		entries[i].addr = addr
 	}
-	return &LeastConnections{entries: entries}
+	return &LeastConnections{entries: entries, slowStart: cfg.SlowStart, now: time.Now}
 }
 
 // Next returns the backend with the fewest active connections
@@ -37,13 +60,14 @@ func (lc *LeastConnections) Next() string {
 		return ""
 	}
 
+	now := lc.now()
 	bestIdx := 0
-	bestCount := lc.entries[0].active.Load()
+	bestScore := lc.score(&lc.entries[0], now)
 
 	for i := 1; i < len(lc.entries); i++ {
-		count := lc.entries[i].active.Load()
-		if count < bestCount {
-			bestCount = count
+		score := lc.score(&lc.entries[i], now)
+		if score < bestScore {
+			bestScore = score
 			bestIdx = i
 		}
 	}
@@ -52,6 +76,24 @@ func (lc *LeastConnections) Next() string {
 	return lc.entries[bestIdx].addr
 }
 
+// score is the entry's effective load. Outside slow start it's just the
+// active count. During slow start the count (plus the request being placed)
+// is divided by how far along the ramp the backend is, so a just-recovered
+// backend looks ~10x busier than it is and gradually returns to normal.
+func (lc *LeastConnections) score(e *leastConnEntry, now time.Time) float64 {
+	active := float64(e.active.Load())
+	since := e.recoveredAt.Load()
+	if lc.slowStart <= 0 || since == 0 {
+		return active
+	}
+	elapsed := now.Sub(time.Unix(0, since))
+	if elapsed >= lc.slowStart {
+		return active
+	}
+	factor := max(float64(elapsed)/float64(lc.slowStart), minSlowStartFactor)
+	return (active+1)/factor - 1
+}
+
 // Done decrements the active connection count for the given backend.
 // Must be called when a request completes (success or error).
 func (lc *LeastConnections) Done(addr string) {
@@ -62,3 +104,19 @@ func (lc *LeastConnections) Done(addr string) {
 		}
 	}
 }
+
+// Recovered starts the slow-start ramp for addr. Call it when a health
+// checker sees the backend come back (see health.Config.OnStatusChange):
+// with zero active connections it would otherwise take every new request
+// at once. No-op if slow start is disabled or addr is unknown.
+func (lc *LeastConnections) Recovered(addr string) {
+	if lc.slowStart <= 0 {
+		return
+	}
+	for i := range lc.entries {
+		if lc.entries[i].addr == addr {
+			lc.entries[i].recoveredAt.Store(lc.now().UnixNano())
+			return
+		}
+	}
+}
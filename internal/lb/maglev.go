@@ -0,0 +1,127 @@
+package lb
+
+import (
+	"hash/fnv"
+	"net/http"
+)
+
+// DefaultMaglevTableSize is the lookup table size used when none is given.
+// It must be prime; 65537 suits pools of up to a few hundred backends.
+const DefaultMaglevTableSize = 65537
+
+// Maglev maps keys to backends with Google's Maglev hashing: each backend
+// fills slots of a fixed-size prime table by walking its own permutation,
+// taking turns, so every backend owns within one slot of M/N entries.
+//
+// Compared to ConsistentHash's ring this gives near-perfect balance, and
+// when a backend is added or removed only slightly more than the ideal 1/N
+// of keys move. Backends are fixed at construction; build a new Maglev to
+// change membership. Lookups are a single hash and index, with no locking.
+type Maglev struct {
+	backends []string
+	table    []int   // slot -> index into backends
+	keyFunc  KeyFunc // for NextWithRequest
+}
+
+// NewMaglev builds a Maglev table. tableSize should be a prime well above
+// the backend count (100x is a good rule); it is rounded up to the next
+// prime if needed, and 0 means DefaultMaglevTableSize.
+func NewMaglev(backends []string, tableSize int) *Maglev {
+	if tableSize <= 0 {
+		tableSize = DefaultMaglevTableSize
+	}
+	tableSize = max(tableSize, len(backends)+1)
+	for !isPrime(tableSize) {
+		tableSize++
+	}
+
+	m := &Maglev{backends: backends, keyFunc: ClientIPKey}
+	if len(backends) > 0 {
+		m.table = maglevPopulate(backends, tableSize)
+	}
+	return m
+}
+
+// Next uses an empty key (always the same backend), like ConsistentHash.Next.
+// Use NextWithKey for consistent hashing.
+func (m *Maglev) Next() string {
+	return m.NextWithKey("")
+}
+
+// NextWithRequest returns the backend for the request's key (ClientIPKey
+// unless changed with SetKeyFunc). Satisfies KeyBalancer.
+func (m *Maglev) NextWithRequest(r *http.Request) string {
+	return m.NextWithKey(m.keyFunc(r))
+}
+
+// SetKeyFunc changes how NextWithRequest derives the key. Call it before
+// the balancer is in use; unlike lookups, it isn't safe concurrently.
+func (m *Maglev) SetKeyFunc(fn KeyFunc) {
+	m.keyFunc = fn
+}
+
+// NextWithKey returns the backend for a specific key, or "" if there are none.
+func (m *Maglev) NextWithKey(key string) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.backends[m.table[maglevHash(key)%uint64(len(m.table))]]
+}
+
+// maglevPopulate fills the lookup table. Each backend i has a permutation
+// of the slots, (offset + j*skip) mod M; in turn, each claims the next slot
+// in its permutation that's still free, until the table is full.
+func maglevPopulate(backends []string, size int) []int {
+	n := len(backends)
+	m := uint64(size)
+	offset := make([]uint64, n)
+	skip := make([]uint64, n)
+	for i, b := range backends {
+		offset[i] = maglevHash("offset:"+b) % m
+		skip[i] = maglevHash("skip:"+b)%(m-1) + 1 // never 0, so it visits every slot
+	}
+
+	table := make([]int, size)
+	for i := range table {
+		table[i] = -1
+	}
+	next := make([]uint64, n) // position in each backend's permutation
+
+	filled := 0
+	for {
+		for i := 0; i < n; i++ {
+			slot := (offset[i] + next[i]*skip[i]) % m
+			for table[slot] >= 0 {
+				next[i]++
+				slot = (offset[i] + next[i]*skip[i]) % m
+			}
+			table[slot] = i
+			next[i]++
+			filled++
+			if filled == size {
+				return table
+			}
+		}
+	}
+}
+
+// maglevHash is FNV-1a: stable across processes, so every gateway
+// instance builds the same table and routes a key the same way.
+func maglevHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// isPrime reports whether n is prime (trial division; n is a table size).
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
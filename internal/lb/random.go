@@ -0,0 +1,66 @@
+package lb
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// Random picks a backend uniformly at random. Unlike RoundRobin there is no
+// shared counter, so concurrent picks don't contend on a cache line.
+type Random struct {
+	backends []string
+}
+
+// NewRandom creates a random balancer.
+func NewRandom(backends []string) *Random {
+	return &Random{backends: backends}
+}
+
+// Next returns a random backend, or "" if there are none.
+func (r *Random) Next() string {
+	if len(r.backends) == 0 {
+		return ""
+	}
+	// The top-level math/rand/v2 functions use a per-thread source: no lock
+	return r.backends[rand.IntN(len(r.backends))]
+}
+
+// WeightedRandom picks a backend with probability proportional to its
+// weight. Picks are a binary search over precomputed cumulative weights,
+// with no per-call mutation, so it's cheaper than WeightedRoundRobin for
+// large pools (at the cost of WRR's smooth interleaving).
+type WeightedRandom struct {
+	addrs      []string
+	cumulative []int // cumulative[i] = sum of weights[0..i]
+}
+
+// NewWeightedRandom creates a weighted random balancer.
+// Backends with Weight <= 0 default to 1, as in NewWeightedRoundRobin.
+func NewWeightedRandom(backends []WeightedBackend) *WeightedRandom {
+	wr := &WeightedRandom{
+		addrs:      make([]string, len(backends)),
+		cumulative: make([]int, len(backends)),
+	}
+	total := 0
+	for i, b := range backends {
+		w := b.Weight
+		if w <= 0 {
+			w = 1
+		}
+		total += w
+		wr.addrs[i] = b.Addr
+		wr.cumulative[i] = total
+	}
+	return wr
+}
+
+// Next returns a weighted random backend, or "" if there are none.
+func (wr *WeightedRandom) Next() string {
+	if len(wr.addrs) == 0 {
+		return ""
+	}
+	draw := rand.IntN(wr.cumulative[len(wr.cumulative)-1])
+	// First backend whose cumulative weight exceeds the draw
+	idx, _ := slices.BinarySearch(wr.cumulative, draw+1)
+	return wr.addrs[idx]
+}
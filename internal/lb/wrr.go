@@ -78,4 +78,31 @@ func (wrr *WeightedRoundRobin) Next() string {
 	wrr.entries[bestIdx].currentWeight -= wrr.totalWeight
 
 	return wrr.entries[bestIdx].addr
-}
\ No newline at end of file
+}
+
+// SetWeight changes addr's weight at runtime (e.g. after autoscaling).
+// Weight <= 0 defaults to 1. No-op if addr isn't a backend.
+//
+// All current weights are reset to zero, restarting the smooth sequence.
+// Keeping them would let a backend whose weight just dropped carry its
+// accumulated credit into the new schedule and win several picks in a row.
+func (wrr *WeightedRoundRobin) SetWeight(addr string, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	for i := range wrr.entries {
+		if wrr.entries[i].addr != addr {
+			continue
+		}
+		wrr.totalWeight += weight - wrr.entries[i].weight
+		wrr.entries[i].weight = weight
+		for j := range wrr.entries {
+			wrr.entries[j].currentWeight = 0
+		}
+		return
+	}
+}
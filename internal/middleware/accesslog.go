@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clfTimeFormat is Apache's %t layout, e.g. 10/Oct/2000:13:55:36 -0700.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// CombinedLogging writes one Apache Combined Log Format line per request to
+// out, for log pipelines that expect it instead of JSON:
+//
+//	%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+//
+// %h is the client IP from RemoteAddr, %u the basic-auth user (or "-"), and
+// %b the response bytes (or "-" when none). Lines are written atomically,
+// so out need not be safe for concurrent use.
+func CombinedLogging(out io.Writer) Middleware {
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rc := NewResponseCapture(w)
+
+			next.ServeHTTP(rc, r)
+
+			host := r.RemoteAddr
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			user := "-"
+			if u, _, ok := r.BasicAuth(); ok && u != "" {
+				user = clfEscape(u)
+			}
+			size := "-"
+			if rc.Written > 0 {
+				size = strconv.FormatInt(rc.Written, 10)
+			}
+
+			line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+				host, user, start.Format(clfTimeFormat),
+				clfEscape(r.Method), clfEscape(r.RequestURI), r.Proto,
+				rc.StatusCode, size,
+				clfField(r.Referer()), clfField(r.UserAgent()),
+			)
+
+			mu.Lock()
+			io.WriteString(out, line)
+			mu.Unlock()
+		})
+	}
+}
+
+// clfField escapes a quoted header field, using "-" when it's empty.
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return clfEscape(s)
+}
+
+// clfEscape backslash-escapes quotes and non-printable characters so a
+// client can't break out of a quoted field or forge a second log line.
+func clfEscape(s string) string {
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/G1D0/Api-Gateway/internal/circuitbreaker"
+	"github.com/G1D0/Api-Gateway/internal/observe"
 )
 
 // CircuitBreaker rejects requests with 503 when the backend's circuit is open.
@@ -30,3 +31,13 @@ func CircuitBreaker(cb *circuitbreaker.PerBackend, backendFunc func(*http.Reques
 		})
 	}
 }
+
+// CircuitStateMetrics returns an OnStateChange callback for
+// circuitbreaker.Config that sets gateway_circuit_state{backend} (0 closed,
+// 1 open, 2 half-open) the moment a circuit changes state, rather than
+// whenever something polls it.
+func CircuitStateMetrics(m *observe.Metrics) func(backend string, from, to circuitbreaker.State) {
+	return func(backend string, _, to circuitbreaker.State) {
+		m.CircuitState.WithLabelValues(backend).Set(float64(to))
+	}
+}
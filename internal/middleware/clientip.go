@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/G1D0/Api-Gateway/internal/lb"
+)
+
+// ClientIPResolver returns a function giving the client IP for a gateway
+// behind trustedHops proxies (load balancers, CDNs) that each append to
+// X-Forwarded-For. The client is then the trustedHops-th entry from the
+// right; anything further left was sent by the client and can be forged.
+//
+// With trustedHops 0, X-Forwarded-For is never read and the result is the
+// RemoteAddr host, as in lb.ClientIPKey. If the header has fewer entries than
+// trustedHops, all of them came from trusted proxies and the leftmost is
+// used; if the chosen entry isn't an IP, RemoteAddr is.
+//
+// It is the gateway's one notion of the client's address: use the same
+// resolver as the rate limit key (RateLimitWithKeyFunc, RouteRateLimit),
+// for logs (LoggingConfig.ClientIP, ContextLoggerWithClientIP), and for
+// IPFilterConfig.ClientIP, so clients behind a shared LB aren't lumped
+// together as the LB's address and every component agrees who they are.
+func ClientIPResolver(trustedHops int) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if trustedHops <= 0 {
+			return lb.ClientIPKey(r)
+		}
+		xff := r.Header.Values("X-Forwarded-For")
+		if len(xff) == 0 {
+			return lb.ClientIPKey(r)
+		}
+
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		entry := strings.TrimSpace(hops[max(len(hops)-trustedHops, 0)])
+		ip, ok := parseIP(entry)
+		if !ok {
+			return lb.ClientIPKey(r) // malformed entry; don't key on garbage
+		}
+		return ip.String()
+	}
+}
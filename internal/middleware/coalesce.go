@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// CoalesceConfig configures Coalesce.
+type CoalesceConfig struct {
+	// Vary lists the request headers the backend varies responses on, as
+	// in its Vary response header (e.g. "Accept-Encoding", "Authorization").
+	// Requests that differ in any of them are never coalesced.
+	Vary []string
+}
+
+// Coalesce collapses concurrent identical GET requests into one: the
+// first runs next, and requests with the same method, path, query, and
+// Vary header values that arrive while it is in flight wait for it and
+// receive a copy of its response. This stops a cache stampede from
+// becoming N identical backend requests.
+//
+// Requests carrying credentials (Authorization or Cookie) are never
+// coalesced, and a response that sets a cookie or is marked
+// Cache-Control private or no-store is never replayed: the clients waiting
+// on it send their own requests instead. Either would hand one user's
+// personalized response or session to another. Per-request headers
+// (X-Request-ID, traceparent) aren't replayed either; each client keeps
+// its own.
+//
+// The shared request runs detached from the first client's cancellation,
+// so one client hanging up doesn't fail everyone waiting on it. Responses
+// are buffered in full; don't use it on routes that stream. Only enable
+// it where responses don't depend on anything outside the key.
+func Coalesce(cfg CoalesceConfig) Middleware {
+	var (
+		mu       sync.Mutex
+		inflight = make(map[string]*coalescedCall)
+	)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := coalesceKey(r, cfg.Vary)
+
+			mu.Lock()
+			if call, ok := inflight[key]; ok {
+				mu.Unlock()
+				select {
+				case <-call.done:
+					if call.private() {
+						next.ServeHTTP(w, r)
+						return
+					}
+					call.writeTo(w, false)
+				case <-r.Context().Done():
+					// client gave up; nothing to write
+				}
+				return
+			}
+			call := &coalescedCall{done: make(chan struct{})}
+			inflight[key] = call
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				delete(inflight, key)
+				mu.Unlock()
+				close(call.done) // on panic, waiters get 502 (call.rec is nil)
+			}()
+			rec := &coalesceRecorder{header: make(http.Header), status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(context.WithoutCancel(r.Context())))
+			call.rec = rec
+			call.writeTo(w, true)
+		})
+	}
+}
+
+// coalesceKey identifies requests that get the same response.
+func coalesceKey(r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(r.Method + " " + r.Host + r.URL.RequestURI())
+	for _, h := range vary {
+		b.WriteString("\x00" + strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// coalescedCall is a request in flight that others with its key wait on.
+type coalescedCall struct {
+	done chan struct{}
+	rec  *coalesceRecorder // set before done is closed, unless next panicked
+}
+
+// private reports whether the shared response sets a cookie or is marked
+// uncacheable for shared caches, and so belongs to the client that made it
+// only.
+func (c *coalescedCall) private() bool {
+	if c.rec == nil {
+		return false
+	}
+	if len(c.rec.header.Values("Set-Cookie")) > 0 {
+		return true
+	}
+	for _, v := range c.rec.header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if strings.EqualFold(name, "private") || strings.EqualFold(name, "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// perRequestHeaders identify the request that made a response, so a
+// replay to another client leaves them alone.
+var perRequestHeaders = []string{"X-Request-Id", "Traceparent"}
+
+// writeTo replays the shared response to one client. leader is true for
+// the client whose request produced it.
+func (c *coalescedCall) writeTo(w http.ResponseWriter, leader bool) {
+	if c.rec == nil {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+	for k, v := range c.rec.header {
+		if !leader && slices.Contains(perRequestHeaders, k) {
+			continue
+		}
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.WriteHeader(c.rec.status)
+	w.Write(c.rec.body.Bytes())
+}
+
+// coalesceRecorder buffers the shared response.
+type coalesceRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (cr *coalesceRecorder) Header() http.Header { return cr.header }
+
+func (cr *coalesceRecorder) WriteHeader(code int) {
+	if !cr.wroteHeader {
+		cr.status = code
+		cr.wroteHeader = true
+	}
+}
+
+func (cr *coalesceRecorder) Write(b []byte) (int, error) {
+	cr.wroteHeader = true
+	return cr.body.Write(b)
+}
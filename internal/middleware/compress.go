@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// Compress gzips response bodies for clients that send Accept-Encoding: gzip.
+//
+// Bodies smaller than minSize bytes are sent uncompressed (gzip overhead isn't
+// worth it), as are responses that already carry a Content-Encoding, range
+// responses (206 or Content-Range), and ones whose Content-Type is already
+// compressed (images, video, archives). 1xx responses pass straight through. The writer
+// buffers up to minSize bytes before deciding, so the decision is made once
+// per response.
+//
+// Compress can sit on either side of ResponseCapture: outside it, the capture
+// sees uncompressed byte counts; inside it, compressed ones.
+func Compress(minSize int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			if r.Method == http.MethodHead || !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, minSize: minSize}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter buffers the start of the body, then either switches to
+// gzip or flushes the buffer through unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status  int    // status passed to WriteHeader, written once decided
+	buf     []byte // body bytes held back until the decision
+	decided bool   // headers have been sent
+	gz      *gzip.Writer
+}
+
+// WriteHeader records the status; the real write is deferred until we
+// know whether to set Content-Encoding. Informational (1xx) responses such
+// as 103 Early Hints go straight through: they aren't the final status.
+func (cw *compressWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	cw.status = code
+}
+
+// Write buffers until minSize bytes are seen, then commits to a mode.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	if cw.decided {
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush commits to a mode (streaming responses can't wait for minSize)
+// and flushes both the gzip stream and the underlying writer.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide(true)
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide sends headers and the buffered bytes, compressed if large is true
+// and the response is compressible.
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	buf := cw.buf
+	cw.buf = nil
+
+	if large && cw.compressible() {
+		h := cw.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length") // original length no longer applies
+		cw.ResponseWriter.WriteHeader(cw.status)
+		cw.gz = gzip.NewWriter(cw.ResponseWriter)
+		_, err := cw.gz.Write(buf)
+		return err
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// close finishes the response once the handler returns.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			return // handler wrote nothing; net/http sends the default 200
+		}
+		cw.decide(false) // body stayed under minSize
+	}
+	if cw.gz != nil {
+		cw.gz.Close()
+	}
+}
+
+// compressible reports whether the response should be gzipped.
+func (cw *compressWriter) compressible() bool {
+	if cw.status < 200 || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false // already encoded by the backend
+	}
+	if cw.status == http.StatusPartialContent || h.Get("Content-Range") != "" {
+		return false // the range refers to the uncompressed bytes
+	}
+
+	ct := strings.ToLower(h.Get("Content-Type"))
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = strings.TrimSpace(ct[:i])
+	}
+	if ct == "image/svg+xml" {
+		return true // text-based image format
+	}
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(ct, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// incompressibleTypes are content types (or prefixes) that are already
+// compressed, or streamed, and shouldn't be gzipped.
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"text/event-stream",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+}
+
+// acceptsGzip reports whether the client's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses gzip
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok && (q == "0" || strings.Trim(q, "0.") == "") {
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDecompressedSize caps a decompressed request body when
+// DecompressRequest is given a non-positive limit.
+const DefaultMaxDecompressedSize = 10 << 20 // 10 MiB
+
+// DecompressRequest inflates request bodies sent with Content-Encoding: gzip,
+// for backends that can't. The body is forwarded as plaintext with the
+// Content-Encoding header removed and Content-Length set to the real size.
+// Other encodings pass through untouched.
+//
+// The whole decompressed body is held in memory, so maxSize guards against
+// decompression bombs: a body that inflates past it gets 413 before the
+// backend is contacted. A corrupt gzip stream gets 400.
+func DecompressRequest(maxSize int64) Middleware {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			coding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if coding != "gzip" && coding != "x-gzip" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			// Read one byte past the limit to tell "exactly maxSize" from "too big"
+			body, err := io.ReadAll(io.LimitReader(zr, maxSize+1))
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > maxSize {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body.Close()
+
+			r = r.Clone(r.Context()) // don't rewrite the caller's headers
+			r.Header.Del("Content-Encoding")
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			r.ContentLength = int64(len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorResponder renders an error response generated by the gateway itself
+// (as opposed to one relayed from a backend). code is a short
+// machine-readable reason such as "upstream_unavailable".
+//
+// Plug one into proxy.ProxyConfig to control the body and content type
+// clients see for 502/503/504 responses.
+type ErrorResponder func(w http.ResponseWriter, r *http.Request, status int, code string)
+
+// PlainError writes the lowercase status text as text/plain (e.g. "bad gateway").
+func PlainError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	http.Error(w, strings.ToLower(http.StatusText(status)), status)
+}
+
+// JSONError writes {"error": code, "trace_id": ...} as application/json.
+// The trace ID comes from the request context (see Tracing).
+func JSONError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error   string `json:"error"`
+		TraceID string `json:"trace_id,omitempty"`
+	}{code, TraceIDFrom(r.Context())})
+}
+
+// NegotiatedError picks the error format from the request's Accept header:
+// JSONError's envelope for clients that prefer application/json, a small
+// HTML page for browsers, and text/plain otherwise, including for */* and
+// no Accept header at all. All three carry the trace ID when there is one.
+// This is the proxy's default.
+func NegotiatedError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	text := strings.ToLower(http.StatusText(status))
+	traceID := TraceIDFrom(r.Context())
+
+	switch negotiate(r.Header.Values("Accept"), "text/plain", "application/json", "text/html") {
+	case "application/json":
+		JSONError(w, r, status, code)
+	case "text/html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%d %s</title></head><body><h1>%d %s</h1>",
+			status, html.EscapeString(text), status, html.EscapeString(text))
+		if traceID != "" {
+			fmt.Fprintf(w, "<p>Trace ID: <code>%s</code></p>", html.EscapeString(traceID))
+		}
+		fmt.Fprint(w, "</body></html>\n")
+	default:
+		if traceID != "" {
+			text += " (trace_id " + traceID + ")"
+		}
+		http.Error(w, text, status)
+	}
+}
+
+// negotiate returns the offer the Accept header values rank highest, by
+// q-value and then by how specifically it was named ("type/subtype" over
+// "type/*" over "*/*"). Remaining ties go to the offer the client listed
+// first, so "application/json, text/plain, */*" gets JSON; offers matched
+// by the same range, and a header that accepts none of them, go to the
+// earliest offer.
+func negotiate(accept []string, offers ...string) string {
+	best, bestQ, bestSpec, bestPos := offers[0], 0.0, -1, -1
+	for _, offer := range offers {
+		q, spec, pos := acceptQ(accept, offer)
+		if q > bestQ || q == bestQ && q > 0 && (spec > bestSpec || spec == bestSpec && pos < bestPos) {
+			best, bestQ, bestSpec, bestPos = offer, q, spec, pos
+		}
+	}
+	return best
+}
+
+// acceptQ returns the q-value the most specific matching media range in
+// accept gives offer, that specificity (2 exact, 1 type/*, 0 */*), and the
+// range's position in the header. With no Accept header everything is
+// acceptable at q=1.
+func acceptQ(accept []string, offer string) (q float64, spec, pos int) {
+	if len(accept) == 0 {
+		return 1, 0, 0
+	}
+	offerType, _, _ := strings.Cut(offer, "/")
+	spec = -1
+	i := 0
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			i++
+			mediaRange, params, _ := strings.Cut(part, ";")
+			mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+
+			s := -1
+			switch {
+			case mediaRange == offer:
+				s = 2
+			case mediaRange == offerType+"/*":
+				s = 1
+			case mediaRange == "*/*":
+				s = 0
+			}
+			if s <= spec {
+				continue
+			}
+			spec, q, pos = s, 1, i
+			for _, p := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if strings.EqualFold(k, "q") {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						q = f
+					}
+				}
+			}
+		}
+	}
+	return q, spec, pos
+}
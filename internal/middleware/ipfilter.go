@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/G1D0/Api-Gateway/internal/lb"
+)
+
+// IPFilterConfig lists the networks allowed or denied by IPFilter.
+// Entries are CIDRs ("10.0.0.0/8", "fd00::/8") or bare IPs ("192.168.1.5").
+type IPFilterConfig struct {
+	Allow []string // if non-empty, only these networks may connect
+	Deny  []string // always rejected, even if also in Allow
+
+	// ClientIP resolves the IP that is filtered, e.g. ClientIPResolver(1)
+	// behind a load balancer: pass the same resolver as rate limiting and
+	// logging so all of them agree on who the client is. Nil means the
+	// RemoteAddr host, ignoring X-Forwarded-For.
+	ClientIP func(*http.Request) string
+}
+
+// IPFilter rejects requests with 403 based on the client IP.
+// Deny takes precedence over Allow. Requests whose IP can't be parsed are
+// rejected. Returns an error if any configured entry isn't a valid IP or CIDR.
+func IPFilter(cfg IPFilterConfig) (Middleware, error) {
+	allow, err := parsePrefixes(cfg.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("ip filter allow: %w", err)
+	}
+	deny, err := parsePrefixes(cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("ip filter deny: %w", err)
+	}
+	clientIP := cfg.ClientIP
+	if clientIP == nil {
+		clientIP = lb.ClientIPKey
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, ok := parseIP(clientIP(r))
+			if !ok || containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip)) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// parseIP parses an IP with or without a port ("1.2.3.4:80", "[::1]:80",
+// "::1"). IPv4-mapped IPv6 addresses are unmapped so they match IPv4 CIDRs.
+func parseIP(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap().WithZone(""), true
+}
+
+// parsePrefixes parses CIDRs and bare IPs into prefixes.
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if strings.Contains(e, "/") {
+			p, err := netip.ParsePrefix(e)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(e)
+		if err != nil {
+			return nil, err
+		}
+		ip = ip.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// containsIP reports whether any prefix contains ip.
+func containsIP(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
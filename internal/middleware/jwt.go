@@ -0,0 +1,332 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWKSTTL is how long fetched keys are used before a refresh.
+	DefaultJWKSTTL = 5 * time.Minute
+
+	// DefaultJWKSMinRefresh is the shortest gap between fetches, so tokens
+	// with made-up kids, or a provider outage, can't hammer the provider.
+	DefaultJWKSMinRefresh = 10 * time.Second
+
+	// DefaultJWKSFetchTimeout bounds a single fetch of the key set.
+	DefaultJWKSFetchTimeout = 5 * time.Second
+)
+
+// ErrUnknownKID is returned by JWKS.Key when the provider has no key with
+// the requested ID, even after a refresh.
+var ErrUnknownKID = errors.New("jwks: unknown key id")
+
+// JWKSConfig configures NewJWKS.
+type JWKSConfig struct {
+	URL        string        // the provider's JWKS endpoint; required
+	TTL        time.Duration // default DefaultJWKSTTL
+	MinRefresh time.Duration // default DefaultJWKSMinRefresh
+	Client     *http.Client  // default a client with a 5s timeout
+
+	// FetchTimeout bounds each fetch, which runs detached from the request
+	// that triggered it. Default DefaultJWKSFetchTimeout.
+	FetchTimeout time.Duration
+}
+
+// JWKS is a cached JSON Web Key Set for providers that rotate signing keys.
+//
+// Keys are fetched on first use and refreshed once the TTL expires, or early
+// when a token names a kid the cache doesn't have (the provider rotated).
+// If a refresh fails, the previously fetched keys keep being served.
+//
+// A fetch runs detached from the request that triggered it, under its own
+// FetchTimeout: it serves every request waiting on the refresh, so one
+// client hanging up mustn't fail it and, through MinRefresh, lock the rest
+// out of new keys.
+type JWKS struct {
+	url          string
+	ttl          time.Duration
+	minRefresh   time.Duration
+	fetchTimeout time.Duration
+	client       *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetched   time.Time // last successful fetch
+	attempted time.Time // last fetch, successful or not
+
+	refreshMu sync.Mutex // one fetch at a time
+}
+
+// NewJWKS creates a key set for cfg.URL. Nothing is fetched until the
+// first Key call.
+func NewJWKS(cfg JWKSConfig) *JWKS {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultJWKSTTL
+	}
+	if cfg.MinRefresh <= 0 {
+		cfg.MinRefresh = DefaultJWKSMinRefresh
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.FetchTimeout <= 0 {
+		cfg.FetchTimeout = DefaultJWKSFetchTimeout
+	}
+	return &JWKS{
+		url:          cfg.URL,
+		ttl:          cfg.TTL,
+		minRefresh:   cfg.MinRefresh,
+		fetchTimeout: cfg.FetchTimeout,
+		client:       cfg.Client,
+	}
+}
+
+// Key returns the RSA public key with ID kid, refreshing the set if it is
+// past its TTL or doesn't contain kid.
+func (j *JWKS) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	key, found, fresh := j.lookup(kid)
+	if found && fresh {
+		return key, nil
+	}
+
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+
+	// Another caller may have refreshed while we waited
+	key, found, fresh = j.lookup(kid)
+	if found && fresh {
+		return key, nil
+	}
+	j.mu.RLock()
+	throttled := time.Since(j.attempted) < j.minRefresh
+	j.mu.RUnlock()
+	if throttled {
+		if found {
+			return key, nil // the last refresh just failed; keep serving stale
+		}
+		return nil, ErrUnknownKID
+	}
+
+	if err := j.refresh(ctx); err != nil {
+		if found {
+			return key, nil // serve stale rather than reject every token
+		}
+		return nil, err
+	}
+	if key, found, _ = j.lookup(kid); !found {
+		return nil, ErrUnknownKID
+	}
+	return key, nil
+}
+
+// lookup returns the cached key for kid and whether the cache is within TTL.
+func (j *JWKS) lookup(kid string) (key *rsa.PublicKey, found, fresh bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, found = j.keys[kid]
+	return key, found, !j.fetched.IsZero() && time.Since(j.fetched) < j.ttl
+}
+
+// refresh fetches the key set and replaces the cache on success. The
+// fetch keeps ctx's values but not its cancellation. A cancelled fetch
+// doesn't count as an attempt for MinRefresh; a failed or timed out one
+// does.
+func (j *JWKS) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), j.fetchTimeout)
+	defer cancel()
+
+	keys, err := j.fetch(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !errors.Is(err, context.Canceled) {
+		j.attempted = time.Now()
+	}
+	if err != nil {
+		return err
+	}
+	j.keys = keys
+	j.fetched = time.Now()
+	return nil
+}
+
+// jwk is the subset of RFC 7517 fields needed for RSA signature keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// fetch downloads and parses the key set, keeping RSA signing keys only.
+func (j *JWKS) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: fetch: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("jwks: decode: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			continue // skip a malformed key rather than the whole set
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// JWTConfig configures JWTAuth.
+type JWTConfig struct {
+	Keys     *JWKS         // signing keys; required
+	Issuer   string        // if set, the iss claim must match
+	Audience string        // if set, the aud claim must contain it
+	Leeway   time.Duration // clock skew allowed on exp and nbf
+}
+
+// jwtClaimsKey is the context key for verified JWT claims.
+type jwtClaimsKey struct{}
+
+// JWTClaims returns the claims of the token JWTAuth verified for this
+// request, or nil if there was none.
+func JWTClaims(ctx context.Context) map[string]any {
+	claims, _ := ctx.Value(jwtClaimsKey{}).(map[string]any)
+	return claims
+}
+
+// JWTAuth rejects requests without a valid RS256 bearer token with 401.
+// The token's kid header selects the key from cfg.Keys; other algorithms,
+// including "none" and HMAC, are refused. exp and nbf are enforced when
+// present. Verified claims are available downstream via JWTClaims.
+func JWTAuth(cfg JWTConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := verifyJWT(r.Context(), cfg, token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), jwtClaimsKey{}, claims)))
+		})
+	}
+}
+
+// verifyJWT checks token's signature and registered claims and returns
+// its claims.
+func verifyJWT(ctx context.Context, cfg JWTConfig, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jwt: malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("jwt: unsupported alg %q", header.Alg)
+	}
+
+	key, err := cfg.Keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("jwt: malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errors.New("jwt: bad signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0).Add(cfg.Leeway)) {
+		return nil, errors.New("jwt: token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("jwt: token not yet valid")
+	}
+	if cfg.Issuer != "" && claims["iss"] != cfg.Issuer {
+		return nil, errors.New("jwt: wrong issuer")
+	}
+	if cfg.Audience != "" && !hasAudience(claims["aud"], cfg.Audience) {
+		return nil, errors.New("jwt: wrong audience")
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON token segment into v.
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("jwt: malformed segment")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("jwt: malformed segment")
+	}
+	return nil
+}
+
+// hasAudience reports whether aud, a string or array of strings, contains want.
+func hasAudience(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		return slices.Contains(aud, any(want))
+	}
+	return false
+}
@@ -2,13 +2,56 @@ package middleware
 
 import (
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/observe"
 )
 
+// DefaultRedactHeaders are the headers whose values LoggingConfig masks
+// when RedactHeaders is nil.
+var DefaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// redacted replaces the value of a redacted header in logs.
+const redacted = "***"
+
+// LoggingConfig holds optional request logging settings.
+type LoggingConfig struct {
+	// LogHeaders adds the request headers to each log line.
+	LogHeaders bool
+
+	// RedactHeaders lists headers (case-insensitive) whose values are logged
+	// as "***" when LogHeaders is on. Nil means DefaultRedactHeaders; use an
+	// empty slice to log everything verbatim.
+	RedactHeaders []string
+
+	// SampleRate is the fraction (0.0-1.0) of successful (1xx-3xx) requests
+	// logged. 4xx and 5xx are always logged. 0 means log everything.
+	SampleRate float64
+
+	// ClientIP resolves the logged client_ip, e.g. ClientIPResolver(1)
+	// behind a load balancer. Nil means r.RemoteAddr.
+	ClientIP func(*http.Request) string
+}
+
 // Logging logs each request as structured JSON with method, path, status,
 // latency, client IP, and trace ID.
 func Logging(logger *slog.Logger) Middleware {
+	return LoggingWithConfig(logger, LoggingConfig{})
+}
+
+// LoggingWithConfig is like Logging with custom settings.
+func LoggingWithConfig(logger *slog.Logger, cfg LoggingConfig) Middleware {
+	if cfg.RedactHeaders == nil {
+		cfg.RedactHeaders = DefaultRedactHeaders
+	}
+	redact := make(map[string]bool, len(cfg.RedactHeaders))
+	for _, h := range cfg.RedactHeaders {
+		redact[http.CanonicalHeaderKey(h)] = true
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -16,14 +59,65 @@ func Logging(logger *slog.Logger) Middleware {
 
 			next.ServeHTTP(rc, r)
 
-			logger.Info("request completed",
+			if cfg.SampleRate > 0 && rc.StatusCode < 400 && rand.Float64() >= cfg.SampleRate {
+				return // sampled out; errors are never dropped
+			}
+
+			clientIP := r.RemoteAddr
+			if cfg.ClientIP != nil {
+				clientIP = cfg.ClientIP(r)
+			}
+			attrs := []any{
 				"method", r.Method,
 				"path", r.URL.Path,
 				"status", rc.StatusCode,
 				"latency_ms", time.Since(start).Milliseconds(),
-				"client_ip", r.RemoteAddr,
+				"client_ip", clientIP,
 				"trace_id", TraceIDFrom(r.Context()),
-			)
+			}
+			if cfg.LogHeaders {
+				attrs = append(attrs, "headers", logHeaders(r.Header, redact))
+			}
+			logger.Info("request completed", attrs...)
+		})
+	}
+}
+
+// ContextLogger puts a request-scoped logger in the context, derived from
+// base with method, path, client IP, and trace ID attached (see
+// observe.RequestLogger). Downstream code gets it with observe.LoggerFrom
+// instead of threading those fields through by hand. Place it after Tracing
+// so the trace ID is known.
+func ContextLogger(base *slog.Logger) Middleware {
+	return ContextLoggerWithClientIP(base, nil)
+}
+
+// ContextLoggerWithClientIP is ContextLogger with the client IP resolved
+// by clientIP, e.g. ClientIPResolver(1) behind a load balancer. Nil means
+// r.RemoteAddr.
+func ContextLoggerWithClientIP(base *slog.Logger, clientIP func(*http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := r.RemoteAddr
+			if clientIP != nil {
+				ip = clientIP(r)
+			}
+			logger := observe.RequestLogger(base, r.Method, r.URL.Path, ip, TraceIDFrom(r.Context()))
+			next.ServeHTTP(w, r.WithContext(observe.WithLogger(r.Context(), logger)))
 		})
 	}
 }
+
+// logHeaders flattens h for logging, masking the redacted header names
+// (canonical form).
+func logHeaders(h http.Header, redact map[string]bool) map[string]string {
+	out := make(map[string]string, len(h))
+	for key, values := range h {
+		if redact[http.CanonicalHeaderKey(key)] {
+			out[key] = redacted
+			continue
+		}
+		out[key] = strings.Join(values, ", ")
+	}
+	return out
+}
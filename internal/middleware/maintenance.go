@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaintenanceMessage is the response body when no message is configured.
+const defaultMaintenanceMessage = "The service is down for maintenance. Please try again shortly."
+
+// MaintenanceConfig configures maintenance mode.
+type MaintenanceConfig struct {
+	ExemptPaths []string      // exact paths served normally while enabled (e.g. "/healthz")
+	Message     string        // 503 response body; defaults to a generic message
+	RetryAfter  time.Duration // sent as Retry-After if > 0
+}
+
+// Maintenance answers 503 to all non-exempt traffic while enabled.
+// It can be flipped at runtime with Enable/Disable or via AdminHandler,
+// without a restart. Starts disabled.
+type Maintenance struct {
+	enabled atomic.Bool
+	exempt  map[string]bool
+	message string
+	retry   time.Duration
+}
+
+// NewMaintenance creates a disabled maintenance switch.
+func NewMaintenance(cfg MaintenanceConfig) *Maintenance {
+	m := &Maintenance{
+		exempt:  make(map[string]bool, len(cfg.ExemptPaths)),
+		message: cfg.Message,
+		retry:   cfg.RetryAfter,
+	}
+	if m.message == "" {
+		m.message = defaultMaintenanceMessage
+	}
+	for _, p := range cfg.ExemptPaths {
+		m.exempt[p] = true
+	}
+	return m
+}
+
+// Enable starts rejecting non-exempt requests.
+func (m *Maintenance) Enable() { m.enabled.Store(true) }
+
+// Disable restores normal traffic.
+func (m *Maintenance) Disable() { m.enabled.Store(false) }
+
+// Enabled reports whether maintenance mode is on.
+func (m *Maintenance) Enabled() bool { return m.enabled.Load() }
+
+// Middleware returns the middleware that enforces maintenance mode.
+func (m *Maintenance) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !m.enabled.Load() || m.exempt[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if m.retry > 0 {
+				w.Header().Set("Retry-After", fmt.Sprintf("%.0f", m.retry.Seconds()))
+			}
+			http.Error(w, m.message, http.StatusServiceUnavailable)
+		})
+	}
+}
+
+// AdminHandler flips maintenance mode over HTTP:
+//
+//	GET    -> {"enabled": bool}
+//	POST   -> enable
+//	DELETE -> disable
+//
+// POST and DELETE also respond with the new state. Mount it on the admin
+// listener, not the public one.
+func (m *Maintenance) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			m.Enable()
+		case http.MethodDelete:
+			m.Disable()
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"enabled": m.Enabled()})
+	})
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/router"
+)
+
+// noRoute labels requests that didn't match any route.
+const noRoute = "no_match"
+
+// Metrics records gateway_requests_total{service,status,method} and
+// gateway_request_duration_seconds{service,status_class} for every request, plus
+// gateway_backend_duration_seconds{backend} when the proxy reports which
+// backend served it (via observe.RequestInfo).
+//
+// serviceFunc names the service for the label; it runs after the handler
+// returns. Use RouteService to label by the matched route's pattern.
+func Metrics(m *observe.Metrics, serviceFunc func(*http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rc := NewResponseCapture(w)
+			ctx, info := observe.WithRequestInfo(r.Context())
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(rc, r)
+
+			elapsed := time.Since(start).Seconds()
+			service := serviceFunc(r)
+			m.RequestsTotal.WithLabelValues(service, strconv.Itoa(rc.StatusCode), r.Method).Inc()
+			m.RequestDuration.WithLabelValues(service, statusClass(rc.StatusCode)).Observe(elapsed)
+			if backend := info.Backend(); backend != "" {
+				m.BackendDuration.WithLabelValues(backend).Observe(elapsed)
+			}
+		})
+	}
+}
+
+// statusClass returns the status class label for code, e.g. "5xx".
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// InflightMetrics tracks gateway_inflight_requests, the number of requests
+// currently inside the handler chain. Place it outermost so the gauge
+// covers the time every other middleware spends too.
+func InflightMetrics(m *observe.Metrics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.InflightRequests.Inc()
+			defer m.InflightRequests.Dec() // even if the handler panics
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RouteService returns the configured pattern of the route stored in the
+// request context by router.WithRoute, or "no_match" if there is none.
+// The route must be in the context Metrics sees, so match before Metrics runs.
+func RouteService(r *http.Request) string {
+	if route := router.RouteFrom(r.Context()); route != nil {
+		return route.Pattern()
+	}
+	return noRoute
+}
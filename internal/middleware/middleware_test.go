@@ -2,15 +2,43 @@ package middleware
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/G1D0/Api-Gateway/internal/circuitbreaker"
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/observe"
 	"github.com/G1D0/Api-Gateway/internal/ratelimit"
+	"github.com/G1D0/Api-Gateway/internal/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // --- Chain ---
@@ -141,6 +169,72 @@ func TestTracingReusesExisting(t *testing.T) {
 	}
 }
 
+func TestTracingTraceparent(t *testing.T) {
+	var gotTraceID string
+	var forwarded http.Header
+	handler := Tracing()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceID = TraceIDFrom(r.Context())
+		forwarded = r.Header.Clone()
+	}))
+
+	// traceparent alone: its trace-id is the trace ID, and is continued
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if gotTraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the traceparent trace-id, got %s", gotTraceID)
+	}
+	if traceID, parentID, _, ok := observe.ParseTraceparent(forwarded.Get("traceparent")); !ok ||
+		traceID != gotTraceID || parentID == "00f067aa0ba902b7" {
+		t.Fatalf("expected the trace continued with a new parent-id, got %q", forwarded.Get("traceparent"))
+	}
+
+	// With X-Request-ID too, the client's ID is kept
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "client-trace-abc")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if gotTraceID != "client-trace-abc" || rec.Header().Get("X-Request-ID") != "client-trace-abc" {
+		t.Fatalf("expected the client's X-Request-ID kept, got %s", gotTraceID)
+	}
+	if traceID, _, _, _ := observe.ParseTraceparent(forwarded.Get("traceparent")); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("traceparent should keep the inbound trace-id, got %q", forwarded.Get("traceparent"))
+	}
+}
+
+func TestObserveTracingFeedsLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	// Only the observe tracing middleware runs; Logging must still see the ID
+	handler := observe.TracingMiddleware(Logging(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not valid JSON: %v\noutput: %s", err, buf.String())
+	}
+	if entry["trace_id"] == "" || entry["trace_id"] != rec.Header().Get("X-Request-ID") {
+		t.Fatalf("expected trace_id %q in log, got %v", rec.Header().Get("X-Request-ID"), entry["trace_id"])
+	}
+}
+
+func TestTracingVisibleToObserve(t *testing.T) {
+	var got string
+	handler := Tracing()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = observe.TraceIDFrom(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "shared-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "shared-123" {
+		t.Fatalf("observe.TraceIDFrom should read middleware.Tracing's ID, got %q", got)
+	}
+}
+
 // --- Logging ---
 
 func TestLoggingOutputsJSON(t *testing.T) {
@@ -171,6 +265,175 @@ func TestLoggingOutputsJSON(t *testing.T) {
 	}
 }
 
+func TestLoggingRedactsHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := LoggingWithConfig(logger, LoggingConfig{
+		LogHeaders:    true,
+		RedactHeaders: []string{"authorization", "X-API-KEY"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("X-Api-Key", "k-123")
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry struct {
+		Headers map[string]string `json:"headers"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not valid JSON: %v\noutput: %s", err, buf.String())
+	}
+	if entry.Headers["Authorization"] != "***" || entry.Headers["X-Api-Key"] != "***" {
+		t.Errorf("expected secrets redacted, got %v", entry.Headers)
+	}
+	if entry.Headers["User-Agent"] != "test-agent/1.0" {
+		t.Errorf("expected User-Agent verbatim, got %q", entry.Headers["User-Agent"])
+	}
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Fatalf("secret leaked into log: %s", buf.String())
+	}
+}
+
+func TestLoggingHeadersOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	handler := Logging(slog.New(slog.NewJSONHandler(&buf, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cookie", "session=abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Contains(buf.String(), "headers") || strings.Contains(buf.String(), "session=abc") {
+		t.Fatalf("headers should not be logged unless enabled: %s", buf.String())
+	}
+}
+
+func TestLoggingSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := Chain(
+		Tracing(),
+		LoggingWithConfig(logger, LoggingConfig{SampleRate: 0.1}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	// countLines sends n requests to path and returns how many were logged
+	countLines := func(path string, n int) int {
+		buf.Reset()
+		for i := 0; i < n; i++ {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Header().Get("X-Request-ID") == "" {
+				t.Fatal("trace ID must be set even when the log line is sampled out")
+			}
+		}
+		return strings.Count(buf.String(), "\n")
+	}
+
+	if got := countLines("/ok", 2000); got < 120 || got > 280 {
+		t.Errorf("expected ~200 of 2000 successes logged at 0.1, got %d", got)
+	}
+	if got := countLines("/fail", 100); got != 100 {
+		t.Errorf("expected every 500 logged, got %d of 100", got)
+	}
+}
+
+func TestContextLoggerAttachesRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := Chain(Tracing(), ContextLogger(base))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the message and its own field; the rest comes from the context
+		observe.LoggerFrom(r.Context()).Info("user loaded", "user_id", 42)
+	}))
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/42", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set("X-Request-ID", "trace-xyz")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not valid JSON: %v\noutput: %s", err, buf.String())
+	}
+	want := map[string]any{
+		"msg":       "user loaded",
+		"user_id":   float64(42),
+		"method":    "DELETE",
+		"path":      "/users/42",
+		"client_ip": "203.0.113.7:51234",
+		"trace_id":  "trace-xyz",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, entry[k])
+		}
+	}
+}
+
+// clfLine matches a Combined Log Format line, capturing each field.
+var clfLine = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d{3}) (\d+|-) "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)"$`)
+
+func TestCombinedLoggingFormat(t *testing.T) {
+	var buf bytes.Buffer
+	handler := CombinedLogging(&buf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not here"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users?page=2", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `curl/8.0 "quoted"`)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := strings.TrimSuffix(buf.String(), "\n")
+	m := clfLine.FindStringSubmatch(line)
+	if m == nil {
+		t.Fatalf("line does not match Combined Log Format: %q", line)
+	}
+	want := map[int]string{
+		1: "203.0.113.7", 2: "-", 3: "alice",
+		5: "GET", 6: "/api/users?page=2", 7: "HTTP/1.1",
+		8: "404", 9: "8",
+		10: "https://example.com/", 11: `curl/8.0 \"quoted\"`,
+	}
+	for i, v := range want {
+		if m[i] != v {
+			t.Errorf("field %d: expected %q, got %q", i, v, m[i])
+		}
+	}
+	if _, err := time.Parse(clfTimeFormat, m[4]); err != nil {
+		t.Errorf("bad timestamp %q: %v", m[4], err)
+	}
+}
+
+func TestCombinedLoggingEmptyFields(t *testing.T) {
+	var buf bytes.Buffer
+	handler := CombinedLogging(&buf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodDelete, "/items/1", nil)
+	req.Header.Del("User-Agent")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// No user, no body, no referer, no user agent: all "-"
+	if !strings.HasSuffix(buf.String(), `"DELETE /items/1 HTTP/1.1" 204 - "-" "-"`+"\n") {
+		t.Fatalf("unexpected line: %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), " - - [") {
+		t.Fatalf("expected - for ident and user: %q", buf.String())
+	}
+}
+
 // --- Rate Limit ---
 
 func TestRateLimitAllows(t *testing.T) {
@@ -218,6 +481,470 @@ func TestRateLimitRejects(t *testing.T) {
 	}
 }
 
+func TestRateLimitCountsRejections(t *testing.T) {
+	limiter := ratelimit.NewPerClient(1, 0, 10*time.Minute) // 1 token, no refill
+	defer limiter.Close()
+	m := observe.NewMetrics(prometheus.NewRegistry())
+
+	handler := RateLimitWithConfig(RateLimitConfig{
+		Limiter:         limiter,
+		KeyFunc:         func(r *http.Request) string { return r.Header.Get("X-Api-Key") },
+		Metrics:         m,
+		MaxClientLabels: 2,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Each client gets one request through, then one rejection per extra request
+	rejected := 0
+	for _, key := range []string{"a", "a", "a", "b", "b", "c", "c", "d", "d"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Api-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code == http.StatusTooManyRequests {
+			rejected++
+		}
+	}
+
+	if rejected != 5 {
+		t.Fatalf("expected 5 rejections, got %d", rejected)
+	}
+	if got := testutil.ToFloat64(m.RateLimitedTotal.WithLabelValues("a")); got != 2 {
+		t.Fatalf("expected 2 rejections for a, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.RateLimitedTotal.WithLabelValues("b")); got != 1 {
+		t.Fatalf("expected 1 rejection for b, got %v", got)
+	}
+	// Past MaxClientLabels, clients share one series
+	if got := testutil.ToFloat64(m.RateLimitedTotal.WithLabelValues("other")); got != 2 {
+		t.Fatalf("expected 2 rejections under other, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.RateLimitedTotal); got != 3 {
+		t.Fatalf("expected 3 client series, got %d", got)
+	}
+}
+
+func TestRateLimitRetryJitterSpreadsRetryAfter(t *testing.T) {
+	limiter := ratelimit.NewPerClient(1, 0.1, 10*time.Minute) // next token in 10s
+	defer limiter.Close()
+
+	handler := RateLimitWithConfig(RateLimitConfig{
+		Limiter:     limiter,
+		KeyFunc:     func(r *http.Request) string { return r.Header.Get("X-Api-Key") },
+		RetryJitter: 10 * time.Second,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// 50 clients exhaust their bucket and are rejected at the same moment
+	seen := map[int]bool{}
+	for i := 0; i < 50; i++ {
+		key := strconv.Itoa(i)
+		for j := 0; j < 2; j++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Api-Key", key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if j == 0 {
+				continue
+			}
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("client %s: expected 429, got %d", key, rec.Code)
+			}
+			secs, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+			if err != nil {
+				t.Fatalf("client %s: bad Retry-After %q", key, rec.Header().Get("Retry-After"))
+			}
+			if secs < 10 || secs > 20 {
+				t.Fatalf("client %s: Retry-After %d outside base 10s + up to 10s jitter", key, secs)
+			}
+			seen[secs] = true
+		}
+	}
+	if len(seen) < 3 {
+		t.Fatalf("expected Retry-After spread across a range, got only %v", seen)
+	}
+}
+
+func TestRouteRateLimitRetryJitter(t *testing.T) {
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /login
+    backends: ["http://localhost:3001"]
+    rate_limit: {burst: 1, rate: 1, per: 10s}
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+	defer rt.Close()
+
+	handler := RouteRateLimitWithConfig(RouteRateLimitConfig{
+		KeyFunc:     func(r *http.Request) string { return r.Header.Get("X-Api-Key") },
+		RetryJitter: 10 * time.Second,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// 50 clients exhaust the route's bucket and are rejected at the same moment
+	seen := map[int]bool{}
+	for i := 0; i < 50; i++ {
+		key := strconv.Itoa(i)
+		for j := 0; j < 2; j++ {
+			req := httptest.NewRequest(http.MethodGet, "/login", nil)
+			req.Header.Set("X-Api-Key", key)
+			req = req.WithContext(router.WithRoute(req.Context(), rt.Match(req)))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if j == 0 {
+				continue
+			}
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("client %s: expected 429, got %d", key, rec.Code)
+			}
+			secs, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+			if err != nil {
+				t.Fatalf("client %s: bad Retry-After %q", key, rec.Header().Get("Retry-After"))
+			}
+			if secs < 10 || secs > 20 {
+				t.Fatalf("client %s: Retry-After %d outside base 10s + up to 10s jitter", key, secs)
+			}
+			seen[secs] = true
+		}
+	}
+	if len(seen) < 3 {
+		t.Fatalf("expected Retry-After spread across a range, got only %v", seen)
+	}
+}
+
+func TestRateLimitCompositeKey(t *testing.T) {
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /a
+    backends: ["http://localhost:3001"]
+  - path: /b
+    backends: ["http://localhost:3002"]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+	defer rt.Close()
+
+	limiter := ratelimit.NewPerClient(2, 0, 10*time.Minute) // 2 tokens, no refill
+	defer limiter.Close()
+
+	handler := RateLimitWithKeyFunc(limiter, CompositeKey(lb.ClientIPKey, RouteKey))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	matched := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := rt.Match(r); route != nil {
+			r = r.WithContext(router.WithRoute(r.Context(), route))
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	// send makes one request to path; each uses a fresh port, as separate connections would
+	port := 1000
+	send := func(ip, path string) int {
+		port++
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = fmt.Sprintf("%s:%d", ip, port)
+		matched.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	send("10.0.0.1", "/a")
+	send("10.0.0.1", "/a")
+	if code := send("10.0.0.1", "/a"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected /a throttled for 10.0.0.1, got %d", code)
+	}
+	if code := send("10.0.0.1", "/b"); code != http.StatusOK {
+		t.Fatalf("expected /b still allowed for 10.0.0.1, got %d", code)
+	}
+	if code := send("10.0.0.2", "/a"); code != http.StatusOK {
+		t.Fatalf("expected /a still allowed for another IP, got %d", code)
+	}
+}
+
+func TestClientIPResolver(t *testing.T) {
+	tests := []struct {
+		name string
+		hops int
+		xff  []string
+		want string
+	}{
+		{"hops=0 ignores XFF", 0, []string{"203.0.113.9"}, "10.0.0.1"},
+		{"hops=1 without XFF", 1, nil, "10.0.0.1"},
+		{"hops=1 takes rightmost", 1, []string{"203.0.113.9"}, "203.0.113.9"},
+		// The client forged an entry; the LB appended the real address after it
+		{"hops=1 spoofed", 1, []string{"198.51.100.66, 203.0.113.9"}, "203.0.113.9"},
+		{"hops=2 spoofed", 2, []string{"198.51.100.66", "203.0.113.9, 172.16.0.5"}, "203.0.113.9"},
+		{"fewer entries than hops", 3, []string{"203.0.113.9"}, "203.0.113.9"},
+		{"malformed entry", 1, []string{"not-an-ip"}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:4321"
+		for _, v := range tt.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if got := ClientIPResolver(tt.hops)(req); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestClientIPResolverInRateLimitAndLogging(t *testing.T) {
+	limiter := ratelimit.NewPerClient(1, 0, 10*time.Minute) // 1 token, no refill
+	defer limiter.Close()
+	var buf bytes.Buffer
+	clientIP := ClientIPResolver(1)
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := Chain(
+		LoggingWithConfig(logger, LoggingConfig{ClientIP: clientIP}),
+		ContextLoggerWithClientIP(logger, clientIP),
+		RateLimitWithKeyFunc(limiter, clientIP),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		observe.LoggerFrom(r.Context()).Info("handled")
+	}))
+
+	// Two clients behind the same load balancer get separate buckets
+	for _, client := range []string{"203.0.113.1", "203.0.113.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:4321"
+		req.Header.Set("X-Forwarded-For", client)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", client, rec.Code)
+		}
+	}
+	// Both the access log and the request-scoped logger
+	if n := strings.Count(buf.String(), `"client_ip":"203.0.113.2"`); n != 2 {
+		t.Fatalf("expected the resolved client IP in both log lines, got %d: %s", n, buf.String())
+	}
+	if strings.Contains(buf.String(), "10.0.0.1") {
+		t.Fatalf("expected no log line to use the load balancer's address: %s", buf.String())
+	}
+}
+
+func TestKeyExtractors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[2001:db8::1]:443"
+	req.Header.Set("X-Api-Key", "k-1")
+
+	if got := CompositeKey(lb.ClientIPKey, lb.HeaderKey("X-Api-Key"), RouteKey)(req); got != "2001:db8::1|k-1|no_match" {
+		t.Fatalf("unexpected composite key %q", got)
+	}
+}
+
+// issueClientCert returns a client certificate for cn signed by ca.
+func issueClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, cn string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertKeyRateLimitsByCommonName(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	limiter := ratelimit.NewPerClient(1, 0, 10*time.Minute) // 1 token, no refill
+	defer limiter.Close()
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	certKey := ClientCertKey(nil)
+	handler := RateLimitWithKeyFunc(limiter, func(r *http.Request) string {
+		key := certKey(r)
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+		return key
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	clientFor := func(certs ...tls.Certificate) *http.Client {
+		transport := srv.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		return &http.Client{Transport: transport}
+	}
+	status := func(c *http.Client) int {
+		t.Helper()
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Two services behind the same IP get a bucket each
+	svcA := clientFor(issueClientCert(t, ca, caKey, "svc-a"))
+	svcB := clientFor(issueClientCert(t, ca, caKey, "svc-b"))
+	if code := status(svcA); code != http.StatusOK {
+		t.Fatalf("svc-a first request: expected 200, got %d", code)
+	}
+	if code := status(svcA); code != http.StatusTooManyRequests {
+		t.Fatalf("svc-a second request: expected 429, got %d", code)
+	}
+	if code := status(svcB); code != http.StatusOK {
+		t.Fatalf("svc-b: expected its own bucket, got %d", code)
+	}
+
+	// No certificate: keyed by IP
+	if code := status(clientFor()); code != http.StatusOK {
+		t.Fatalf("no cert: expected 200, got %d", code)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := "svc-a,svc-a,svc-b,127.0.0.1"; strings.Join(keys, ",") != want {
+		t.Fatalf("expected keys %s, got %s", want, strings.Join(keys, ","))
+	}
+}
+
+func TestRouteRateLimit(t *testing.T) {
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /login
+    backends: ["http://localhost:3001"]
+    rate_limit: {burst: 2, rate: 5, per: 1m}
+  - path: /static
+    backends: ["http://localhost:3002"]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+	defer rt.Close()
+
+	handler := RouteRateLimit(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	matched := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := rt.Match(r); route != nil {
+			r = r.WithContext(router.WithRoute(r.Context(), route))
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	// send returns the status codes of n requests to path from one client
+	send := func(path string, n int) []int {
+		codes := make([]int, n)
+		for i := range codes {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			matched.ServeHTTP(rec, req)
+			codes[i] = rec.Code
+		}
+		return codes
+	}
+
+	login := send("/login", 3)
+	if login[0] != http.StatusOK || login[1] != http.StatusOK || login[2] != http.StatusTooManyRequests {
+		t.Fatalf("/login: expected 200, 200, 429, got %v", login)
+	}
+	for i, code := range send("/static", 10) {
+		if code != http.StatusOK {
+			t.Fatalf("/static request %d: expected 200 (no route limit), got %d", i, code)
+		}
+	}
+}
+
+func TestRouteRateLimitCountsRejections(t *testing.T) {
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /login
+    backends: ["http://localhost:3001"]
+    rate_limit: {burst: 1, rate: 1, per: 1h}
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+	defer rt.Close()
+	m := observe.NewMetrics(prometheus.NewRegistry())
+
+	handler := RouteRateLimitWithConfig(RouteRateLimitConfig{
+		KeyFunc: func(r *http.Request) string { return r.Header.Get("X-Api-Key") },
+		Metrics: m,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Client a gets one request through, then two rejections; b gets one through
+	for _, key := range []string{"a", "a", "a", "b"} {
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		req.Header.Set("X-Api-Key", key)
+		req = req.WithContext(router.WithRoute(req.Context(), rt.Match(req)))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got := testutil.ToFloat64(m.RateLimitedTotal.WithLabelValues("a")); got != 2 {
+		t.Fatalf("expected 2 rejections for a, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.RateLimitedTotal); got != 1 {
+		t.Fatalf("expected only client a to be counted, got %d series", got)
+	}
+}
+
 // --- Circuit Breaker ---
 
 func TestCircuitBreakerAllows(t *testing.T) {
@@ -263,6 +990,1233 @@ func TestCircuitBreakerRejectsWhenOpen(t *testing.T) {
 	}
 }
 
+func TestCircuitStateMetricsTracksTransitions(t *testing.T) {
+	m := observe.NewMetrics(prometheus.NewRegistry())
+	cb := circuitbreaker.NewPerBackendWithConfig(circuitbreaker.Config{
+		MaxFailures:   2,
+		Timeout:       50 * time.Millisecond,
+		OnStateChange: CircuitStateMetrics(m),
+	})
+	gauge := m.CircuitState.WithLabelValues("backend-A")
+
+	cb.RecordFailure("backend-A")
+	cb.RecordFailure("backend-A")
+	if got := testutil.ToFloat64(gauge); got != 1 {
+		t.Fatalf("after opening: expected gauge 1, got %v", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !cb.Allow("backend-A") {
+		t.Fatal("expected the half-open test request to be allowed")
+	}
+	if got := testutil.ToFloat64(gauge); got != 2 {
+		t.Fatalf("after half-open: expected gauge 2, got %v", got)
+	}
+
+	cb.RecordSuccess("backend-A")
+	if got := testutil.ToFloat64(gauge); got != 0 {
+		t.Fatalf("after closing: expected gauge 0, got %v", got)
+	}
+}
+
+// --- Compress ---
+
+func jsonHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, body)
+	})
+}
+
+func TestCompressLargeJSON(t *testing.T) {
+	body := `{"items":"` + strings.Repeat("a", 4096) + `"}`
+	handler := Compress(1024)(jsonHandler(body))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected Content-Encoding: gzip")
+	}
+	if rec.Header().Get("Content-Length") != "" {
+		t.Fatal("Content-Length should be removed when compressing")
+	}
+	if rec.Body.Len() >= len(body) {
+		t.Fatalf("expected compressed body smaller than %d, got %d", len(body), rec.Body.Len())
+	}
+
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	got, _ := io.ReadAll(zr)
+	if string(got) != body {
+		t.Fatal("decompressed body doesn't match original")
+	}
+}
+
+func TestCompressSkipsSmallBody(t *testing.T) {
+	body := `{"ok":true}`
+	handler := Compress(1024)(jsonHandler(body))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("small body should not be compressed")
+	}
+	if rec.Body.String() != body {
+		t.Fatalf("expected body %q, got %q", body, rec.Body.String())
+	}
+}
+
+func TestCompressSkipsClientWithoutGzip(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+
+	for _, ae := range []string{"", "deflate", "gzip;q=0"} {
+		handler := Compress(1024)(jsonHandler(body))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ae != "" {
+			req.Header.Set("Accept-Encoding", ae)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("Accept-Encoding %q: should not compress", ae)
+		}
+		if rec.Body.String() != body {
+			t.Fatalf("Accept-Encoding %q: body should pass through unchanged", ae)
+		}
+	}
+}
+
+func TestCompressSkipsCompressedTypes(t *testing.T) {
+	handler := Compress(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(bytes.Repeat([]byte{0x89}, 100))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("image/png should not be compressed")
+	}
+	if rec.Body.Len() != 100 {
+		t.Fatalf("expected 100 raw bytes, got %d", rec.Body.Len())
+	}
+}
+
+func TestCompressSkipsRangeResponses(t *testing.T) {
+	body := strings.Repeat("r", 4096)
+	handler := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Range", "bytes 0-4095/10000")
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-4095")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("a range response should not be compressed")
+	}
+	if rec.Body.String() != body {
+		t.Fatal("range body should pass through unchanged")
+	}
+}
+
+func TestCompressPassesInformationalResponses(t *testing.T) {
+	body := strings.Repeat("z", 4096)
+	srv := httptest.NewServer(Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, body)
+	})))
+	defer srv.Close()
+
+	var early []int
+	trace := &httptrace.ClientTrace{Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+		early = append(early, code)
+		return nil
+	}}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip") // set by hand, so the transport doesn't decompress
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if len(early) != 1 || early[0] != http.StatusEarlyHints {
+		t.Fatalf("expected a 103 before the response, got %v", early)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("the final status should follow the 103, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected the final response compressed")
+	}
+}
+
+func TestCompressWithResponseCapture(t *testing.T) {
+	body := strings.Repeat("y", 4096)
+	var captured *ResponseCapture
+
+	// Capture inside Compress: sees the handler's status and uncompressed size
+	capture := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			captured = NewResponseCapture(w)
+			next.ServeHTTP(captured, r)
+		})
+	}
+	handler := Chain(Compress(1024), capture)(jsonHandler(body))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if captured.StatusCode != http.StatusCreated {
+		t.Fatalf("capture should see 201, got %d", captured.StatusCode)
+	}
+	if captured.Written != int64(len(body)) {
+		t.Fatalf("capture should see %d uncompressed bytes, got %d", len(body), captured.Written)
+	}
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected Content-Encoding: gzip")
+	}
+}
+
+// --- DecompressRequest ---
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, s)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRequestGzip(t *testing.T) {
+	payload := strings.Repeat(`{"event":"click"}`, 200)
+	var gotBody string
+	var gotEncoding string
+	var gotLength int64
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody, gotEncoding, gotLength = string(b), r.Header.Get("Content-Encoding"), r.ContentLength
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(gzipBytes(t, payload)))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	DecompressRequest(0)(backend).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if gotBody != payload {
+		t.Fatalf("backend got %d bytes, want the %d decompressed bytes", len(gotBody), len(payload))
+	}
+	if gotEncoding != "" || gotLength != int64(len(payload)) {
+		t.Fatalf("expected no Content-Encoding and length %d, got %q and %d", len(payload), gotEncoding, gotLength)
+	}
+}
+
+func TestDecompressRequestPassesOtherEncodings(t *testing.T) {
+	var gotBody string
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	})
+
+	for _, enc := range []string{"", "br"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("raw"))
+		if enc != "" {
+			req.Header.Set("Content-Encoding", enc)
+		}
+		DecompressRequest(0)(backend).ServeHTTP(httptest.NewRecorder(), req)
+		if gotBody != "raw" {
+			t.Fatalf("Content-Encoding %q: body should pass through, got %q", enc, gotBody)
+		}
+	}
+}
+
+func TestDecompressRequestRejectsBombAndGarbage(t *testing.T) {
+	var reached bool
+	handler := DecompressRequest(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	// 1 MiB of zeros compresses to about 1 KiB
+	bomb := gzipBytes(t, strings.Repeat("\x00", 1<<20))
+	for body, want := range map[string]int{
+		string(bomb):      http.StatusRequestEntityTooLarge,
+		"not gzip at all": http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("expected %d, got %d", want, rec.Code)
+		}
+	}
+	if reached {
+		t.Fatal("rejected bodies must not reach the backend")
+	}
+}
+
+// --- Timeout ---
+
+func TestTimeoutCutsOffSlowHandler(t *testing.T) {
+	handlerDone := make(chan error, 1)
+	handler := Timeout(50 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			time.Sleep(20 * time.Millisecond) // let the middleware write the 504 first
+		}
+		_, err := w.Write([]byte("too late"))
+		handlerDone <- err
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d", rec.Code)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("expected cutoff near 50ms, took %v", elapsed)
+	}
+
+	// Handler sees its context cancelled and its late write rejected
+	if err := <-handlerDone; err != http.ErrHandlerTimeout {
+		t.Fatalf("expected ErrHandlerTimeout on late write, got %v", err)
+	}
+	if strings.Contains(rec.Body.String(), "too late") {
+		t.Fatal("late write should not reach the client")
+	}
+}
+
+func TestTimeoutFastHandlerCompletes(t *testing.T) {
+	handler := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "fast")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("done"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", rec.Code)
+	}
+	if rec.Body.String() != "done" {
+		t.Fatalf("expected body 'done', got %q", rec.Body.String())
+	}
+	if rec.Header().Get("X-Backend") != "fast" {
+		t.Fatal("handler headers should be copied to the response")
+	}
+}
+
+// --- IP Filter ---
+
+func ipFilterStatus(t *testing.T, cfg IPFilterConfig, remoteAddr, xff string) int {
+	t.Helper()
+	mw, err := IPFilter(cfg)
+	if err != nil {
+		t.Fatalf("IPFilter: %v", err)
+	}
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.RemoteAddr = remoteAddr
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestIPFilterAllowed(t *testing.T) {
+	cfg := IPFilterConfig{Allow: []string{"10.0.0.0/8", "fd00::/8"}}
+
+	for _, addr := range []string{"10.1.2.3:5555", "[fd00::1]:443", "[::ffff:10.0.0.7]:80"} {
+		if code := ipFilterStatus(t, cfg, addr, ""); code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", addr, code)
+		}
+	}
+	for _, addr := range []string{"192.168.1.1:5555", "[2001:db8::1]:443"} {
+		if code := ipFilterStatus(t, cfg, addr, ""); code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", addr, code)
+		}
+	}
+}
+
+func TestIPFilterDenyTakesPrecedence(t *testing.T) {
+	cfg := IPFilterConfig{
+		Allow: []string{"10.0.0.0/8"},
+		Deny:  []string{"10.0.0.66", "2001:db8::/32"},
+	}
+
+	if code := ipFilterStatus(t, cfg, "10.0.0.66:1234", ""); code != http.StatusForbidden {
+		t.Fatalf("denied IP inside allowed range: expected 403, got %d", code)
+	}
+	if code := ipFilterStatus(t, cfg, "10.0.0.67:1234", ""); code != http.StatusOK {
+		t.Fatalf("neighbouring IP: expected 200, got %d", code)
+	}
+
+	// Deny-only config: everything else is allowed
+	denyOnly := IPFilterConfig{Deny: []string{"2001:db8::/32"}}
+	if code := ipFilterStatus(t, denyOnly, "[2001:db8::5]:80", ""); code != http.StatusForbidden {
+		t.Fatalf("denied IPv6: expected 403, got %d", code)
+	}
+	if code := ipFilterStatus(t, denyOnly, "203.0.113.9:80", ""); code != http.StatusOK {
+		t.Fatalf("unlisted IP with deny-only config: expected 200, got %d", code)
+	}
+}
+
+func TestIPFilterUsesClientIPResolver(t *testing.T) {
+	cfg := IPFilterConfig{
+		Allow:    []string{"10.0.0.0/8"},
+		ClientIP: ClientIPResolver(1),
+	}
+
+	// Behind one proxy: the client IP comes from X-Forwarded-For
+	if code := ipFilterStatus(t, cfg, "192.168.1.1:80", "10.2.3.4"); code != http.StatusOK {
+		t.Fatalf("proxy forwarding internal client: expected 200, got %d", code)
+	}
+	if code := ipFilterStatus(t, cfg, "192.168.1.1:80", "203.0.113.9"); code != http.StatusForbidden {
+		t.Fatalf("proxy forwarding external client: expected 403, got %d", code)
+	}
+	// Spoofed leftmost entry is ignored: the proxy's entry wins
+	if code := ipFilterStatus(t, cfg, "192.168.1.1:80", "10.9.9.9, 203.0.113.9"); code != http.StatusForbidden {
+		t.Fatalf("spoofed XFF: expected 403, got %d", code)
+	}
+
+	// Without a resolver: X-Forwarded-For is ignored
+	cfg.ClientIP = nil
+	if code := ipFilterStatus(t, cfg, "203.0.113.9:80", "10.2.3.4"); code != http.StatusForbidden {
+		t.Fatalf("XFF without a resolver: expected 403, got %d", code)
+	}
+}
+
+func TestIPFilterInvalidConfig(t *testing.T) {
+	if _, err := IPFilter(IPFilterConfig{Allow: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("expected error for invalid CIDR")
+	}
+	if _, err := IPFilter(IPFilterConfig{Deny: []string{"not-an-ip"}}); err == nil {
+		t.Fatal("expected error for invalid IP")
+	}
+}
+
+// --- Routing ---
+
+func TestRoutingCountsMatchedRoutes(t *testing.T) {
+	m := observe.NewMetrics(prometheus.NewRegistry())
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /users/{id}
+    backends: ["http://localhost:3001"]
+  - path: /api/*
+    backends: ["http://localhost:3002"]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+
+	var gotRoute *router.Route
+	var gotParams router.Params
+	h := Routing(RoutingConfig{
+		Router:  func() *router.Router { return rt },
+		Metrics: m,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRoute = router.RouteFrom(r.Context())
+		gotParams = router.ParamsFrom(r.Context())
+	}))
+
+	for _, path := range []string{"/users/1", "/users/2", "/api/orders"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if gotRoute == nil || gotRoute.Pattern() != "/api/*" {
+		t.Fatalf("expected /api/* route in context, got %+v", gotRoute)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/7", nil))
+	if gotParams["id"] != "7" {
+		t.Fatalf("expected id=7 in context, got %v", gotParams)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	// Labelled by configured pattern, never by the request path
+	if got := testutil.ToFloat64(m.RouteMatched.WithLabelValues("/users/{id}")); got != 3 {
+		t.Fatalf("expected 3 matches for /users/{id}, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.RouteMatched.WithLabelValues("/api/*")); got != 1 {
+		t.Fatalf("expected 1 match for /api/*, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.RouteMatched.WithLabelValues("no_match")); got != 1 {
+		t.Fatalf("expected 1 no_match, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.RouteMatched); got != 3 {
+		t.Fatalf("expected 3 series, got %d", got)
+	}
+}
+
+func TestRoutingNotFound(t *testing.T) {
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /api
+    backends: ["http://localhost:3001"]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	// Default: JSON 404 carrying the trace ID
+	h := Chain(Tracing(), Routing(RoutingConfig{Router: func() *router.Router { return rt }}))(next)
+	req := httptest.NewRequest(http.MethodGet, "/nowhere", nil)
+	req.Header.Set("X-Request-ID", "trace-404")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if called {
+		t.Fatal("unmatched request should not reach the next handler")
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+	var body struct {
+		Error   string `json:"error"`
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v (%q)", err, rec.Body.String())
+	}
+	if body.Error != "route_not_found" || body.TraceID != "trace-404" {
+		t.Fatalf("expected route_not_found with trace ID, got %+v", body)
+	}
+
+	// Custom handler
+	h = Routing(RoutingConfig{
+		Router: func() *router.Router { return rt },
+		NotFound: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nothing here", http.StatusGone)
+		}),
+	})(next)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	if rec.Code != http.StatusGone || called {
+		t.Fatalf("expected custom 410 without calling next, got %d (called=%v)", rec.Code, called)
+	}
+}
+
+// --- Metrics ---
+
+func TestMetricsRecordsRequest(t *testing.T) {
+	m := observe.NewMetrics(prometheus.NewRegistry())
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /users/{id}
+    backends: ["http://localhost:3001"]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+
+	handler := Metrics(m, RouteService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	// Match in front of Metrics so the route is in the context it sees
+	matched := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := rt.Match(r); route != nil {
+			r = r.WithContext(router.WithRoute(r.Context(), route))
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		matched.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+	matched.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	if got := testutil.ToFloat64(m.RequestsTotal.WithLabelValues("/users/{id}", "418", "POST")); got != 2 {
+		t.Fatalf("expected 2 requests labelled by route pattern, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.RequestsTotal.WithLabelValues("no_match", "418", "GET")); got != 1 {
+		t.Fatalf("expected 1 unmatched request, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.RequestDuration); got != 2 {
+		t.Fatalf("expected 2 duration series (route + no_match), got %d", got)
+	}
+}
+
+func TestMetricsSplitsDurationByStatusClass(t *testing.T) {
+	m := observe.NewMetrics(prometheus.NewRegistry())
+	handler := Metrics(m, func(*http.Request) string { return "api" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+
+	for _, code := range []string{"200", "201", "404", "500", "503", "503"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?code="+code, nil))
+	}
+
+	if got := testutil.CollectAndCount(m.RequestDuration); got != 3 {
+		t.Fatalf("expected 3 duration series (2xx, 4xx, 5xx), got %d", got)
+	}
+	for class, want := range map[string]uint64{"2xx": 2, "4xx": 1, "5xx": 3} {
+		if got := histogramSampleCount(t, m.RequestDuration.WithLabelValues("api", class)); got != want {
+			t.Fatalf("expected %d observations for %s, got %d", want, class, got)
+		}
+	}
+}
+
+func TestMetricsBackendDuration(t *testing.T) {
+	m := observe.NewMetrics(prometheus.NewRegistry())
+
+	// Stand-in for the proxy: reports a backend chosen by query parameter
+	handler := Metrics(m, RouteService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := observe.RequestInfoFrom(r.Context()); info != nil {
+			info.SetBackend(r.URL.Query().Get("backend"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, backend := range []string{"http://a:8080", "http://b:8080", "http://b:8080"} {
+		req := httptest.NewRequest(http.MethodGet, "/?backend="+backend, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got := testutil.CollectAndCount(m.BackendDuration); got != 2 {
+		t.Fatalf("expected 2 backend series, got %d", got)
+	}
+	if got := histogramSampleCount(t, m.BackendDuration.WithLabelValues("http://a:8080")); got != 1 {
+		t.Fatalf("expected 1 observation for backend a, got %d", got)
+	}
+	if got := histogramSampleCount(t, m.BackendDuration.WithLabelValues("http://b:8080")); got != 2 {
+		t.Fatalf("expected 2 observations for backend b, got %d", got)
+	}
+}
+
+func TestInflightMetricsTracksConcurrentRequests(t *testing.T) {
+	m := observe.NewMetrics(prometheus.NewRegistry())
+
+	const n = 5
+	var entered sync.WaitGroup
+	entered.Add(n)
+	release := make(chan struct{})
+	handler := InflightMetrics(m)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered.Done()
+		<-release
+	}))
+
+	var done sync.WaitGroup
+	for range n {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+
+	// All n are parked in the handler: the gauge must show the peak
+	entered.Wait()
+	if got := testutil.ToFloat64(m.InflightRequests); got != n {
+		t.Fatalf("expected %d in flight, got %v", n, got)
+	}
+
+	close(release)
+	done.Wait()
+	if got := testutil.ToFloat64(m.InflightRequests); got != 0 {
+		t.Fatalf("expected 0 in flight after completion, got %v", got)
+	}
+}
+
+// histogramSampleCount returns how many observations a histogram series has.
+func histogramSampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+	h, ok := o.(prometheus.Histogram)
+	if !ok {
+		t.Fatalf("observer is not a histogram: %T", o)
+	}
+	var pb dto.Metric
+	if err := h.Write(&pb); err != nil {
+		t.Fatalf("write histogram: %v", err)
+	}
+	return pb.GetHistogram().GetSampleCount()
+}
+
+// --- JWT Auth ---
+
+// jwksProvider is a mock identity provider serving a JWKS of its current keys.
+type jwksProvider struct {
+	srv     *httptest.Server
+	fetches atomic.Int32
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+}
+
+func newJWKSProvider(t *testing.T, keys map[string]*rsa.PrivateKey) *jwksProvider {
+	t.Helper()
+	p := &jwksProvider{keys: keys}
+	p.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.fetches.Add(1)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		var set struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		for kid, k := range p.keys {
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(exponentBytes(k.E)),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+// rotate replaces the provider's key set.
+func (p *jwksProvider) rotate(keys map[string]*rsa.PrivateKey) {
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+}
+
+// exponentBytes encodes an RSA exponent big-endian without leading zeros.
+func exponentBytes(e int) []byte {
+	b := []byte{byte(e >> 24), byte(e >> 16), byte(e >> 8), byte(e)}
+	return bytes.TrimLeft(b, "\x00")
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// signJWT builds an RS256 token signed by key.
+func signJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signing := enc(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func jwtRequest(t *testing.T, h http.Handler, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestJWTAuthValidToken(t *testing.T) {
+	key := rsaKey(t)
+	provider := newJWKSProvider(t, map[string]*rsa.PrivateKey{"k1": key})
+
+	var sub any
+	h := JWTAuth(JWTConfig{
+		Keys:     NewJWKS(JWKSConfig{URL: provider.srv.URL}),
+		Issuer:   "https://idp.example",
+		Audience: "gateway",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub = JWTClaims(r.Context())["sub"]
+	}))
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signJWT(t, key, "k1", map[string]any{
+		"sub": "alice", "iss": "https://idp.example", "aud": []string{"gateway"}, "exp": exp,
+	})
+	if rec := jwtRequest(t, h, token); rec.Code != http.StatusOK {
+		t.Fatalf("valid token: expected 200, got %d", rec.Code)
+	}
+	if sub != "alice" {
+		t.Fatalf("expected claims in context, got sub=%v", sub)
+	}
+
+	// Keys are cached across requests
+	jwtRequest(t, h, token)
+	if n := provider.fetches.Load(); n != 1 {
+		t.Fatalf("expected 1 JWKS fetch, got %d", n)
+	}
+
+	rejected := map[string]string{
+		"missing":      "",
+		"expired":      signJWT(t, key, "k1", map[string]any{"iss": "https://idp.example", "aud": "gateway", "exp": time.Now().Add(-time.Minute).Unix()}),
+		"wrong issuer": signJWT(t, key, "k1", map[string]any{"iss": "https://evil.example", "aud": "gateway", "exp": exp}),
+		"wrong aud":    signJWT(t, key, "k1", map[string]any{"iss": "https://idp.example", "aud": "other", "exp": exp}),
+		"bad sig":      signJWT(t, rsaKey(t), "k1", map[string]any{"iss": "https://idp.example", "aud": "gateway", "exp": exp}),
+		"alg none":     base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"k1"}`)) + "." + strings.Split(token, ".")[1] + ".",
+	}
+	for name, tok := range rejected {
+		rec := jwtRequest(t, h, tok)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, rec.Code)
+		}
+		if !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Errorf("%s: expected a Bearer challenge, got %q", name, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestJWTAuthRotatedKeyRefreshes(t *testing.T) {
+	oldKey, newKey := rsaKey(t), rsaKey(t)
+	provider := newJWKSProvider(t, map[string]*rsa.PrivateKey{"k1": oldKey})
+	h := JWTAuth(JWTConfig{
+		Keys: NewJWKS(JWKSConfig{URL: provider.srv.URL, MinRefresh: time.Nanosecond}),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if rec := jwtRequest(t, h, signJWT(t, oldKey, "k1", map[string]any{"sub": "a"})); rec.Code != http.StatusOK {
+		t.Fatalf("old key: expected 200, got %d", rec.Code)
+	}
+
+	// The provider rotates; a token with the new kid forces a refetch
+	provider.rotate(map[string]*rsa.PrivateKey{"k1": oldKey, "k2": newKey})
+	if rec := jwtRequest(t, h, signJWT(t, newKey, "k2", map[string]any{"sub": "a"})); rec.Code != http.StatusOK {
+		t.Fatalf("rotated key: expected 200, got %d", rec.Code)
+	}
+	if n := provider.fetches.Load(); n != 2 {
+		t.Fatalf("expected a refresh on the new kid (2 fetches), got %d", n)
+	}
+}
+
+func TestJWTAuthUnknownKIDRejected(t *testing.T) {
+	key := rsaKey(t)
+	provider := newJWKSProvider(t, map[string]*rsa.PrivateKey{"k1": key})
+	h := JWTAuth(JWTConfig{
+		Keys: NewJWKS(JWKSConfig{URL: provider.srv.URL}),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for range 3 {
+		if rec := jwtRequest(t, h, signJWT(t, key, "nope", map[string]any{"sub": "a"})); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("unknown kid: expected 401, got %d", rec.Code)
+		}
+	}
+	// Refetches on unknown kids are throttled by MinRefresh
+	if n := provider.fetches.Load(); n != 1 {
+		t.Fatalf("expected 1 JWKS fetch for repeated unknown kids, got %d", n)
+	}
+}
+
+func TestJWKSServesStaleOnFetchFailure(t *testing.T) {
+	key := rsaKey(t)
+	provider := newJWKSProvider(t, map[string]*rsa.PrivateKey{"k1": key})
+	jwks := NewJWKS(JWKSConfig{URL: provider.srv.URL, TTL: time.Millisecond, MinRefresh: time.Nanosecond})
+
+	if _, err := jwks.Key(t.Context(), "k1"); err != nil {
+		t.Fatalf("initial fetch: %v", err)
+	}
+	provider.srv.Close()
+	time.Sleep(5 * time.Millisecond) // past the TTL
+
+	if _, err := jwks.Key(t.Context(), "k1"); err != nil {
+		t.Fatalf("expected stale key while the provider is down, got %v", err)
+	}
+}
+
+func TestJWKSFetchOutlivesCancelledRequest(t *testing.T) {
+	key := rsaKey(t)
+	provider := newJWKSProvider(t, map[string]*rsa.PrivateKey{"k1": key})
+	jwks := NewJWKS(JWKSConfig{URL: provider.srv.URL})
+
+	// The request that triggers the fetch is already gone; the fetch must
+	// still run, so the waiting and following requests get the key rather
+	// than a MinRefresh lockout
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := jwks.Key(ctx, "k1"); err != nil {
+		t.Fatalf("expected the fetch to ignore the request's cancellation, got %v", err)
+	}
+	if _, err := jwks.Key(t.Context(), "k1"); err != nil {
+		t.Fatalf("expected the key to be cached, got %v", err)
+	}
+	if n := provider.fetches.Load(); n != 1 {
+		t.Fatalf("expected 1 JWKS fetch, got %d", n)
+	}
+}
+
+func TestJWKSFetchTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	jwks := NewJWKS(JWKSConfig{URL: slow.URL, Client: &http.Client{}, FetchTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := jwks.Key(t.Context(), "k1"); err == nil {
+		t.Fatal("expected the stalled fetch to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected FetchTimeout to bound the fetch, took %v", elapsed)
+	}
+}
+
+// --- Maintenance ---
+
+func TestMaintenanceToggle(t *testing.T) {
+	m := NewMaintenance(MaintenanceConfig{
+		ExemptPaths: []string{"/healthz"},
+		RetryAfter:  30 * time.Second,
+	})
+	handler := m.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := serve("/api"); rec.Code != http.StatusOK {
+		t.Fatalf("disabled by default: expected 200, got %d", rec.Code)
+	}
+
+	m.Enable()
+	rec := serve("/api")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("enabled: expected 503, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "maintenance") {
+		t.Fatalf("expected friendly maintenance body, got %q", rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("/healthz"); rec.Code != http.StatusOK {
+		t.Fatalf("exempt path: expected 200, got %d", rec.Code)
+	}
+
+	m.Disable()
+	if rec := serve("/api"); rec.Code != http.StatusOK {
+		t.Fatalf("disabled again: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestMaintenanceAdminHandler(t *testing.T) {
+	m := NewMaintenance(MaintenanceConfig{})
+	admin := m.AdminHandler()
+
+	call := func(method string) map[string]bool {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest(method, "/maintenance", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", method, rec.Code)
+		}
+		var state map[string]bool
+		json.Unmarshal(rec.Body.Bytes(), &state)
+		return state
+	}
+
+	if call(http.MethodPost)["enabled"] != true || !m.Enabled() {
+		t.Fatal("POST should enable maintenance mode")
+	}
+	if call(http.MethodGet)["enabled"] != true {
+		t.Fatal("GET should report enabled")
+	}
+	if call(http.MethodDelete)["enabled"] != false || m.Enabled() {
+		t.Fatal("DELETE should disable maintenance mode")
+	}
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/maintenance", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT: expected 405, got %d", rec.Code)
+	}
+}
+
+// --- Coalesce ---
+
+func TestCoalesceSharesOneBackendRequest(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := Coalesce(CoalesceConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("X-Backend", "one")
+		w.Write([]byte("shared " + r.URL.RequestURI()))
+	}))
+
+	const clients = 50
+	recs := make([]*httptest.ResponseRecorder, clients)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs[i] = httptest.NewRecorder()
+			handler.ServeHTTP(recs[i], httptest.NewRequest(http.MethodGet, "/items?page=1", nil))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond) // let every client join the in-flight call
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected exactly 1 backend request, got %d", n)
+	}
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK || rec.Body.String() != "shared /items?page=1" || rec.Header().Get("X-Backend") != "one" {
+			t.Fatalf("client %d: got %d %q %v", i, rec.Code, rec.Body.String(), rec.Header())
+		}
+	}
+}
+
+func TestCoalesceKeysOnQueryAndVary(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := Coalesce(CoalesceConfig{Vary: []string{"Accept-Encoding"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+	}))
+
+	reqs := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/items?page=1", nil),
+		httptest.NewRequest(http.MethodGet, "/items?page=2", nil),
+		httptest.NewRequest(http.MethodGet, "/items?page=1", nil),
+		httptest.NewRequest(http.MethodPost, "/items?page=1", nil),
+	}
+	reqs[2].Header.Set("Accept-Encoding", "gzip")
+
+	var wg sync.WaitGroup
+	for _, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != int32(len(reqs)) {
+		t.Fatalf("expected distinct query, Vary value, and method to bypass each other, got %d backend calls", n)
+	}
+}
+
+func TestCoalesceNeverSharesCredentialedRequests(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := Coalesce(CoalesceConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte("for " + r.Header.Get("Authorization") + r.Header.Get("Cookie")))
+	}))
+
+	reqs := make([]*http.Request, 4)
+	for i := range reqs {
+		reqs[i] = httptest.NewRequest(http.MethodGet, "/me", nil)
+	}
+	reqs[0].Header.Set("Authorization", "Bearer alice")
+	reqs[1].Header.Set("Authorization", "Bearer bob")
+	reqs[2].Header.Set("Cookie", "session=carol")
+	reqs[3].Header.Set("Cookie", "session=dave")
+
+	recs := make([]*httptest.ResponseRecorder, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs[i] = httptest.NewRecorder()
+			handler.ServeHTTP(recs[i], req)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != int32(len(reqs)) {
+		t.Fatalf("expected every credentialed request to reach the backend, got %d calls", n)
+	}
+	for i, want := range []string{"Bearer alice", "Bearer bob", "session=carol", "session=dave"} {
+		if got := recs[i].Body.String(); got != "for "+want {
+			t.Fatalf("client %d: got another client's response %q", i, got)
+		}
+	}
+}
+
+func TestCoalesceNeverReplaysSetCookie(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := Coalesce(CoalesceConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if n == 1 {
+			<-release // hold the first request so the others wait on it
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(int(n))})
+		w.Write([]byte("hello"))
+	}))
+
+	const clients = 5
+	recs := make([]*httptest.ResponseRecorder, clients)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs[i] = httptest.NewRecorder()
+			handler.ServeHTTP(recs[i], httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != clients {
+		t.Fatalf("expected each client to get its own backend request, got %d", n)
+	}
+	seen := map[string]bool{}
+	for i, rec := range recs {
+		cookie := rec.Header().Get("Set-Cookie")
+		if seen[cookie] {
+			t.Fatalf("client %d got a cookie already sent to another client: %s", i, cookie)
+		}
+		seen[cookie] = true
+	}
+}
+
+func TestCoalesceNeverReplaysPrivateResponses(t *testing.T) {
+	for _, cc := range []string{"private, max-age=60", "no-store"} {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		handler := Coalesce(CoalesceConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				<-release
+			}
+			w.Header().Set("Cache-Control", cc)
+		}))
+
+		var wg sync.WaitGroup
+		for range 3 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if n := calls.Load(); n != 3 {
+			t.Fatalf("Cache-Control %q: expected each client to get its own backend request, got %d", cc, n)
+		}
+	}
+}
+
+func TestCoalesceKeepsEachClientsRequestID(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	// Like the proxy: the backend's response carries the forwarded ID
+	handler := Chain(Tracing(), Coalesce(CoalesceConfig{}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		w.Write([]byte("shared"))
+	}))
+
+	recs := []*httptest.ResponseRecorder{httptest.NewRecorder(), httptest.NewRecorder()}
+	var wg sync.WaitGroup
+	for i, id := range []string{"req-a", "req-b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			req.Header.Set("X-Request-ID", id)
+			handler.ServeHTTP(recs[i], req)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected the requests coalesced, got %d backend calls", n)
+	}
+	for i, want := range []string{"req-a", "req-b"} {
+		if got := recs[i].Header().Get("X-Request-ID"); got != want {
+			t.Errorf("client %d: expected its own request ID %s, got %s", i, want, got)
+		}
+		if recs[i].Body.String() != "shared" {
+			t.Errorf("client %d: expected the shared body, got %q", i, recs[i].Body.String())
+		}
+	}
+}
+
 // --- Full Chain Integration ---
 
 func TestFullChain(t *testing.T) {
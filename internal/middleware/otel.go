@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName identifies the gateway's instrumentation in exported spans.
+const tracerName = "github.com/G1D0/Api-Gateway"
+
+// OTel starts a server span per request, continuing the trace from an
+// inbound traceparent header if there is one. The span is stored in the
+// request context, so the proxy's client span becomes its child.
+//
+// Spans go wherever tp exports them (e.g. an OTLP exporter). A nil tp
+// makes this a no-op.
+func OTel(tp trace.TracerProvider) Middleware {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	tracer := tp.Tracer(tracerName)
+	propagator := propagation.TraceContext{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			// Method only: the raw path would make span names unbounded
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+					attribute.String("client.address", r.RemoteAddr),
+				),
+			)
+			defer span.End()
+
+			rc := NewResponseCapture(w)
+			next.ServeHTTP(rc, r.WithContext(ctx))
+
+			span.SetAttributes(attribute.Int("http.response.status_code", rc.StatusCode))
+			if rc.StatusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(rc.StatusCode))
+			}
+		})
+	}
+}
@@ -1,24 +1,79 @@
 package middleware
 
 import (
+	"crypto/x509"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/observe"
 	"github.com/G1D0/Api-Gateway/internal/ratelimit"
+	"github.com/G1D0/Api-Gateway/internal/router"
 )
 
+// defaultMaxClientLabels bounds the client label values RateLimitWithConfig
+// adds to gateway_rate_limited_total.
+const defaultMaxClientLabels = 100
+
+// otherClients is the client label for keys beyond MaxClientLabels.
+const otherClients = "other"
+
+// RateLimitConfig configures RateLimitWithConfig. Limiter is required.
+type RateLimitConfig struct {
+	Limiter *ratelimit.PerClient
+
+	// KeyFunc extracts the client key. Nil means r.RemoteAddr.
+	KeyFunc func(*http.Request) string
+
+	// Metrics, if set, gets gateway_rate_limited_total{client} incremented
+	// on every 429.
+	Metrics *observe.Metrics
+
+	// MaxClientLabels caps how many distinct clients get their own label
+	// value (default 100). Later ones are counted under "other", so a flood
+	// of unique keys (e.g. RemoteAddr with its ephemeral port) can't blow
+	// up the metric's cardinality.
+	MaxClientLabels int
+
+	// RetryJitter, if set, adds a random delay in [0, RetryJitter) to each
+	// Retry-After, so clients rejected together don't all come back in the
+	// same instant. The header never goes below the limiter's own value.
+	RetryJitter time.Duration
+}
+
 // RateLimit rejects requests with 429 when the client exceeds their rate limit.
 // Uses per-client token bucket rate limiting.
 func RateLimit(limiter *ratelimit.PerClient) Middleware {
+	return RateLimitWithConfig(RateLimitConfig{Limiter: limiter})
+}
+
+// RateLimitWithKeyFunc is like RateLimit but uses a custom function to extract
+// the client key (e.g., API key from header instead of IP).
+func RateLimitWithKeyFunc(limiter *ratelimit.PerClient, keyFunc func(*http.Request) string) Middleware {
+	return RateLimitWithConfig(RateLimitConfig{Limiter: limiter, KeyFunc: keyFunc})
+}
+
+// RateLimitWithConfig is RateLimit with a custom key and rejection metrics.
+func RateLimitWithConfig(cfg RateLimitConfig) Middleware {
+	labels := newClientLabels(cfg.MaxClientLabels)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientIP := r.RemoteAddr
+			key := r.RemoteAddr
+			if cfg.KeyFunc != nil {
+				key = cfg.KeyFunc(r)
+			}
 
-			ok, retryAfter := limiter.Allow(clientIP)
+			ok, retryAfter := cfg.Limiter.Allow(key)
 			if !ok {
-				w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
-				http.Error(w, "rate limited", http.StatusTooManyRequests)
+				if cfg.Metrics != nil {
+					cfg.Metrics.RateLimitedTotal.WithLabelValues(labels.label(key)).Inc()
+				}
+				rejectRateLimited(w, retryAfter, cfg.RetryJitter)
 				return
 			}
 
@@ -27,17 +82,90 @@ func RateLimit(limiter *ratelimit.PerClient) Middleware {
 	}
 }
 
-// RateLimitWithKeyFunc is like RateLimit but uses a custom function to extract
-// the client key (e.g., API key from header instead of IP).
-func RateLimitWithKeyFunc(limiter *ratelimit.PerClient, keyFunc func(*http.Request) string) Middleware {
+// rejectRateLimited writes the 429 with a Retry-After of retryAfter plus a
+// random [0, jitter).
+func rejectRateLimited(w http.ResponseWriter, retryAfter, jitter time.Duration) {
+	if jitter > 0 {
+		retryAfter += rand.N(jitter)
+	}
+	w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
+	http.Error(w, "rate limited", http.StatusTooManyRequests)
+}
+
+// clientLabels hands out label values: the key itself for the first max
+// distinct keys, "other" afterwards.
+type clientLabels struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]bool
+}
+
+// newClientLabels returns clientLabels for up to max keys (default
+// defaultMaxClientLabels).
+func newClientLabels(max int) *clientLabels {
+	if max <= 0 {
+		max = defaultMaxClientLabels
+	}
+	return &clientLabels{max: max, seen: make(map[string]bool)}
+}
+
+func (c *clientLabels) label(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[key] {
+		return key
+	}
+	if len(c.seen) >= c.max {
+		return otherClients
+	}
+	c.seen[key] = true
+	return key
+}
+
+// RouteRateLimitConfig configures RouteRateLimitWithConfig. The fields
+// mean what they do in RateLimitConfig; the limiter is the route's.
+type RouteRateLimitConfig struct {
+	KeyFunc         func(*http.Request) string // nil means r.RemoteAddr
+	Metrics         *observe.Metrics           // counts gateway_rate_limited_total{client}
+	MaxClientLabels int                        // default 100
+	RetryJitter     time.Duration              // random [0, RetryJitter) on top of Retry-After
+}
+
+// RouteRateLimit applies the matched route's own limiter (rate_limit in the
+// route config), so e.g. /login can be stricter than /static. Requests with
+// no matched route, or whose route sets no limit, pass through. keyFunc
+// picks the client key; nil means r.RemoteAddr, as in RateLimit.
+//
+// The route must already be in the context (see router.WithRoute).
+func RouteRateLimit(keyFunc func(*http.Request) string) Middleware {
+	return RouteRateLimitWithConfig(RouteRateLimitConfig{KeyFunc: keyFunc})
+}
+
+// RouteRateLimitWithConfig is RouteRateLimit with rejection metrics, which
+// count in the same gateway_rate_limited_total as RateLimitWithConfig's,
+// and Retry-After jitter.
+func RouteRateLimitWithConfig(cfg RouteRateLimitConfig) Middleware {
+	labels := newClientLabels(cfg.MaxClientLabels)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			key := keyFunc(r)
+			route := router.RouteFrom(r.Context())
+			if route == nil || route.RateLimit == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			ok, retryAfter := limiter.Allow(key)
+			key := r.RemoteAddr
+			if cfg.KeyFunc != nil {
+				key = cfg.KeyFunc(r)
+			}
+
+			ok, retryAfter := route.RateLimit.Allow(key)
 			if !ok {
-				w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
-				http.Error(w, "rate limited", http.StatusTooManyRequests)
+				if cfg.Metrics != nil {
+					cfg.Metrics.RateLimitedTotal.WithLabelValues(labels.label(key)).Inc()
+				}
+				rejectRateLimited(w, retryAfter, cfg.RetryJitter)
 				return
 			}
 
@@ -46,6 +174,51 @@ func RateLimitWithKeyFunc(limiter *ratelimit.PerClient, keyFunc func(*http.Reque
 	}
 }
 
+// compositeKeySep joins the parts of a CompositeKey.
+const compositeKeySep = "|"
+
+// CompositeKey builds a rate limit key from several extractors, joined with
+// "|" in order: CompositeKey(lb.ClientIPKey, RouteKey) limits each IP per
+// route ("10.0.0.1|/api/*"), separately from a global per-IP limit. The lb
+// key extractors (ClientIPKey, HeaderKey, ...) serve for rate limiting too.
+func CompositeKey(keyFuncs ...func(*http.Request) string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		parts := make([]string, len(keyFuncs))
+		for i, fn := range keyFuncs {
+			parts[i] = fn(r)
+		}
+		return strings.Join(parts, compositeKeySep)
+	}
+}
+
+// ClientCertKey keys on the verified TLS client certificate for mTLS
+// deployments: field picks the value from the leaf certificate, nil meaning
+// its subject common name. Requests without a verified certificate, or
+// whose field is empty, fall back to lb.ClientIPKey.
+//
+// Only certificates the server verified count, so set tls.Config.ClientAuth
+// to VerifyClientCertIfGiven or RequireAndVerifyClientCert; with
+// RequestClientCert a client could name itself anything.
+func ClientCertKey(field func(*x509.Certificate) string) func(*http.Request) string {
+	if field == nil {
+		field = func(cert *x509.Certificate) string { return cert.Subject.CommonName }
+	}
+	return func(r *http.Request) string {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.PeerCertificates) > 0 {
+			if key := field(r.TLS.PeerCertificates[0]); key != "" {
+				return key
+			}
+		}
+		return lb.ClientIPKey(r)
+	}
+}
+
+// RouteKey keys on the matched route's pattern, or "no_match" (see
+// RouteService). The route must already be in the context.
+func RouteKey(r *http.Request) string {
+	return RouteService(r)
+}
+
 // NewDefaultLimiter creates a per-client rate limiter with sensible defaults.
 func NewDefaultLimiter() *ratelimit.PerClient {
 	return ratelimit.NewPerClient(
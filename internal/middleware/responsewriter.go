@@ -31,3 +31,9 @@ func (rc *ResponseCapture) Write(b []byte) (int, error) {
 	rc.Written += int64(n)
 	return n, err
 }
+
+// Unwrap exposes the underlying writer to http.ResponseController, so
+// Flush and deadlines reach the connection through logging and metrics.
+func (rc *ResponseCapture) Unwrap() http.ResponseWriter {
+	return rc.ResponseWriter
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/router"
+)
+
+// RoutingConfig configures Routing.
+type RoutingConfig struct {
+	// Router returns the router to match against; called per request, so
+	// HotReloader.Router can be passed to follow reloads. Required.
+	Router func() *router.Router
+
+	// Metrics, if set, counts each request in
+	// gateway_route_matched_total{path_pattern}.
+	Metrics *observe.Metrics
+
+	// NotFound handles requests that match no route (and the router has no
+	// default route). Nil means NotFoundJSON.
+	NotFound http.Handler
+}
+
+// NotFoundJSON answers 404 with {"error": "route_not_found", "trace_id": ...}.
+// It is Routing's default for unmatched requests.
+var NotFoundJSON http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	JSONError(w, r, http.StatusNotFound, "route_not_found")
+})
+
+// Routing matches each request against the router and stores the route and
+// its path parameters in the context (router.WithRoute, router.WithParams)
+// for the proxy, RouteRateLimit, and RouteService downstream. Requests that
+// match no route go to cfg.NotFound instead of next, so the proxy never
+// sees a request without a route.
+//
+// With Metrics, the matched route's configured pattern is counted, or
+// "no_match", which shows which route traffic actually lands on when
+// requests reach the wrong backend.
+func Routing(cfg RoutingConfig) Middleware {
+	if cfg.NotFound == nil {
+		cfg.NotFound = NotFoundJSON
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, params := cfg.Router().MatchWithParams(r)
+
+			if cfg.Metrics != nil {
+				pattern := noRoute
+				if route != nil {
+					pattern = route.Pattern()
+				}
+				cfg.Metrics.RouteMatched.WithLabelValues(pattern).Inc()
+			}
+
+			if route == nil {
+				cfg.NotFound.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := router.WithRoute(r.Context(), route)
+			if params != nil {
+				ctx = router.WithParams(ctx, params)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
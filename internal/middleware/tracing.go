@@ -2,42 +2,35 @@ package middleware
 
 import (
 	"context"
-	"crypto/rand"
-	"fmt"
 	"net/http"
-)
-
-const traceHeader = "X-Request-ID"
 
-type traceKey struct{}
+	"github.com/G1D0/Api-Gateway/internal/observe"
+)
 
 // Tracing generates or propagates a trace ID for each request.
-// If the client sends X-Request-ID, it's reused. Otherwise a new one is generated.
-// The trace ID is stored in the context and set on the response header.
+// If the client sends X-Request-ID, it's reused; otherwise a valid
+// traceparent's trace-id is, or a new one is generated. The trace ID is
+// stored in the context and set on the response header, and backends get
+// a traceparent continuing the client's trace (see observe.OutgoingTraceparent).
+//
+// The context value is shared with observe.TracingMiddleware, so Logging,
+// the proxy, and JSONError see the ID whichever of the two ran.
 func Tracing() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			traceID := r.Header.Get(traceHeader)
-			if traceID == "" {
-				b := make([]byte, 16)
-				rand.Read(b)
-				traceID = fmt.Sprintf("%x", b)
-			}
+			traceID := observe.TraceIDFromRequest(r)
 
-			ctx := context.WithValue(r.Context(), traceKey{}, traceID)
-			r = r.WithContext(ctx)
-			r.Header.Set(traceHeader, traceID)
-			w.Header().Set(traceHeader, traceID)
+			r = r.WithContext(observe.WithTraceID(r.Context(), traceID))
+			r.Header.Set(observe.TraceparentHeader, observe.OutgoingTraceparent(r, traceID))
+			r.Header.Set(observe.TraceHeader, traceID)
+			w.Header().Set(observe.TraceHeader, traceID)
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// TraceIDFrom retrieves the trace ID from context.
+// TraceIDFrom retrieves the trace ID from context. Same as observe.TraceIDFrom.
 func TraceIDFrom(ctx context.Context) string {
-	if id, ok := ctx.Value(traceKey{}).(string); ok {
-		return id
-	}
-	return ""
+	return observe.TraceIDFrom(ctx)
 }
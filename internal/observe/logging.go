@@ -2,6 +2,7 @@ package observe
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"os"
 )
@@ -17,11 +18,41 @@ const (
 // loggerKey is the context key for the request-scoped logger.
 type loggerKey struct{}
 
-// NewLogger creates a structured JSON logger with the given minimum level.
+// Log output formats for LoggerConfig.
+const (
+	FormatJSON = "json" // one JSON object per line (default)
+	FormatText = "text" // slog key=value text, easier to read locally
+)
+
+// LoggerConfig configures NewLoggerWithConfig. The zero value is a JSON
+// logger on stdout at info level.
+type LoggerConfig struct {
+	Format    string     // FormatJSON or FormatText; anything else means JSON
+	Writer    io.Writer  // defaults to os.Stdout
+	Level     slog.Level // minimum level
+	AddSource bool       // include the caller's file:line in each record
+}
+
+// NewLogger creates a structured JSON logger on stdout with the given
+// minimum level.
 func NewLogger(level slog.Level) *slog.Logger {
-	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: level,
-	}))
+	return NewLoggerWithConfig(LoggerConfig{Level: level})
+}
+
+// NewLoggerWithConfig creates a logger with a custom format and destination.
+func NewLoggerWithConfig(cfg LoggerConfig) *slog.Logger {
+	if cfg.Writer == nil {
+		cfg.Writer = os.Stdout
+	}
+	opts := &slog.HandlerOptions{
+		Level:     cfg.Level,
+		AddSource: cfg.AddSource,
+	}
+
+	if cfg.Format == FormatText {
+		return slog.New(slog.NewTextHandler(cfg.Writer, opts))
+	}
+	return slog.New(slog.NewJSONHandler(cfg.Writer, opts))
 }
 
 // WithLogger stores a logger in the context.
@@ -1,19 +1,33 @@
 package observe
 
 import (
+	"net/http"
+	"runtime"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"net/http"
 )
 
+// latencyBuckets are shared by all latency histograms:
+// 5ms, 10ms, 25ms, 50ms, 100ms, 250ms, 500ms, 1s, 2.5s, 5s, 10s
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
 // Metrics holds all gateway Prometheus metrics.
 type Metrics struct {
 	RequestsTotal    *prometheus.CounterVec
 	RequestDuration  *prometheus.HistogramVec
+	BackendDuration  *prometheus.HistogramVec
 	BackendHealthy   *prometheus.GaugeVec
+	HealthyBackends  *prometheus.GaugeVec
 	RateLimitedTotal *prometheus.CounterVec
 	CircuitState     *prometheus.GaugeVec
 	ActiveConns      *prometheus.GaugeVec
+	SyntheticTotal   *prometheus.CounterVec
+	SyntheticLatency *prometheus.HistogramVec
+	ConfigReloads    *prometheus.CounterVec
+	InflightRequests prometheus.Gauge
+	RouteMatched     *prometheus.CounterVec
 }
 
 // NewMetrics creates and registers all gateway metrics.
@@ -26,14 +40,26 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 			},
 			[]string{"service", "status", "method"},
 		),
+		// status_class (2xx, 4xx, 5xx, ...) rather than the status code keeps
+		// it to a handful of series per service while separating slow errors
+		// from slow successes.
 		RequestDuration: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
-				Name: "gateway_request_duration_seconds",
-				Help: "Request duration in seconds.",
-				// Buckets: 5ms, 10ms, 25ms, 50ms, 100ms, 250ms, 500ms, 1s, 2.5s, 5s, 10s
-				Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+				Name:    "gateway_request_duration_seconds",
+				Help:    "Request duration in seconds, by status class.",
+				Buckets: latencyBuckets,
 			},
-			[]string{"service"},
+			[]string{"service", "status_class"},
+		),
+		// One series per backend address: cardinality grows with the number
+		// of configured backends, not with traffic.
+		BackendDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gateway_backend_duration_seconds",
+				Help:    "Request duration in seconds, by the backend that served it.",
+				Buckets: latencyBuckets,
+			},
+			[]string{"backend"},
 		),
 		BackendHealthy: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -42,6 +68,13 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 			},
 			[]string{"backend"},
 		),
+		HealthyBackends: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gateway_healthy_backends",
+				Help: "Number of healthy backends in a pool, not counting fail-open fallback.",
+			},
+			[]string{"pool"},
+		),
 		RateLimitedTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "gateway_rate_limited_total",
@@ -63,21 +96,133 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 			},
 			[]string{"backend"},
 		),
+		SyntheticTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gateway_synthetic_checks_total",
+				Help: "Total number of synthetic checks run, by result.",
+			},
+			[]string{"check", "result"},
+		),
+		SyntheticLatency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gateway_synthetic_check_duration_seconds",
+				Help:    "Synthetic check end-to-end latency in seconds.",
+				Buckets: latencyBuckets,
+			},
+			[]string{"check"},
+		),
+		ConfigReloads: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gateway_config_reloads_total",
+				Help: "Total number of config reload attempts, by result.",
+			},
+			[]string{"result"},
+		),
+		InflightRequests: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "gateway_inflight_requests",
+				Help: "Number of requests currently being served.",
+			},
+		),
+		// Labelled by the route's configured pattern, not the request path,
+		// so cardinality is bounded by the config.
+		RouteMatched: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gateway_route_matched_total",
+				Help: "Total number of requests by the route they matched; no_match if none did.",
+			},
+			[]string{"path_pattern"},
+		),
 	}
 
 	reg.MustRegister(
 		m.RequestsTotal,
 		m.RequestDuration,
+		m.BackendDuration,
 		m.BackendHealthy,
+		m.HealthyBackends,
 		m.RateLimitedTotal,
 		m.CircuitState,
 		m.ActiveConns,
+		m.SyntheticTotal,
+		m.SyntheticLatency,
+		m.ConfigReloads,
+		m.InflightRequests,
+		m.RouteMatched,
 	)
 
 	return m
 }
 
-// Handler returns the HTTP handler for the /metrics endpoint.
+// RecordSynthetic records the outcome of a synthetic check run.
+func (m *Metrics) RecordSynthetic(check string, ok bool, latency time.Duration) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	m.SyntheticTotal.WithLabelValues(check, result).Inc()
+	m.SyntheticLatency.WithLabelValues(check).Observe(latency.Seconds())
+}
+
+// RecordReload records a config reload attempt. Its signature matches
+// router.HotReloader.OnReload, so it can be registered directly.
+func (m *Metrics) RecordReload(routes int, err error) {
+	if err != nil {
+		m.ConfigReloads.WithLabelValues("failure").Inc()
+		return
+	}
+	m.ConfigReloads.WithLabelValues("success").Inc()
+}
+
+// RecordHealthyBackends sets a pool's healthy backend count. Its signature
+// matches health.PoolConfig.OnRefresh, so it can be registered directly.
+func (m *Metrics) RecordHealthyBackends(pool string, healthy int) {
+	m.HealthyBackends.WithLabelValues(pool).Set(float64(healthy))
+}
+
+// BuildInfo identifies the running binary. Version and Commit are usually
+// set at link time with -ldflags "-X main.version=... -X main.commit=...".
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	GoVersion string // default runtime.Version()
+}
+
+// RegisterBuildInfo registers gateway_build_info, a gauge fixed at 1 whose
+// labels carry info, so dashboards can group by version during rollouts.
+// Empty Version and Commit are reported as "unknown".
+func RegisterBuildInfo(reg prometheus.Registerer, info BuildInfo) {
+	if info.Version == "" {
+		info.Version = "unknown"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.GoVersion == "" {
+		info.GoVersion = runtime.Version()
+	}
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_build_info",
+		Help: "Build information about the running gateway; always 1.",
+		ConstLabels: prometheus.Labels{
+			"version":    info.Version,
+			"commit":     info.Commit,
+			"go_version": info.GoVersion,
+		},
+	})
+	g.Set(1)
+	reg.MustRegister(g)
+}
+
+// Handler returns the HTTP handler for the /metrics endpoint, serving the
+// default registry. Pair it with NewMetrics(prometheus.DefaultRegisterer).
 func Handler() http.Handler {
 	return promhttp.Handler()
 }
+
+// HandlerFor returns a /metrics handler serving reg, typically the custom
+// *prometheus.Registry passed to NewMetrics. Unlike Handler, it doesn't add
+// the default registry's Go runtime and process metrics.
+func HandlerFor(reg prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
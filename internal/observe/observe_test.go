@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // --- Metrics ---
@@ -22,7 +27,7 @@ func TestMetricsRegistration(t *testing.T) {
 
 	// Verify all metrics are registered by using them
 	m.RequestsTotal.WithLabelValues("users", "200", "GET").Inc()
-	m.RequestDuration.WithLabelValues("users").Observe(0.05)
+	m.RequestDuration.WithLabelValues("users", "2xx").Observe(0.05)
 	m.BackendHealthy.WithLabelValues("http://A:8080").Set(1)
 	m.RateLimitedTotal.WithLabelValues("192.168.1.1").Inc()
 	m.CircuitState.WithLabelValues("http://A:8080").Set(0)
@@ -44,15 +49,63 @@ func TestMetricsHistogramBuckets(t *testing.T) {
 	m := NewMetrics(reg)
 
 	// Record some latencies
-	m.RequestDuration.WithLabelValues("api").Observe(0.001)  // 1ms
-	m.RequestDuration.WithLabelValues("api").Observe(0.05)   // 50ms
-	m.RequestDuration.WithLabelValues("api").Observe(0.5)    // 500ms
-	m.RequestDuration.WithLabelValues("api").Observe(2.0)    // 2s
+	m.RequestDuration.WithLabelValues("api", "2xx").Observe(0.001) // 1ms
+	m.RequestDuration.WithLabelValues("api", "2xx").Observe(0.05)  // 50ms
+	m.RequestDuration.WithLabelValues("api", "2xx").Observe(0.5)   // 500ms
+	m.RequestDuration.WithLabelValues("api", "2xx").Observe(2.0)   // 2s
 
 	// Histogram should have recorded 4 observations
-	count := testutil.ToFloat64(m.RequestDuration.WithLabelValues("api"))
+	count := histogramCount(t, m.RequestDuration.WithLabelValues("api", "2xx"))
 	if count != 4 {
-		t.Fatalf("expected 4 observations, got %.0f", count)
+		t.Fatalf("expected 4 observations, got %d", count)
+	}
+}
+
+// histogramCount returns the number of observations recorded by a histogram.
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+	h, ok := o.(prometheus.Histogram)
+	if !ok {
+		t.Fatalf("observer is not a histogram: %T", o)
+	}
+	var pb dto.Metric
+	if err := h.Write(&pb); err != nil {
+		t.Fatalf("write histogram: %v", err)
+	}
+	return pb.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsRecordSynthetic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetrics(reg)
+
+	m.RecordSynthetic("canary", true, 20*time.Millisecond)
+	m.RecordSynthetic("canary", false, 3*time.Second)
+
+	if got := testutil.ToFloat64(m.SyntheticTotal.WithLabelValues("canary", "success")); got != 1 {
+		t.Fatalf("expected 1 success, got %.0f", got)
+	}
+	if got := testutil.ToFloat64(m.SyntheticTotal.WithLabelValues("canary", "failure")); got != 1 {
+		t.Fatalf("expected 1 failure, got %.0f", got)
+	}
+	if got := histogramCount(t, m.SyntheticLatency.WithLabelValues("canary")); got != 2 {
+		t.Fatalf("expected 2 latency observations, got %d", got)
+	}
+}
+
+func TestMetricsRecordReload(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetrics(reg)
+
+	m.RecordReload(3, nil)
+	m.RecordReload(0, errors.New("invalid config"))
+	m.RecordReload(4, nil)
+
+	if got := testutil.ToFloat64(m.ConfigReloads.WithLabelValues("success")); got != 2 {
+		t.Fatalf("expected 2 successful reloads, got %.0f", got)
+	}
+	if got := testutil.ToFloat64(m.ConfigReloads.WithLabelValues("failure")); got != 1 {
+		t.Fatalf("expected 1 failed reload, got %.0f", got)
 	}
 }
 
@@ -73,6 +126,57 @@ func TestMetricsGaugeUpDown(t *testing.T) {
 	}
 }
 
+func TestHandlerForCustomRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetrics(reg)
+	m.RequestsTotal.WithLabelValues("api", "200", "GET").Inc()
+
+	rec := httptest.NewRecorder()
+	HandlerFor(reg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `gateway_requests_total{method="GET",service="api",status="200"} 1`) {
+		t.Fatalf("custom registry metrics missing from output:\n%s", rec.Body.String())
+	}
+
+	// The global handler doesn't see the custom registry
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(rec.Body.String(), `service="api"`) {
+		t.Fatal("default handler unexpectedly served the custom registry")
+	}
+}
+
+func TestRegisterBuildInfo(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	RegisterBuildInfo(reg, BuildInfo{Version: "v1.4.0", Commit: "abc1234"})
+
+	expected := `
+# HELP gateway_build_info Build information about the running gateway; always 1.
+# TYPE gateway_build_info gauge
+gateway_build_info{commit="abc1234",go_version="` + runtime.Version() + `",version="v1.4.0"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "gateway_build_info"); err != nil {
+		t.Fatalf("build info mismatch: %v", err)
+	}
+}
+
+func TestRegisterBuildInfoDefaults(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	RegisterBuildInfo(reg, BuildInfo{})
+
+	expected := `
+# HELP gateway_build_info Build information about the running gateway; always 1.
+# TYPE gateway_build_info gauge
+gateway_build_info{commit="unknown",go_version="` + runtime.Version() + `",version="unknown"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "gateway_build_info"); err != nil {
+		t.Fatalf("build info mismatch: %v", err)
+	}
+}
+
 // --- Structured Logging ---
 
 func TestNewLoggerOutputsJSON(t *testing.T) {
@@ -95,6 +199,45 @@ func TestNewLoggerOutputsJSON(t *testing.T) {
 	}
 }
 
+func TestNewLoggerWithConfigFormats(t *testing.T) {
+	var jsonBuf, textBuf bytes.Buffer
+	NewLoggerWithConfig(LoggerConfig{Writer: &jsonBuf}).Info("hello", "key", "value")
+	NewLoggerWithConfig(LoggerConfig{Format: FormatText, Writer: &textBuf}).Info("hello", "key", "value")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(jsonBuf.Bytes(), &entry); err != nil || entry["key"] != "value" {
+		t.Fatalf("default format should be JSON, got %q (%v)", jsonBuf.String(), err)
+	}
+	text := textBuf.String()
+	if json.Valid(textBuf.Bytes()) || !strings.Contains(text, "msg=hello") || !strings.Contains(text, "key=value") {
+		t.Fatalf("expected key=value text output, got %q", text)
+	}
+}
+
+func TestNewLoggerWithConfigAddSource(t *testing.T) {
+	var buf bytes.Buffer
+	NewLoggerWithConfig(LoggerConfig{Writer: &buf, AddSource: true}).Info("where am I")
+
+	var entry struct {
+		Source struct {
+			File string `json:"file"`
+			Line int    `json:"line"`
+		} `json:"source"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log output is not valid JSON: %v", err)
+	}
+	if !strings.HasSuffix(entry.Source.File, "observe_test.go") || entry.Source.Line == 0 {
+		t.Fatalf("expected source file:line of the caller, got %+v", entry.Source)
+	}
+
+	buf.Reset()
+	NewLoggerWithConfig(LoggerConfig{Writer: &buf, Level: LevelWarn}).Info("filtered")
+	if buf.Len() > 0 {
+		t.Fatal("info message should be filtered at warn level")
+	}
+}
+
 func TestLoggerLevelFiltering(t *testing.T) {
 	var buf bytes.Buffer
 	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
@@ -241,3 +384,94 @@ func TestTracingMiddleware(t *testing.T) {
 		t.Fatal("response should contain client trace ID")
 	}
 }
+
+func TestTraceIDFromRequestTraceparent(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TraceHeader, "legacy-id")
+
+	if got := TraceIDFromRequest(req); got != "legacy-id" {
+		t.Fatalf("the client's X-Request-ID should win over traceparent, got %s", got)
+	}
+
+	req.Header.Del(TraceHeader)
+	if got := TraceIDFromRequest(req); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the traceparent trace-id without X-Request-ID, got %s", got)
+	}
+
+	// Malformed traceparent falls back to X-Request-ID
+	req.Header.Set(TraceHeader, "legacy-id")
+	for _, bad := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",    // missing flags
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // zero trace-id
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", // zero parent-id
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", // forbidden version
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", // uppercase
+	} {
+		req.Header.Set(TraceparentHeader, bad)
+		if got := TraceIDFromRequest(req); got != "legacy-id" {
+			t.Errorf("traceparent %q: expected fallback to legacy-id, got %s", bad, got)
+		}
+	}
+}
+
+func TestTracingMiddlewareTraceparent(t *testing.T) {
+	var forwarded string
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(TraceparentHeader)
+	}))
+
+	// Inbound traceparent: trace-id and flags kept, new parent-id
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	traceID, parentID, flags, ok := ParseTraceparent(forwarded)
+	if !ok {
+		t.Fatalf("forwarded traceparent is malformed: %q", forwarded)
+	}
+	if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" || flags != "00" {
+		t.Fatalf("expected inbound trace-id and flags, got %q", forwarded)
+	}
+	if parentID == "00f067aa0ba902b7" {
+		t.Fatal("gateway should forward its own parent-id")
+	}
+	if rec.Header().Get(TraceHeader) != traceID {
+		t.Fatalf("X-Request-ID should carry the traceparent trace-id, got %s", rec.Header().Get(TraceHeader))
+	}
+
+	// No inbound headers: a well-formed traceparent is generated
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`).MatchString(forwarded) {
+		t.Fatalf("generated traceparent is malformed: %q", forwarded)
+	}
+	if _, _, _, ok := ParseTraceparent(forwarded); !ok {
+		t.Fatalf("generated traceparent doesn't parse: %q", forwarded)
+	}
+
+	// Legacy X-Request-ID still honoured; traceparent is still valid
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceHeader, "client-trace-123")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get(TraceHeader) != "client-trace-123" {
+		t.Fatal("legacy X-Request-ID should be reused")
+	}
+	if _, _, _, ok := ParseTraceparent(forwarded); !ok {
+		t.Fatalf("traceparent should be valid even with a legacy ID: %q", forwarded)
+	}
+
+	// Both: X-Request-ID stays the client's, traceparent keeps its trace-id
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceHeader, "client-trace-123")
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get(TraceHeader) != "client-trace-123" {
+		t.Fatalf("X-Request-ID should not be replaced by the W3C trace-id, got %s", rec.Header().Get(TraceHeader))
+	}
+	if traceID, _, _, _ := ParseTraceparent(forwarded); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("traceparent should keep the inbound trace-id, got %q", forwarded)
+	}
+}
@@ -0,0 +1,67 @@
+package observe
+
+import (
+	"context"
+	"sync"
+)
+
+// requestInfoKey is the context key for the request's RequestInfo.
+type requestInfoKey struct{}
+
+// RequestInfo collects facts learned while serving a request -- such as
+// which backend the proxy picked -- so middleware further out can report
+// them after the handler returns. Context values flow inward only, so the
+// outer middleware creates the RequestInfo and inner handlers fill it in.
+//
+// Safe for concurrent use (the Timeout middleware runs handlers on another
+// goroutine).
+type RequestInfo struct {
+	mu      sync.Mutex
+	backend string
+	err     error
+}
+
+// WithRequestInfo returns a context carrying a new, empty RequestInfo.
+// If ctx already has one, it is reused so every layer sees the same info.
+func WithRequestInfo(ctx context.Context) (context.Context, *RequestInfo) {
+	if info := RequestInfoFrom(ctx); info != nil {
+		return ctx, info
+	}
+	info := &RequestInfo{}
+	return context.WithValue(ctx, requestInfoKey{}, info), info
+}
+
+// RequestInfoFrom returns the request's RequestInfo, or nil if none was set.
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// SetBackend records the backend address the request was sent to.
+func (i *RequestInfo) SetBackend(addr string) {
+	i.mu.Lock()
+	i.backend = addr
+	i.mu.Unlock()
+}
+
+// Backend returns the recorded backend address, or "" if none was picked.
+func (i *RequestInfo) Backend() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.backend
+}
+
+// SetError records why the request failed, e.g. proxy.ErrUpstreamTimeout,
+// so logs and metrics can tell failures apart beyond the status code.
+func (i *RequestInfo) SetError(err error) {
+	i.mu.Lock()
+	i.err = err
+	i.mu.Unlock()
+}
+
+// Err returns the recorded failure, or nil if none was recorded.
+func (i *RequestInfo) Err() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.err
+}
@@ -5,11 +5,16 @@ import (
 	"crypto/rand"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 const (
 	// TraceHeader is the standard header for request trace IDs.
 	TraceHeader = "X-Request-ID"
+
+	// TraceparentHeader is the W3C Trace Context header:
+	// "00-<32 hex trace-id>-<16 hex parent-id>-<2 hex flags>".
+	TraceparentHeader = "traceparent"
 )
 
 // traceKey is the context key for the trace ID.
@@ -23,15 +28,83 @@ func GenerateTraceID() string {
 	return fmt.Sprintf("%x", b)
 }
 
+// GenerateSpanID creates a random 8-byte hex string for a traceparent parent-id.
+func GenerateSpanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
 // TraceIDFromRequest extracts or generates a trace ID for the request.
-// If the client sent X-Request-ID, reuse it. Otherwise, generate a new one.
+// The client's X-Request-ID wins, so IDs clients already correlate on keep
+// working; then a valid traceparent's trace-id; otherwise a new one is
+// generated. The W3C trace-id travels on in traceparent either way.
 func TraceIDFromRequest(r *http.Request) string {
 	if id := r.Header.Get(TraceHeader); id != "" {
 		return id
 	}
+	if traceID, _, _, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+		return traceID
+	}
 	return GenerateTraceID()
 }
 
+// ParseTraceparent splits a W3C traceparent header into its trace-id,
+// parent-id and flags. ok is false for malformed headers, unknown version
+// "ff", and all-zero IDs, which the spec says must be ignored.
+func ParseTraceparent(h string) (traceID, parentID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 {
+		return "", "", "", false
+	}
+	version := parts[0]
+	if !isHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", "", false
+	}
+	traceID, parentID, flags = parts[1], parts[2], parts[3]
+	if !isHex(traceID, 32) || !isHex(parentID, 16) || !isHex(flags, 2) {
+		return "", "", "", false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return "", "", "", false
+	}
+	return traceID, parentID, flags, true
+}
+
+// FormatTraceparent builds a version-00 traceparent header.
+func FormatTraceparent(traceID, parentID, flags string) string {
+	return "00-" + traceID + "-" + parentID + "-" + flags
+}
+
+// isHex reports whether s is exactly n lowercase hex characters.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// OutgoingTraceparent returns the traceparent to send downstream: the
+// gateway becomes the new parent span, keeping the inbound trace-id and
+// flags when there are any. Without one, traceID is used if it is a valid
+// W3C trace-id; otherwise (e.g. a legacy X-Request-ID like "abc-123") a
+// fresh one is generated for the traceparent while X-Request-ID keeps the
+// legacy value.
+func OutgoingTraceparent(r *http.Request, traceID string) string {
+	if inbound, _, flags, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+		return FormatTraceparent(inbound, GenerateSpanID(), flags)
+	}
+	if !isHex(traceID, 32) || strings.Trim(traceID, "0") == "" {
+		traceID = GenerateTraceID()
+	}
+	return FormatTraceparent(traceID, GenerateSpanID(), "01") // sampled
+}
+
 // WithTraceID stores the trace ID in the context.
 func WithTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, traceKey{}, traceID)
@@ -46,9 +119,10 @@ func TraceIDFrom(ctx context.Context) string {
 }
 
 // TracingMiddleware is an HTTP middleware that:
-//  1. Extracts or generates a trace ID
+//  1. Extracts or generates a trace ID (X-Request-ID, then traceparent)
 //  2. Stores it in the request context
-//  3. Sets it on the response header
+//  3. Sets X-Request-ID and a traceparent for forwarding to backends
+//  4. Sets X-Request-ID on the response header
 func TracingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		traceID := TraceIDFromRequest(r)
@@ -58,6 +132,7 @@ func TracingMiddleware(next http.Handler) http.Handler {
 		r = r.WithContext(ctx)
 
 		// Set on outgoing request header (for forwarding to backends)
+		r.Header.Set(TraceparentHeader, OutgoingTraceparent(r, traceID))
 		r.Header.Set(TraceHeader, traceID)
 
 		// Set on response header (for client)
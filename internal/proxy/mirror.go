@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+)
+
+// defaultMirrorMaxBody caps how much of a request body is buffered for mirroring.
+const defaultMirrorMaxBody = 1 << 20 // 1 MiB
+
+// MirrorConfig shadows a sample of live traffic to a second backend, e.g. a
+// canary. Mirrored copies are fire-and-forget: their responses are discarded
+// and their failures never affect the client.
+type MirrorConfig struct {
+	Backend    string  // mirror base URL, e.g. "http://canary:8080"; empty disables mirroring
+	SampleRate float64 // fraction of requests to mirror, 0.0-1.0
+	MaxBody    int64   // bodies larger than this aren't mirrored; default 1 MiB
+}
+
+// mirror holds the runtime state for MirrorConfig.
+type mirror struct {
+	cfg        MirrorConfig
+	client     *http.Client
+	dispatched atomic.Uint64
+	failed     atomic.Uint64
+}
+
+// MirrorStats reports how many mirror copies were sent and how many of
+// those failed (transport error or 5xx). Both are zero if mirroring is off.
+func (p *proxy) MirrorStats() (dispatched, failed uint64) {
+	if p.mirror == nil {
+		return 0, 0
+	}
+	return p.mirror.dispatched.Load(), p.mirror.failed.Load()
+}
+
+// maybeMirror samples r and, if chosen, sends a copy to the mirror backend
+// at path in the background. It buffers the body so the primary request can
+// still read it; r.Body is replaced accordingly. Never blocks on the mirror.
+func (m *mirror) maybeMirror(r *http.Request, path string) {
+	if m == nil || rand.Float64() >= m.cfg.SampleRate {
+		return
+	}
+	if expectsContinue(r) {
+		return // buffering would send 100 Continue before the backend agrees
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		// Read one byte past the limit to tell "exactly MaxBody" from "too big"
+		buf, err := io.ReadAll(io.LimitReader(r.Body, m.cfg.MaxBody+1))
+		if err != nil || int64(len(buf)) > m.cfg.MaxBody {
+			// Too big (or unreadable): stitch back what we read and skip the mirror
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+			return
+		}
+		r.Body.Close()
+		body = buf
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// Detached from the client's context: the mirror outlives the primary response
+	req, err := http.NewRequestWithContext(context.Background(), r.Method, m.cfg.Backend+path, bytes.NewReader(body))
+	if err != nil {
+		m.failed.Add(1)
+		return
+	}
+	for key, values := range r.Header {
+		if hopByHop[key] {
+			continue
+		}
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	m.dispatched.Add(1)
+	go func() {
+		ctx, cancel := context.WithTimeout(req.Context(), defaultTimeout)
+		defer cancel()
+
+		resp, err := m.client.Do(req.WithContext(ctx))
+		if err != nil {
+			m.failed.Add(1)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			m.failed.Add(1)
+		}
+	}()
+}
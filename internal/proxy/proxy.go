@@ -1,101 +1,569 @@
 package proxy
 
 import (
-    "io"
-    "net/http"
-    "time"
-    "net"
-    "context"
-    "github.com/G1D0/Api-Gateway/internal/lb"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/middleware"
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/router"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultTimeout bounds each upstream request unless the matched route
+// overrides it (see router.Route.Timeout).
+const defaultTimeout = 30 * time.Second
+
+// RequestTimeoutHeader carries a client's own deadline for one request as
+// a Go duration (e.g. "2s"); see ProxyConfig.MaxRequestTimeout.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// defaultMaxBufferBytes caps request bodies buffered for retries.
+const defaultMaxBufferBytes = 1 << 20 // 1 MiB
+
+// Connection pool defaults, used for zero TransportConfig fields.
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 5 * time.Second
 )
 
+// expectContinueTimeout is how long to wait for a backend's 100 Continue
+// before sending the body of an "Expect: 100-continue" request anyway.
+const expectContinueTimeout = 1 * time.Second
+
+// hopByHop headers are meaningful only for a single connection and must
+// not be forwarded to the backend.
+var hopByHop = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailers":            true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// Failures the proxy records on the request's observe.RequestInfo (see
+// RequestInfo.Err) when it answers with its own error instead of a backend
+// response. Match them with errors.Is; the transport error is wrapped too.
+var (
+	ErrNoBackends         = errors.New("proxy: no backends available")
+	ErrBackendUnavailable = errors.New("proxy: backend unavailable")
+	ErrUpstreamTimeout    = errors.New("proxy: upstream timeout")
+)
+
+// tracerName identifies the proxy's instrumentation in exported spans.
+const tracerName = "github.com/G1D0/Api-Gateway/internal/proxy"
+
+// ProxyConfig holds optional proxy settings. The zero value is valid.
+type ProxyConfig struct {
+	// TracerProvider, if set, gets a client span around every backend call,
+	// child of the span in the request context (see middleware.OTel), and
+	// the span's traceparent is sent to the backend. Nil disables tracing.
+	TracerProvider trace.TracerProvider
+
+	// Mirror shadows a sample of requests to a second backend.
+	Mirror MirrorConfig
+
+	// MaxRetries is how many more backends to try when sending fails at the
+	// transport level (refused, reset). Only requests that are safe to repeat
+	// are retried: idempotent methods, or any request with an Idempotency-Key
+	// header. All attempts share the request timeout. Zero disables retries.
+	// Note a lb.KeyBalancer picks the same backend on every attempt.
+	MaxRetries int
+
+	// RetryOnStatus lists backend response statuses (e.g. 502, 503) that
+	// also count as failed attempts: the response is discarded and the next
+	// backend tried, within the MaxRetries budget and for the same requests
+	// transport errors are retried for. If every attempt fails this way, the
+	// last response is relayed to the client.
+	RetryOnStatus []int
+
+	// MaxBufferBytes caps the request body held in memory for retries
+	// (default 1 MiB). Larger bodies are streamed and never retried.
+	MaxBufferBytes int64
+
+	// PreserveHost forwards the client's Host header to the backend. By
+	// default the backend sees its own host (from its URL), which is what
+	// virtual-hosted backends expect.
+	PreserveHost bool
+
+	// ErrorResponder renders the proxy's own error responses (e.g. 502 when
+	// the backend is unreachable). Nil means middleware.NegotiatedError,
+	// which follows the client's Accept header; use middleware.PlainError or
+	// middleware.JSONError to always send one format.
+	ErrorResponder middleware.ErrorResponder
+
+	// Outcomes are told how every backend attempt went, so passive health
+	// checks (health.PassiveChecker, health.CombinedChecker) and circuit
+	// breakers (circuitbreaker.PerBackend) follow real traffic. A transport
+	// error or a 5xx response is a failure; an attempt abandoned because
+	// the client went away isn't recorded.
+	Outcomes []OutcomeRecorder
+
+	// Transport tunes the backend connection pool.
+	Transport TransportConfig
+
+	// MaxRequestTimeout enables the X-Request-Timeout header and caps it:
+	// a client sending "X-Request-Timeout: 2s" gets its upstream deadline
+	// cut to 2s (never past the route timeout, nor past this cap), and 504
+	// instead of 502 when that deadline fires. Malformed or non-positive
+	// values are ignored. The backend sees the deadline actually applied.
+	// Zero ignores the header.
+	MaxRequestTimeout time.Duration
+}
+
+// TransportConfig tunes the connection pool to backends. Zero fields keep
+// the defaults noted on each.
+type TransportConfig struct {
+	MaxIdleConns        int           // idle connections kept across all backends (100)
+	MaxIdleConnsPerHost int           // idle connections kept per backend (100)
+	IdleConnTimeout     time.Duration // how long an idle connection is kept (90s)
+	DialTimeout         time.Duration // connect timeout; lower it to fail fast (5s)
+
+	// ForceHTTP1 pins backend connections to HTTP/1.1, even to TLS backends
+	// that offer HTTP/2, for legacy servers with broken HTTP/2. It also keeps
+	// lb.LeastConnections honest: its per-backend count assumes each request
+	// in flight holds its own connection, but over HTTP/2 they are streams
+	// multiplexed on one, so a backend's load is no longer bounded by the
+	// connections the gateway holds to it.
+	ForceHTTP1 bool
+}
+
+// OutcomeRecorder receives the result of each request sent to a backend.
+type OutcomeRecorder interface {
+	RecordSuccess(backend string)
+	RecordFailure(backend string)
+}
+
 type proxy struct {
 	balancer lb.Balancer
 	client   *http.Client
+	tracer   trace.Tracer // nil when tracing is disabled
+	mirror   *mirror      // nil when mirroring is disabled
+	onError  middleware.ErrorResponder
+	outcomes []OutcomeRecorder
+
+	maxRetries   int
+	retryStatus  map[int]bool // statuses from RetryOnStatus
+	maxBuffer    int64        // body buffering limit for retries
+	preserveHost bool
+	maxTimeout   time.Duration // cap on X-Request-Timeout; 0 ignores it
 }
 
+// NewProxy creates a proxy with default settings.
 func NewProxy(balancer lb.Balancer) *proxy {
-    return &proxy{
-        balancer: balancer,
-        client: &http.Client{
-            
-            Transport: &http.Transport{
-                MaxIdleConns:        100,
-                MaxIdleConnsPerHost: 100,
-                IdleConnTimeout:     90 * time.Second,
-                DialContext: (&net.Dialer{
-    Timeout: 5 * time.Second,
-}).DialContext,
-            },
-        },
-    }
-}
-
-    
+	return NewProxyWithConfig(balancer, ProxyConfig{})
+}
+
+// NewProxyWithConfig creates a proxy with the given settings.
+func NewProxyWithConfig(balancer lb.Balancer, cfg ProxyConfig) *proxy {
+	var tracer trace.Tracer
+	if cfg.TracerProvider != nil {
+		tracer = cfg.TracerProvider.Tracer(tracerName)
+	}
+	if cfg.ErrorResponder == nil {
+		cfg.ErrorResponder = middleware.NegotiatedError
+	}
+	if cfg.MaxBufferBytes <= 0 {
+		cfg.MaxBufferBytes = defaultMaxBufferBytes
+	}
+	tc := cfg.Transport
+	if tc.MaxIdleConns <= 0 {
+		tc.MaxIdleConns = defaultMaxIdleConns
+	}
+	if tc.MaxIdleConnsPerHost <= 0 {
+		tc.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if tc.IdleConnTimeout <= 0 {
+		tc.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if tc.DialTimeout <= 0 {
+		tc.DialTimeout = defaultDialTimeout
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:        tc.MaxIdleConns,
+		MaxIdleConnsPerHost: tc.MaxIdleConnsPerHost,
+		IdleConnTimeout:     tc.IdleConnTimeout,
+		// Hold the body until the backend answers 100 Continue, so an
+		// early rejection (e.g. 417, 413) reaches the client before it
+		// uploads anything: the client's own 100 Continue is only sent
+		// once the transport starts reading r.Body.
+		ExpectContinueTimeout: expectContinueTimeout,
+		DialContext: (&net.Dialer{
+			Timeout: tc.DialTimeout,
+		}).DialContext,
+	}
+	if tc.ForceHTTP1 {
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP1(true)
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	p := &proxy{
+		balancer:     balancer,
+		tracer:       tracer,
+		onError:      cfg.ErrorResponder,
+		outcomes:     cfg.Outcomes,
+		maxRetries:   cfg.MaxRetries,
+		maxBuffer:    cfg.MaxBufferBytes,
+		preserveHost: cfg.PreserveHost,
+		maxTimeout:   cfg.MaxRequestTimeout,
+		client:       &http.Client{Transport: transport},
+	}
+
+	if len(cfg.RetryOnStatus) > 0 {
+		p.retryStatus = make(map[int]bool, len(cfg.RetryOnStatus))
+		for _, code := range cfg.RetryOnStatus {
+			p.retryStatus[code] = true
+		}
+	}
+
+	if cfg.Mirror.Backend != "" && cfg.Mirror.SampleRate > 0 {
+		if cfg.Mirror.MaxBody <= 0 {
+			cfg.Mirror.MaxBody = defaultMirrorMaxBody
+		}
+		p.mirror = &mirror{cfg: cfg.Mirror, client: p.client}
+	}
+
+	return p
+}
+
 func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-    // 1. Build the backend URL: p.url + r.URL.Path
-    //    use: backendURL := p.url + r.URL.Path
-	backendURL := p.balancer.Next() + r.URL.Path
-    // Right after line 36 (backendURL), add:
-    ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-    defer cancel()
-
-    // 2. Create new request: http.NewRequest(method, url, body)
-    //    method = r.Method
-    //    url    = backendURL
-    //    body   = r.Body
-    
-    newReq, err := http.NewRequestWithContext(ctx, r.Method, backendURL, r.Body)
-	if err != nil{
-		http.Error(w, "failed to create request", http.StatusInternalServerError)
-    	return
-	}
-
-
-    // 3. Copy headers from r to your new request
-    //    loop over r.Header and set them on your new request
-    //    skip hop-by-hop headers
-	hopByHop := map[string]bool{
-    "Connection":          true,
-    "Keep-Alive":          true,
-    "Proxy-Authenticate":  true,
-    "Proxy-Authorization": true,
-    "Te":                  true,
-    "Trailers":            true,
-    "Transfer-Encoding":   true,
-    "Upgrade":             true,
-}
-
-for key, values := range r.Header {
-    if hopByHop[key] {
-        continue
-    }
-    for _, v := range values {
-        newReq.Header.Add(key, v)
-    }
-}
-    // 4. Send the request: p.http.Do(newReq)
-    //    this returns (resp, err)
-     resp, err := p.client .Do(newReq)
-    // 5. Handle error: if err != nil, write 502 to w
-if err != nil {
-    http.Error(w, "bad gateway", http.StatusBadGateway)
-    return  // important! stop here
-}
-defer resp.Body.Close()
+	// Use the matched route's timeout and path rewrite, if it sets them
+	timeout := defaultTimeout
+	path := r.URL.Path
+	if route := router.RouteFrom(r.Context()); route != nil {
+		if route.Timeout > 0 {
+			timeout = route.Timeout
+		}
+		path = route.RewritePath(path)
+	}
+	// A client deadline may shorten it further
+	clientTimeout := false
+	if d, ok := p.requestTimeout(r); ok && d < timeout {
+		timeout, clientTimeout = d, true
+	}
+	// One deadline covers every attempt, so retries never stretch the timeout
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// Shadow a copy to the mirror backend, if sampled (buffers r.Body)
+	p.mirror.maybeMirror(r, path)
+
+	// Retries need the body in memory so each attempt can re-send it.
+	// Not for Expect: 100-continue, where reading the body early would
+	// tell the client to upload before the backend has agreed to take it.
+	attempts := 1
+	var body []byte
+	if p.maxRetries > 0 && retryable(r) && !expectsContinue(r) {
+		if buf, ok := p.bufferBody(r); ok {
+			body = buf
+			attempts += p.maxRetries
+		}
+	}
+
+	traceID := middleware.TraceIDFrom(r.Context())
+
+	var (
+		resp   *http.Response
+		err    error
+		served string // backend that produced resp
+	)
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 && ctx.Err() != nil {
+			break // out of time or client went away; don't bother other backends
+		}
+
+		// 1. Build the backend URL
+		backend := p.next(r)
+		if backend == "" {
+			if attempt == 0 {
+				setError(r, ErrNoBackends)
+				p.onError(w, r, http.StatusServiceUnavailable, "no_backends")
+				return
+			}
+			break // keep the previous attempt's error
+		}
+		backendURL := backend + path
+		if info := observe.RequestInfoFrom(r.Context()); info != nil {
+			info.SetBackend(backend)
+		}
+
+		var reqBody io.Reader = r.Body
+		if body != nil {
+			reqBody = bytes.NewReader(body) // fresh reader per attempt
+		}
+
+		// 2. Create the outgoing request
+		newReq, reqErr := http.NewRequestWithContext(ctx, r.Method, backendURL, reqBody)
+		if reqErr != nil {
+			p.onError(w, r, http.StatusInternalServerError, "invalid_request")
+			return
+		}
+		if body == nil {
+			// Streamed body: keep the client's length instead of going chunked,
+			// so the backend can judge the upload (e.g. Expect: 100-continue)
+			newReq.ContentLength = r.ContentLength
+		}
+
+		// The server moved the client's Host out of r.Header, so newReq
+		// targets the backend's host unless asked otherwise
+		if p.preserveHost {
+			newReq.Host = r.Host
+		}
+
+		// 3. Copy headers, skipping hop-by-hop headers
+		for key, values := range r.Header {
+			if hopByHop[key] {
+				continue
+			}
+			for _, v := range values {
+				newReq.Header.Add(key, v)
+			}
+		}
+
+		// Always forward the trace ID from context, whatever the inbound header says
+		if traceID != "" {
+			newReq.Header.Set(observe.TraceHeader, traceID)
+		}
+		if clientTimeout {
+			newReq.Header.Set(RequestTimeoutHeader, timeout.String()) // the clamped deadline
+		}
+
+		// 4. Send the request
+		next, doErr := p.do(newReq, backendURL)
+		if doErr != nil {
+			if r.Context().Err() == nil {
+				p.record(backend, false) // not just the client hanging up
+			}
+			if resp == nil {
+				err = doErr
+			}
+			continue // a response from an earlier attempt beats an error
+		}
+		if resp != nil {
+			discard(resp)
+		}
+		resp, err, served = next, nil, backend
+		p.record(backend, resp.StatusCode < 500)
+		if !p.retryStatus[resp.StatusCode] {
+			break
+		}
+	}
+
+	// 5. Backend unreachable or timed out → 502; the client's own deadline → 504
+	if err != nil {
+		setError(r, classify(r, err))
+		if clientTimeout && ctx.Err() == context.DeadlineExceeded {
+			p.onError(w, r, http.StatusGatewayTimeout, "upstream_timeout")
+			return
+		}
+		p.onError(w, r, http.StatusBadGateway, "upstream_unavailable")
+		return // important! stop here
+	}
+	defer resp.Body.Close()
 
 	for key, values := range resp.Header {
-    for _, v := range values {
-        w.Header().Add(key, v)
-    }
-}
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	if traceID != "" {
+		// The client gets back the ID we forwarded, not one the backend made up
+		w.Header().Set(observe.TraceHeader, traceID)
+	}
+	if sb, ok := p.balancer.(lb.StickyBalancer); ok {
+		sb.Pin(w, r, served) // send the client back here next time
+	}
 
-    // 6. Copy response status: w.WriteHeader(resp.StatusCode)
+	// Announce trailers the backend declared, before the header is written
+	announced := len(resp.Trailer)
+	for key := range resp.Trailer {
+		w.Header().Add("Trailer", key)
+	}
+
+	// 6. Copy response status
 	w.WriteHeader(resp.StatusCode)
 
-    // 7. Copy response body: io.Copy(w, resp.Body)
+	// 7. Copy response body
 	io.Copy(w, resp.Body)
 
+	// 8. Copy trailers; resp.Trailer is only filled in once the body is read
+	copyTrailers(w, resp.Trailer, announced)
+}
+
+// requestTimeout returns the deadline the client asked for in
+// X-Request-Timeout, clamped to maxTimeout. ok is false if the header is
+// disabled, absent, or not a positive duration.
+func (p *proxy) requestTimeout(r *http.Request) (d time.Duration, ok bool) {
+	if p.maxTimeout <= 0 {
+		return 0, false
+	}
+	v := r.Header.Get(RequestTimeoutHeader)
+	if v == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return min(d, p.maxTimeout), true
+}
+
+// copyTrailers writes trailer values after the body. If the backend sent
+// trailers it didn't declare up front, all of them go out with
+// http.TrailerPrefix, which net/http sends as trailers without an announcement.
+func copyTrailers(w http.ResponseWriter, trailer http.Header, announced int) {
+	if len(trailer) != announced {
+		// Flush first: a small unflushed body would otherwise be sent with a
+		// Content-Length, and undeclared trailers only ride on chunked responses
+		http.NewResponseController(w).Flush()
+		for key, values := range trailer {
+			w.Header()[http.TrailerPrefix+key] = values
+		}
+		return
+	}
+	for key, values := range trailer {
+		w.Header()[key] = values
+	}
 }
 
+// record reports one attempt's outcome on backend to every recorder.
+func (p *proxy) record(backend string, ok bool) {
+	for _, rec := range p.outcomes {
+		if ok {
+			rec.RecordSuccess(backend)
+		} else {
+			rec.RecordFailure(backend)
+		}
+	}
+}
 
+// classify wraps a transport error in ErrUpstreamTimeout or
+// ErrBackendUnavailable. An error caused by the client going away is
+// returned as is: it says nothing about the backend.
+func classify(r *http.Request, err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrUpstreamTimeout, err)
+	case r.Context().Err() != nil:
+		return err
+	default:
+		return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+}
+
+// setError records err on the request's RequestInfo, if it has one.
+func setError(r *http.Request, err error) {
+	if info := observe.RequestInfoFrom(r.Context()); info != nil {
+		info.SetError(err)
+	}
+}
+
+// next picks a backend, by request key if the balancer supports it.
+func (p *proxy) next(r *http.Request) string {
+	if kb, ok := p.balancer.(lb.KeyBalancer); ok {
+		return kb.NextWithRequest(r)
+	}
+	return p.balancer.Next()
+}
+
+// discard drains a little of a response we won't relay, so its connection
+// can be reused, then closes it.
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
+
+// retryable reports whether r may be sent more than once: idempotent
+// methods, or any request carrying an Idempotency-Key header.
+func retryable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != ""
+}
+
+// expectsContinue reports whether the client is waiting for 100 Continue
+// before sending the request body.
+func expectsContinue(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.Header.Get("Expect")), "100-continue")
+}
+
+// bufferBody reads r.Body into memory for retries. If the body is larger
+// than maxBuffer, it restores r.Body (already-read bytes first) so the
+// request can still be streamed once, and returns ok=false.
+func (p *proxy) bufferBody(r *http.Request) (body []byte, ok bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return []byte{}, true
+	}
+	if r.ContentLength > p.maxBuffer {
+		return nil, false // known too big; don't read anything
+	}
+
+	// Read one byte past the limit to tell "exactly maxBuffer" from "too big"
+	buf, err := io.ReadAll(io.LimitReader(r.Body, p.maxBuffer+1))
+	if err != nil || int64(len(buf)) > p.maxBuffer {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, false
+	}
+	r.Body.Close()
+	return buf, true
+}
+
+// do sends the backend request, wrapped in a client span when tracing is on.
+func (p *proxy) do(req *http.Request, backendURL string) (*http.Response, error) {
+	if p.tracer == nil {
+		return p.client.Do(req)
+	}
+
+	ctx, span := p.tracer.Start(req.Context(), "proxy "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", backendURL),
+		),
+	)
+	defer span.End()
+
+	req = req.WithContext(ctx)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	span.SetAttributes(attribute.Float64("gateway.backend.latency_ms", float64(time.Since(start).Microseconds())/1000))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "backend request failed")
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -1,11 +1,31 @@
 package proxy
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/circuitbreaker"
+	"github.com/G1D0/Api-Gateway/internal/health"
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/middleware"
+	"github.com/G1D0/Api-Gateway/internal/observe"
+	"github.com/G1D0/Api-Gateway/internal/router"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // fakeBalancer always returns the same address.
@@ -157,6 +177,57 @@ func TestProxyReturns502WhenBackendDown(t *testing.T) {
 	}
 }
 
+func TestProxyReturns503WithNoBackends(t *testing.T) {
+	frontend := httptest.NewServer(NewProxy(lb.NewRoundRobin(nil)))
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with no backends, got %d", resp.StatusCode)
+	}
+}
+
+func TestProxyRoutesByClientKey(t *testing.T) {
+	var backends []string
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("backend-%d", i)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		defer srv.Close()
+		backends = append(backends, srv.URL)
+	}
+	p := NewProxy(lb.NewConsistentHash(150, backends))
+
+	// served returns which backend answered a request from remoteAddr
+	served := func(remoteAddr string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	first, second := served("192.0.2.10:40000"), served("192.0.2.10:40001")
+	if first == "" || first != second {
+		t.Fatalf("same client IP should reach the same backend, got %q then %q", first, second)
+	}
+
+	// Keyed by client, not the empty key: other clients land elsewhere
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		seen[served(fmt.Sprintf("192.0.2.%d:40000", i))] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected clients spread over backends, got %v", seen)
+	}
+}
+
 func TestProxyForwardsResponseHeaders(t *testing.T) {
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Response-Id", "abc123")
@@ -182,4 +253,1082 @@ func TestProxyForwardsResponseHeaders(t *testing.T) {
 	if resp.Header.Get("X-Response-Id") != "abc123" {
 		t.Fatal("response header X-Response-Id not forwarded")
 	}
-}
\ No newline at end of file
+}
+func TestProxyHostHeader(t *testing.T) {
+	var gotHost atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost.Store(r.Host)
+	}))
+	defer backend.Close()
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+
+	for _, preserve := range []bool{false, true} {
+		frontend := httptest.NewServer(NewProxyWithConfig(&fakeBalancer{addr: backend.URL}, ProxyConfig{PreserveHost: preserve}))
+
+		req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/", nil)
+		req.Host = "api.example.com"
+		// A stray Host entry in the header map must not win either way
+		req.Header.Set("Host", "spoofed.example.com")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		frontend.Close()
+
+		want := backendHost
+		if preserve {
+			want = "api.example.com"
+		}
+		if got := gotHost.Load(); got != want {
+			t.Errorf("PreserveHost=%v: backend saw Host %q, want %q", preserve, got, want)
+		}
+	}
+}
+
+func TestProxyForwardsTrailers(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/declared" {
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.Write([]byte("body"))
+			w.Header().Set("Grpc-Status", "0")
+			return
+		}
+		// Not announced up front: only known once the body is done. Flush
+		// so the response is chunked rather than sized at the end.
+		w.Write([]byte("body"))
+		w.(http.Flusher).Flush()
+		w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+	}))
+	defer backend.Close()
+
+	frontend := httptest.NewServer(NewProxy(&fakeBalancer{addr: backend.URL}))
+	defer frontend.Close()
+
+	for path, want := range map[string][2]string{
+		"/declared":   {"Grpc-Status", "0"},
+		"/undeclared": {"X-Checksum", "abc"},
+	} {
+		resp, err := http.Get(frontend.URL + path)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != "body" {
+			t.Errorf("%s: expected body, got %q", path, body)
+		}
+		if got := resp.Trailer.Get(want[0]); got != want[1] {
+			t.Errorf("%s: expected trailer %s=%q, got %q", path, want[0], want[1], got)
+		}
+	}
+}
+
+func TestProxyForwardsUndeclaredTrailersThroughLogging(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+		w.(http.Flusher).Flush()
+		w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+	}))
+	defer backend.Close()
+
+	// The proxy's flush has to get through ResponseCapture, or the small
+	// body goes out with a Content-Length and the trailer is dropped
+	frontend := httptest.NewServer(middleware.Logging(slog.New(slog.NewJSONHandler(io.Discard, nil)))(
+		NewProxy(&fakeBalancer{addr: backend.URL}),
+	))
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "body" {
+		t.Errorf("expected body, got %q", body)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "abc" {
+		t.Errorf("expected trailer X-Checksum=abc, got %q (Content-Length %d)", got, resp.ContentLength)
+	}
+}
+
+func TestProxyRelaysExpectContinue(t *testing.T) {
+	var bodyBytes atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > 1024 {
+			// Reject without touching the body, so no 100 Continue goes out
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		n, _ := io.Copy(io.Discard, r.Body)
+		bodyBytes.Add(n)
+	}))
+	defer backend.Close()
+
+	frontend := httptest.NewServer(NewProxy(&fakeBalancer{addr: backend.URL}))
+	defer frontend.Close()
+
+	// Speak HTTP/1.1 by hand to see exactly what the client gets before uploading
+	send := func(contentLength int) (*bufio.Reader, net.Conn) {
+		conn, err := net.Dial("tcp", frontend.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "PUT /upload HTTP/1.1\r\nHost: gw\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", contentLength)
+		return bufio.NewReader(conn), conn
+	}
+
+	// Too big: the backend's 417 comes back while the body is still unsent
+	br, conn := send(1 << 20)
+	resp, err := http.ReadResponse(br, nil)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("reading early rejection: %v", err)
+	}
+	if resp.StatusCode != http.StatusExpectationFailed {
+		t.Fatalf("expected 417 before the upload, got %d", resp.StatusCode)
+	}
+
+	// Small enough: the client is told to continue, then the upload goes through
+	br, conn = send(5)
+	defer conn.Close()
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading interim response: %v", err)
+	}
+	if resp.StatusCode != http.StatusContinue {
+		t.Fatalf("expected 100 Continue, got %d", resp.StatusCode)
+	}
+	conn.Write([]byte("hello"))
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading final response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || bodyBytes.Load() != 5 {
+		t.Fatalf("expected 200 with 5 body bytes at the backend, got %d with %d", resp.StatusCode, bodyBytes.Load())
+	}
+}
+
+func TestProxyUsesPerRouteTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /fast
+    timeout: 100ms
+    backends: ["` + backend.URL + `"]
+  - path: /reports
+    timeout: 2s
+    backends: ["` + backend.URL + `"]
+`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+
+	p := NewProxy(&fakeBalancer{addr: backend.URL})
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := rt.Match(r)
+		p.ServeHTTP(w, r.WithContext(router.WithRoute(r.Context(), route)))
+	}))
+	defer frontend.Close()
+
+	start := time.Now()
+	resp, err := http.Get(frontend.URL + "/fast")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("/fast: expected 502 after route timeout, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("/fast: should give up at ~100ms, took %v", elapsed)
+	}
+
+	resp, err = http.Get(frontend.URL + "/reports")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/reports: expected 200 within 2s timeout, got %d", resp.StatusCode)
+	}
+}
+
+func TestProxyAppliesRouteRewrite(t *testing.T) {
+	var backendPath string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendPath = r.URL.Path
+	}))
+	defer backend.Close()
+
+	cfg, err := router.ParseConfig([]byte(`
+routes:
+  - path: /v1/users
+    rewrite: {from: "/v1/users/(.*)", to: "/users/$1"}
+    backends: ["` + backend.URL + `"]
+`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+
+	p := NewProxy(&fakeBalancer{addr: backend.URL})
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r.WithContext(router.WithRoute(r.Context(), rt.Match(r))))
+	}))
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL + "/v1/users/42")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if backendPath != "/users/42" {
+		t.Fatalf("expected backend path /users/42, got %q", backendPath)
+	}
+}
+
+func TestProxyForwardsTraceID(t *testing.T) {
+	var backendSaw []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendSaw = r.Header.Values("X-Request-ID")
+		w.Header().Set("X-Request-ID", "backend-generated") // must not leak to the client
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	chain := middleware.Chain(
+		middleware.Tracing(),
+		middleware.Logging(slog.New(slog.NewJSONHandler(io.Discard, nil))),
+	)
+	frontend := httptest.NewServer(chain(NewProxy(&fakeBalancer{addr: backend.URL})))
+	defer frontend.Close()
+
+	for _, inbound := range []string{"", "client-supplied-id"} {
+		req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/trace", nil)
+		if inbound != "" {
+			req.Header.Set("X-Request-ID", inbound)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		got := resp.Header.Values("X-Request-ID")
+		if len(got) != 1 || got[0] == "" {
+			t.Fatalf("inbound %q: expected exactly one trace ID in response, got %v", inbound, got)
+		}
+		if len(backendSaw) != 1 || backendSaw[0] != got[0] {
+			t.Fatalf("inbound %q: backend saw %v, client got %v", inbound, backendSaw, got)
+		}
+		if inbound != "" && got[0] != inbound {
+			t.Fatalf("expected client-supplied ID %q to be reused, got %q", inbound, got[0])
+		}
+	}
+}
+
+func TestProxyOTelSpans(t *testing.T) {
+	var backendTraceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendTraceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer backend.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(context.Background())
+
+	p := NewProxyWithConfig(&fakeBalancer{addr: backend.URL}, ProxyConfig{TracerProvider: tp})
+	frontend := httptest.NewServer(middleware.OTel(tp)(p))
+	defer frontend.Close()
+
+	const inboundTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/orders", nil)
+	req.Header.Set("traceparent", "00-"+inboundTrace+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	// The client span ends first
+	client, server := spans[0], spans[1]
+	if client.SpanKind() != trace.SpanKindClient || server.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("expected client then server span, got %v then %v", client.SpanKind(), server.SpanKind())
+	}
+
+	// Nesting: inbound traceparent -> server span -> client span
+	if server.SpanContext().TraceID().String() != inboundTrace {
+		t.Fatalf("server span should continue inbound trace, got %s", server.SpanContext().TraceID())
+	}
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("server span parent should be the inbound span, got %s", server.Parent().SpanID())
+	}
+	if client.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatal("client span should be a child of the server span")
+	}
+	if !strings.Contains(backendTraceparent, client.SpanContext().SpanID().String()) {
+		t.Fatalf("backend should see the client span as parent, got %q", backendTraceparent)
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range client.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["url.full"].AsString() != backend.URL+"/orders" {
+		t.Errorf("expected url.full %s/orders, got %q", backend.URL, attrs["url.full"].AsString())
+	}
+	if attrs["http.response.status_code"].AsInt64() != http.StatusCreated {
+		t.Errorf("expected status 201, got %v", attrs["http.response.status_code"].AsInt64())
+	}
+	if _, ok := attrs["gateway.backend.latency_ms"]; !ok {
+		t.Error("expected gateway.backend.latency_ms attribute")
+	}
+}
+
+func TestProxyWithoutTracerProvider(t *testing.T) {
+	var backendTraceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendTraceparent = r.Header.Get("traceparent")
+	}))
+	defer backend.Close()
+
+	// Nil provider: no spans, inbound traceparent passes through untouched
+	frontend := httptest.NewServer(middleware.OTel(nil)(NewProxy(&fakeBalancer{addr: backend.URL})))
+	defer frontend.Close()
+
+	const inbound = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/", nil)
+	req.Header.Set("traceparent", inbound)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if backendTraceparent != inbound {
+		t.Fatalf("expected traceparent forwarded unchanged, got %q", backendTraceparent)
+	}
+}
+
+func TestProxyReportsBackend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	p := NewProxy(&fakeBalancer{addr: backend.URL})
+	ctx, info := observe.WithRequestInfo(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	if info.Backend() != backend.URL {
+		t.Fatalf("expected backend %s recorded, got %q", backend.URL, info.Backend())
+	}
+}
+
+func TestProxyMirrorsSampledTraffic(t *testing.T) {
+	var primaryHits atomic.Int64
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body) // echo, so we can check the body survived buffering
+	}))
+	defer primary.Close()
+
+	var mirrorHits atomic.Int64
+	var badMirrorBody atomic.Bool
+	mirrorBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, _ := io.ReadAll(r.Body); string(body) != "payload" {
+			badMirrorBody.Store(true)
+		}
+		mirrorHits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError) // mirror errors must not reach the client
+	}))
+	defer mirrorBackend.Close()
+
+	p := NewProxyWithConfig(&fakeBalancer{addr: primary.URL}, ProxyConfig{
+		Mirror: MirrorConfig{Backend: mirrorBackend.URL, SampleRate: 0.5},
+	})
+	frontend := httptest.NewServer(p)
+	defer frontend.Close()
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		resp, err := http.Post(frontend.URL+"/orders", "text/plain", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "payload" {
+			t.Fatalf("request %d: primary response affected by mirroring: %d %q", i, resp.StatusCode, body)
+		}
+	}
+
+	// Mirror copies are async; wait for them to land
+	dispatched, failed := p.MirrorStats()
+	deadline := time.Now().Add(2 * time.Second)
+	for failed < dispatched && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_, failed = p.MirrorStats()
+	}
+
+	if primaryHits.Load() != n {
+		t.Fatalf("primary should see every request, got %d", primaryHits.Load())
+	}
+	hits := mirrorHits.Load()
+	if hits < n*3/10 || hits > n*7/10 {
+		t.Fatalf("expected roughly half of %d requests mirrored, got %d", n, hits)
+	}
+	if uint64(hits) != dispatched {
+		t.Fatalf("mirror saw %d requests, proxy dispatched %d", hits, dispatched)
+	}
+	if badMirrorBody.Load() {
+		t.Fatal("mirror should receive the full request body")
+	}
+	if failed != dispatched {
+		t.Fatalf("expected all %d mirror 500s counted as failures, got %d", dispatched, failed)
+	}
+}
+
+func TestProxyMirrorUnreachable(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+
+	p := NewProxyWithConfig(&fakeBalancer{addr: primary.URL}, ProxyConfig{
+		Mirror: MirrorConfig{Backend: "http://127.0.0.1:1", SampleRate: 1},
+	})
+	frontend := httptest.NewServer(p)
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("dead mirror should not affect the client, got %d", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, failed := p.MirrorStats(); failed == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("mirror error should be swallowed and counted")
+}
+
+func TestProxyCustomErrorResponder(t *testing.T) {
+	p := NewProxyWithConfig(&fakeBalancer{addr: "http://127.0.0.1:1"}, ProxyConfig{
+		ErrorResponder: middleware.JSONError,
+	})
+	frontend := httptest.NewServer(middleware.Tracing()(p))
+	defer frontend.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/", nil)
+	req.Header.Set("X-Request-ID", "trace-502")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected application/json, got %q", ct)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if body["error"] != "upstream_unavailable" || body["trace_id"] != "trace-502" {
+		t.Fatalf("unexpected error body: %v", body)
+	}
+}
+
+func TestProxyDefaultErrorIsPlainText(t *testing.T) {
+	frontend := httptest.NewServer(NewProxy(&fakeBalancer{addr: "http://127.0.0.1:1"}))
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected text/plain, got %q", resp.Header.Get("Content-Type"))
+	}
+	if strings.TrimSpace(string(body)) != "bad gateway" {
+		t.Fatalf("expected 'bad gateway', got %q", body)
+	}
+}
+
+// sequenceBalancer hands out addrs in order, then repeats the last one.
+type sequenceBalancer struct {
+	addrs []string
+	n     atomic.Int64
+}
+
+func (s *sequenceBalancer) Next() string {
+	i := int(s.n.Add(1) - 1)
+	return s.addrs[min(i, len(s.addrs)-1)]
+}
+
+func TestProxyRetriesWithBufferedBody(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer echo.Close()
+
+	// First attempt hits a dead backend, the retry hits the echo server
+	seq := &sequenceBalancer{addrs: []string{"http://127.0.0.1:1", echo.URL}}
+	frontend := httptest.NewServer(NewProxyWithConfig(seq, ProxyConfig{MaxRetries: 1}))
+	defer frontend.Close()
+
+	payload := strings.Repeat("retry-me ", 1000)
+	req, _ := http.NewRequest(http.MethodPost, frontend.URL+"/orders", strings.NewReader(payload))
+	req.Header.Set("Idempotency-Key", "order-42")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after retry, got %d", resp.StatusCode)
+	}
+	if string(body) != payload {
+		t.Fatalf("body mangled across retry: got %d bytes, want %d", len(body), len(payload))
+	}
+}
+
+func TestProxyDoesNotRetryNonIdempotent(t *testing.T) {
+	var hits atomic.Int64
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer echo.Close()
+
+	seq := &sequenceBalancer{addrs: []string{"http://127.0.0.1:1", echo.URL}}
+	frontend := httptest.NewServer(NewProxyWithConfig(seq, ProxyConfig{MaxRetries: 1}))
+	defer frontend.Close()
+
+	resp, err := http.Post(frontend.URL+"/orders", "text/plain", strings.NewReader("once"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 without retry, got %d", resp.StatusCode)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("POST without Idempotency-Key must not be retried, backend saw %d", hits.Load())
+	}
+}
+
+func TestProxyStreamsBodyOverBufferLimit(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer echo.Close()
+
+	seq := &sequenceBalancer{addrs: []string{"http://127.0.0.1:1", echo.URL}}
+	frontend := httptest.NewServer(NewProxyWithConfig(seq, ProxyConfig{MaxRetries: 1, MaxBufferBytes: 16}))
+	defer frontend.Close()
+
+	// Too big to buffer: a single streamed attempt, so the dead backend wins
+	req, _ := http.NewRequest(http.MethodPut, frontend.URL+"/blob", strings.NewReader(strings.Repeat("x", 64)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 for unbuffered body, got %d", resp.StatusCode)
+	}
+
+	// The next attempt goes to the echo server and must see the whole body
+	payload := strings.Repeat("y", 64)
+	req, _ = http.NewRequest(http.MethodPut, frontend.URL+"/blob", strings.NewReader(payload))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != payload {
+		t.Fatalf("streamed body truncated: got %d bytes, want %d", len(body), len(payload))
+	}
+}
+
+func TestProxyRetriesOnStatus(t *testing.T) {
+	var unavailableHits atomic.Int64
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unavailableHits.Add(1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+
+	seq := &sequenceBalancer{addrs: []string{unavailable.URL, healthy.URL}}
+	frontend := httptest.NewServer(NewProxyWithConfig(seq, ProxyConfig{
+		MaxRetries:    1,
+		RetryOnStatus: []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+	}))
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("expected 200 from the second backend, got %d %q", resp.StatusCode, body)
+	}
+	if unavailableHits.Load() != 1 {
+		t.Fatalf("expected one attempt at the 503 backend, got %d", unavailableHits.Load())
+	}
+}
+
+func TestProxyRetryOnStatusRelaysLastResponse(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	// Every attempt gets a 503; the last one goes back to the client as is
+	frontend := httptest.NewServer(NewProxyWithConfig(&fakeBalancer{addr: unavailable.URL}, ProxyConfig{
+		MaxRetries:    2,
+		RetryOnStatus: []int{http.StatusServiceUnavailable},
+	}))
+	defer frontend.Close()
+
+	resp, err := http.Get(frontend.URL + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "overloaded") {
+		t.Fatalf("expected the backend's 503, got %d %q", resp.StatusCode, body)
+	}
+
+	// A dead backend after a 503 doesn't turn the 503 into a 502
+	seq := &sequenceBalancer{addrs: []string{unavailable.URL, "http://127.0.0.1:1"}}
+	frontend2 := httptest.NewServer(NewProxyWithConfig(seq, ProxyConfig{
+		MaxRetries:    1,
+		RetryOnStatus: []int{http.StatusServiceUnavailable},
+	}))
+	defer frontend2.Close()
+
+	resp, err = http.Get(frontend2.URL + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the earlier 503 to be relayed, got %d", resp.StatusCode)
+	}
+}
+
+func TestProxyPinsStickyBalancer(t *testing.T) {
+	var addrs []string
+	for _, name := range []string{"a", "b"} {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		defer backend.Close()
+		addrs = append(addrs, backend.URL)
+	}
+	affinity := lb.NewAffinity(lb.NewRoundRobin(addrs), addrs, lb.AffinityConfig{Secret: []byte("s3cret")})
+	frontend := httptest.NewServer(NewProxy(affinity))
+	defer frontend.Close()
+
+	get := func(cookie *http.Cookie) (string, *http.Response) {
+		req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return string(body), resp
+	}
+
+	first, resp := get(nil)
+	cookies := resp.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected the first response to set an affinity cookie, got %v", cookies)
+	}
+	// Round robin would alternate; the cookie keeps every request on one backend
+	for i := 0; i < 5; i++ {
+		if got, _ := get(cookies[0]); got != first {
+			t.Fatalf("request %d went to %s, pinned to %s", i, got, first)
+		}
+	}
+}
+
+func TestProxyRecordsOutcomesForPassiveHealthAndBreaker(t *testing.T) {
+	var flakyCalls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flakyCalls.Add(1)%4 != 0 { // fails 3 in 4
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer flaky.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	passive := health.NewPassiveChecker(health.PassiveConfig{
+		WindowSize:     time.Minute,
+		ErrorThreshold: 0.5,
+		MinRequests:    5,
+	})
+	breakers := circuitbreaker.NewPerBackend(3, time.Minute)
+	frontend := httptest.NewServer(NewProxyWithConfig(
+		lb.NewRoundRobin([]string{flaky.URL, good.URL}),
+		ProxyConfig{Outcomes: []OutcomeRecorder{passive, breakers}},
+	))
+	defer frontend.Close()
+
+	for i := 0; i < 20; i++ {
+		resp, err := http.Get(frontend.URL + "/")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+
+	if passive.IsHealthy(flaky.URL) {
+		t.Fatalf("flaky backend should be marked unhealthy from proxied failures (error rate %.2f)", passive.ErrorRate(flaky.URL))
+	}
+	if !passive.IsHealthy(good.URL) || passive.ErrorRate(good.URL) != 0 {
+		t.Fatalf("good backend should stay healthy, error rate %.2f", passive.ErrorRate(good.URL))
+	}
+	if got := breakers.State(flaky.URL); got != circuitbreaker.StateOpen {
+		t.Fatalf("flaky backend's circuit should be open, got %s", got)
+	}
+	if got := breakers.State(good.URL); got != circuitbreaker.StateClosed {
+		t.Fatalf("good backend's circuit should stay closed, got %s", got)
+	}
+
+	// A dead backend counts too
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+	deadFrontend := httptest.NewServer(NewProxyWithConfig(
+		&fakeBalancer{addr: dead.URL},
+		ProxyConfig{Outcomes: []OutcomeRecorder{passive}},
+	))
+	defer deadFrontend.Close()
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get(deadFrontend.URL + "/")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	if passive.ErrorRate(dead.URL) != 1 {
+		t.Fatalf("transport errors should be recorded as failures, error rate %.2f", passive.ErrorRate(dead.URL))
+	}
+}
+
+func TestProxyClassifiesFailures(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	dead.Close()
+
+	cfg, parseErr := router.ParseConfig([]byte(`
+routes:
+  - path: /
+    timeout: 50ms
+    backends: ["` + slow.URL + `"]
+`))
+	if parseErr != nil {
+		t.Fatalf("parse config: %v", parseErr)
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		t.Fatalf("router.New: %v", err)
+	}
+
+	serve := func(balancer lb.Balancer, route *router.Route) (int, error) {
+		ctx, info := observe.WithRequestInfo(context.Background())
+		if route != nil {
+			ctx = router.WithRoute(ctx, route)
+		}
+		rec := httptest.NewRecorder()
+		NewProxy(balancer).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		return rec.Code, info.Err()
+	}
+
+	code, err := serve(&fakeBalancer{addr: dead.URL}, nil)
+	if code != http.StatusBadGateway || !errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrUpstreamTimeout) {
+		t.Fatalf("dead backend: expected 502 with ErrBackendUnavailable, got %d %v", code, err)
+	}
+
+	code, err = serve(&fakeBalancer{addr: slow.URL}, rt.Match(httptest.NewRequest(http.MethodGet, "/", nil)))
+	if code != http.StatusBadGateway || !errors.Is(err, ErrUpstreamTimeout) || errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("slow backend: expected 502 with ErrUpstreamTimeout, got %d %v", code, err)
+	}
+
+	code, err = serve(&fakeBalancer{addr: ""}, nil)
+	if code != http.StatusServiceUnavailable || !errors.Is(err, ErrNoBackends) {
+		t.Fatalf("no backends: expected 503 with ErrNoBackends, got %d %v", code, err)
+	}
+}
+
+func TestProxyHonorsDialTimeout(t *testing.T) {
+	// 10.255.255.1 is non-routable: the SYN goes unanswered, so only the
+	// dial timeout ends the attempt (or the network is unreachable outright)
+	p := NewProxyWithConfig(&fakeBalancer{addr: "http://10.255.255.1:81"}, ProxyConfig{
+		Transport: TransportConfig{DialTimeout: 100 * time.Millisecond, MaxIdleConnsPerHost: 8},
+	})
+	tr := p.client.Transport.(*http.Transport)
+	if tr.MaxIdleConnsPerHost != 8 || tr.MaxIdleConns != 100 || tr.IdleConnTimeout != 90*time.Second {
+		t.Fatalf("expected custom per-host idle and default pool settings, got %d/%d/%v",
+			tr.MaxIdleConnsPerHost, tr.MaxIdleConns, tr.IdleConnTimeout)
+	}
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the 100ms dial timeout to apply, took %v", elapsed)
+	}
+}
+
+func TestProxyForceHTTP1(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	proto := func(force bool) string {
+		t.Helper()
+		p := NewProxyWithConfig(&fakeBalancer{addr: backend.URL}, ProxyConfig{
+			Transport: TransportConfig{ForceHTTP1: force},
+		})
+		// Trust the test certificate and ask for HTTP/2 wherever it's allowed
+		tr := p.client.Transport.(*http.Transport)
+		tr.TLSClientConfig = backend.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+		tr.ForceAttemptHTTP2 = true
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	if got := proto(false); got != "HTTP/2.0" {
+		t.Fatalf("without ForceHTTP1: expected the backend to negotiate HTTP/2, got %s", got)
+	}
+	if got := proto(true); got != "HTTP/1.1" {
+		t.Fatalf("with ForceHTTP1: expected HTTP/1.1, got %s", got)
+	}
+}
+
+func TestProxyErrorFollowsAccept(t *testing.T) {
+	frontend := httptest.NewServer(middleware.Tracing()(NewProxy(&fakeBalancer{addr: "http://127.0.0.1:1"})))
+	defer frontend.Close()
+
+	fetch := func(accept string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/", nil)
+		req.Header.Set("X-Request-ID", "trace-accept")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Fatalf("Accept %q: expected 502, got %d", accept, resp.StatusCode)
+		}
+		return resp, string(body)
+	}
+
+	// A JSON client gets the envelope
+	resp, body := fetch("application/json")
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("JSON client: expected application/json, got %q", ct)
+	}
+	var envelope map[string]string
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		t.Fatalf("JSON client: body is not JSON: %v", err)
+	}
+	if envelope["error"] != "upstream_unavailable" || envelope["trace_id"] != "trace-accept" {
+		t.Fatalf("JSON client: unexpected error body: %v", envelope)
+	}
+
+	// A default client (no Accept, or */*) gets text
+	for _, accept := range []string{"", "*/*"} {
+		resp, body := fetch(accept)
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+			t.Fatalf("Accept %q: expected text/plain, got %q", accept, resp.Header.Get("Content-Type"))
+		}
+		if strings.TrimSpace(body) != "bad gateway (trace_id trace-accept)" {
+			t.Fatalf("Accept %q: unexpected body %q", accept, body)
+		}
+	}
+
+	// A browser gets HTML
+	resp, body = fetch("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("browser: expected text/html, got %q", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(body, "502 bad gateway") || !strings.Contains(body, "trace-accept") {
+		t.Fatalf("browser: unexpected body %q", body)
+	}
+
+	// JSON at a lower q than text loses
+	if resp, _ := fetch("application/json;q=0.5, text/plain"); !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected text/plain to win on q-value, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	// Equal q and specificity: the client's order decides
+	if resp, _ := fetch("application/json, text/plain, */*"); resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected JSON listed first to win, got %q", resp.Header.Get("Content-Type"))
+	}
+	if resp, _ := fetch("text/plain, application/json"); !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected text/plain listed first to win, got %q", resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestProxyHonorsRequestTimeoutHeader(t *testing.T) {
+	var seen atomic.Value // X-Request-Timeout the backend received
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen.Store(r.Header.Get(RequestTimeoutHeader))
+		select {
+		case <-time.After(300 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	frontend := httptest.NewServer(NewProxyWithConfig(&fakeBalancer{addr: backend.URL}, ProxyConfig{
+		MaxRequestTimeout: 150 * time.Millisecond,
+	}))
+	defer frontend.Close()
+
+	send := func(timeout string) (int, time.Duration) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/", nil)
+		req.Header.Set(RequestTimeoutHeader, timeout)
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode, time.Since(start)
+	}
+
+	// A valid header shortens the deadline
+	code, elapsed := send("50ms")
+	if code != http.StatusGatewayTimeout || elapsed > 250*time.Millisecond {
+		t.Fatalf("50ms: expected 504 at ~50ms, got %d after %v", code, elapsed)
+	}
+	if got := seen.Load(); got != "50ms" {
+		t.Fatalf("50ms: backend should see the applied deadline, got %q", got)
+	}
+
+	// A value past the max is clamped to it
+	code, elapsed = send("10s")
+	if code != http.StatusGatewayTimeout || elapsed > 280*time.Millisecond {
+		t.Fatalf("10s: expected 504 at the 150ms cap, got %d after %v", code, elapsed)
+	}
+	if got := seen.Load(); got != "150ms" {
+		t.Fatalf("10s: backend should see the clamped deadline, got %q", got)
+	}
+
+	// A malformed value is ignored: the route default (30s) applies
+	for _, bad := range []string{"soon", "-1s", "0"} {
+		if code, _ := send(bad); code != http.StatusOK {
+			t.Fatalf("%q: expected the header ignored and 200, got %d", bad, code)
+		}
+	}
+}
+
+func TestProxyIgnoresRequestTimeoutHeaderByDefault(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	frontend := httptest.NewServer(NewProxy(&fakeBalancer{addr: backend.URL}))
+	defer frontend.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, frontend.URL+"/", nil)
+	req.Header.Set(RequestTimeoutHeader, "10ms")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("without MaxRequestTimeout the header should be ignored, got %d", resp.StatusCode)
+	}
+}
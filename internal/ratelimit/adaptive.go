@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// AdaptiveConfig configures NewAdaptiveLimiter. Capacity, MaxRate and
+// ErrorRate are required; the rest have defaults.
+type AdaptiveConfig struct {
+	Capacity int     // burst size
+	MaxRate  float64 // requests/sec while the backend is healthy; the starting rate
+	MinRate  float64 // floor the rate never drops below; default MaxRate/10
+
+	// ErrorRate reports the backend's recent error rate, 0.0-1.0, e.g.
+	// func() float64 { return passive.ErrorRate(addr) } for a
+	// health.PassiveChecker.
+	ErrorRate func() float64
+
+	Threshold float64       // error rate above which the rate is cut; default 0.1
+	Decrease  float64       // multiplicative cut per interval, 0-1; default 0.5
+	Increase  float64       // additive recovery per interval; default MaxRate/10
+	Interval  time.Duration // how often ErrorRate is checked; default 1s
+}
+
+// AdaptiveLimiter is a token bucket whose rate follows backend health,
+// AIMD-style: each interval the rate is halved (by Decrease) while the
+// error rate is above Threshold, and grows back by Increase per interval
+// once it isn't, up to MaxRate. Backing off quickly and recovering slowly
+// gives a struggling backend room to recover without a thundering herd.
+type AdaptiveLimiter struct {
+	bucket *TokenBucket
+	cfg    AdaptiveConfig
+	mu     sync.Mutex // serializes adjust
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewAdaptiveLimiter starts an adaptive limiter at MaxRate. A background
+// goroutine re-checks ErrorRate every Interval; call Close to stop it.
+func NewAdaptiveLimiter(cfg AdaptiveConfig) *AdaptiveLimiter {
+	if cfg.MinRate <= 0 {
+		cfg.MinRate = cfg.MaxRate / 10
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 0.1
+	}
+	if cfg.Decrease <= 0 || cfg.Decrease >= 1 {
+		cfg.Decrease = 0.5
+	}
+	if cfg.Increase <= 0 {
+		cfg.Increase = cfg.MaxRate / 10
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	al := &AdaptiveLimiter{
+		bucket: NewTokenBucket(cfg.Capacity, cfg.MaxRate),
+		cfg:    cfg,
+		stop:   make(chan struct{}),
+	}
+	go al.run()
+	return al
+}
+
+// Allow consumes a token at the current adaptive rate (see TokenBucket.Allow).
+func (al *AdaptiveLimiter) Allow() (ok bool, retryAfter time.Duration) {
+	return al.bucket.Allow()
+}
+
+// Rate returns the current effective rate in requests per second.
+func (al *AdaptiveLimiter) Rate() float64 {
+	return al.bucket.Rate()
+}
+
+// Close stops the background adjustment goroutine.
+func (al *AdaptiveLimiter) Close() {
+	al.once.Do(func() { close(al.stop) })
+}
+
+// run adjusts the rate every Interval until Close.
+func (al *AdaptiveLimiter) run() {
+	ticker := time.NewTicker(al.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			al.adjust()
+		case <-al.stop:
+			return
+		}
+	}
+}
+
+// adjust applies one AIMD step from the current error rate.
+func (al *AdaptiveLimiter) adjust() {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	rate := al.bucket.Rate()
+	if al.cfg.ErrorRate() > al.cfg.Threshold {
+		rate = max(rate*al.cfg.Decrease, al.cfg.MinRate)
+	} else {
+		rate = min(rate+al.cfg.Increase, al.cfg.MaxRate)
+	}
+	al.bucket.SetRate(rate)
+}
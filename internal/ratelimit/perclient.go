@@ -76,6 +76,21 @@ func (pc *PerClient) Allow(key string) (ok bool, retryAfter time.Duration) {
 	return entry.bucket.Allow()
 }
 
+// Peek returns the client's current token count without consuming one
+// (see TokenBucket.Peek). ok is false if the client has no bucket, i.e. it
+// hasn't been seen recently; Peek neither creates a bucket nor counts as
+// activity for garbage collection.
+func (pc *PerClient) Peek(key string) (tokens float64, ok bool) {
+	pc.mu.RLock()
+	entry, exists := pc.clients[key]
+	pc.mu.RUnlock()
+
+	if !exists {
+		return 0, false
+	}
+	return entry.bucket.Peek(), true
+}
+
 // gc periodically removes stale client buckets.
 func (pc *PerClient) gc() {
 	ticker := time.NewTicker(pc.staleThreshold / 2)
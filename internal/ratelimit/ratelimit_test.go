@@ -1,9 +1,13 @@
 package ratelimit
 
 import (
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/health"
 )
 
 // --- Token Bucket ---
@@ -94,6 +98,108 @@ func TestTokenBucketConcurrent(t *testing.T) {
 	}
 }
 
+func TestTokenBucketPeek(t *testing.T) {
+	tb := NewTokenBucket(10, 100.0) // 10 burst, 100/sec refill
+
+	if got := tb.Peek(); got != 10 {
+		t.Fatalf("expected a full bucket of 10, got %v", got)
+	}
+	for i := 0; i < 10; i++ {
+		tb.Allow()
+	}
+	if got := tb.Peek(); got >= 1 {
+		t.Fatalf("expected less than 1 token after draining, got %v", got)
+	}
+
+	// At 100/sec, 50ms earns ~5 tokens; Peek sees them with Allow's math
+	time.Sleep(50 * time.Millisecond)
+	refilled := tb.Peek()
+	if refilled < 4 || refilled > 10 {
+		t.Fatalf("expected ~5 refilled tokens, got %v", refilled)
+	}
+
+	// Peeking never spends: repeated calls don't go down
+	for i := 0; i < 100; i++ {
+		if got := tb.Peek(); got < refilled {
+			t.Fatalf("Peek decremented the bucket: %v after %v", got, refilled)
+		}
+	}
+	if ok, _ := tb.Allow(); !ok {
+		t.Fatal("tokens seen by Peek should still be available to Allow")
+	}
+}
+
+func TestTokenBucketReserveUsed(t *testing.T) {
+	tb := NewTokenBucket(1, 0) // 1 token, no refill
+
+	r := tb.Reserve()
+	if !r.OK() || r.Delay() != 0 {
+		t.Fatalf("expected an immediate reservation, got ok=%v delay=%v", r.OK(), r.Delay())
+	}
+	// Acted on (not cancelled): the token is gone for everyone else
+	if ok, _ := tb.Allow(); ok {
+		t.Fatal("reserved token was spent twice")
+	}
+	// Empty with no refill: nothing can ever be reserved
+	if tb.Reserve().OK() {
+		t.Fatal("expected a failed reservation from an empty bucket that never refills")
+	}
+}
+
+func TestTokenBucketReserveCancel(t *testing.T) {
+	tb := NewTokenBucket(1, 0.01) // 1 token, then one per 100s
+
+	now := tb.Reserve()   // the token in the bucket
+	later := tb.Reserve() // borrowed from the next refill
+	if later.Delay() <= 0 {
+		t.Fatal("second reservation should have to wait")
+	}
+	later.Cancel()
+	later.Cancel() // second cancel must not mint a token
+	if got := tb.Peek(); got < 0 || got > 0.01 {
+		t.Fatalf("expected the borrowed token back (~0), got %v", got)
+	}
+
+	// Past its time to act the caller may already have used it
+	now.Cancel()
+	if got := tb.Peek(); got > 0.01 {
+		t.Fatalf("cancelling a due reservation returned its token, got %v", got)
+	}
+	if ok, _ := tb.Allow(); ok {
+		t.Fatal("no token should be available")
+	}
+}
+
+func TestTokenBucketReserveDelayUnderContention(t *testing.T) {
+	tb := NewTokenBucket(5, 10.0) // 5 burst, then one token per 100ms
+
+	const n = 20
+	delays := make([]time.Duration, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delays[i] = tb.Reserve().Delay()
+		}()
+	}
+	wg.Wait()
+	slices.Sort(delays)
+
+	// The burst goes out now; each later reservation waits one more token
+	for i, d := range delays {
+		want := time.Duration(max(i-4, 0)) * 100 * time.Millisecond
+		if d < want-20*time.Millisecond || d > want+5*time.Millisecond {
+			t.Errorf("reservation %d: expected delay ~%v, got %v", i, want, d)
+		}
+	}
+
+	// Allow queues behind the reservations
+	if ok, retry := tb.Allow(); ok || retry < 1400*time.Millisecond {
+		t.Fatalf("Allow should wait behind 15 borrowed tokens, got ok=%v retry=%v", ok, retry)
+	}
+}
+
 // --- Per-Client ---
 
 func TestPerClientIsolation(t *testing.T) {
@@ -126,6 +232,25 @@ func TestPerClientCreatesOnDemand(t *testing.T) {
 	}
 }
 
+func TestPerClientPeek(t *testing.T) {
+	pc := NewPerClient(3, 0, 10*time.Minute) // 3 tokens, no refill
+	defer pc.Close()
+
+	if _, ok := pc.Peek("unseen"); ok {
+		t.Fatal("expected no bucket for an unseen client")
+	}
+	pc.Allow("client-A")
+	if got, ok := pc.Peek("client-A"); !ok || got != 2 {
+		t.Fatalf("expected 2 tokens left, got %v (ok=%v)", got, ok)
+	}
+	if got, _ := pc.Peek("client-A"); got != 2 {
+		t.Fatalf("Peek should not consume, got %v", got)
+	}
+	if _, ok := pc.Peek("unseen"); ok {
+		t.Fatal("Peek should not create a bucket")
+	}
+}
+
 func TestPerClientGarbageCollection(t *testing.T) {
 	stale := 100 * time.Millisecond
 	pc := NewPerClient(5, 1.0, stale)
@@ -254,4 +379,87 @@ func TestSlidingWindowConcurrent(t *testing.T) {
 	if count != 100 {
 		t.Fatalf("expected 100 allowed, got %d", count)
 	}
-}
\ No newline at end of file
+}
+
+// --- Adaptive ---
+
+func TestAdaptiveLimiterFollowsBackendErrors(t *testing.T) {
+	const backend = "http://api:8080"
+	passive := health.NewPassiveChecker(health.PassiveConfig{
+		WindowSize:     100 * time.Millisecond,
+		ErrorThreshold: 0.5,
+		MinRequests:    1,
+	})
+
+	al := NewAdaptiveLimiter(AdaptiveConfig{
+		Capacity:  10,
+		MaxRate:   100,
+		MinRate:   10,
+		ErrorRate: func() float64 { return passive.ErrorRate(backend) },
+		Threshold: 0.2,
+		Increase:  30,
+		Interval:  time.Hour, // steps driven by the test via adjust
+	})
+	defer al.Close()
+
+	// Healthy: stays at MaxRate
+	passive.RecordSuccess(backend)
+	al.adjust()
+	if got := al.Rate(); got != 100 {
+		t.Fatalf("expected 100/s while healthy, got %v", got)
+	}
+
+	// The backend starts failing: multiplicative decrease down to the floor
+	for i := 0; i < 5; i++ {
+		passive.RecordFailure(backend)
+	}
+	var rates []float64
+	for i := 0; i < 4; i++ {
+		al.adjust()
+		rates = append(rates, al.Rate())
+	}
+	if want := []float64{50, 25, 12.5, 10}; !slices.Equal(rates, want) {
+		t.Fatalf("expected rates %v while failing, got %v", want, rates)
+	}
+
+	// The errors age out of the window: additive increase back to MaxRate
+	time.Sleep(150 * time.Millisecond)
+	passive.RecordSuccess(backend)
+	rates = rates[:0]
+	for i := 0; i < 4; i++ {
+		al.adjust()
+		rates = append(rates, al.Rate())
+	}
+	if want := []float64{40, 70, 100, 100}; !slices.Equal(rates, want) {
+		t.Fatalf("expected rates %v while recovering, got %v", want, rates)
+	}
+}
+
+func TestAdaptiveLimiterThrottlesAtReducedRate(t *testing.T) {
+	var failing atomic.Bool
+	errorRate := func() float64 {
+		if failing.Load() {
+			return 1
+		}
+		return 0
+	}
+	al := NewAdaptiveLimiter(AdaptiveConfig{
+		Capacity:  1,
+		MaxRate:   1000,
+		MinRate:   1,
+		ErrorRate: errorRate,
+		Decrease:  0.001,
+		Interval:  time.Hour,
+	})
+	defer al.Close()
+
+	failing.Store(true)
+	al.adjust() // 1000/s -> the 1/s floor
+	al.Allow()  // spend the burst
+
+	// At 1/s the next token is ~1s away, not ~1ms
+	ok, retry := al.Allow()
+	if ok || retry < 500*time.Millisecond {
+		t.Fatalf("expected a throttled request at the reduced rate, got ok=%v retry=%v", ok, retry)
+	}
+}
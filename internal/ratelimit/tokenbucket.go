@@ -34,13 +34,7 @@ func (tb *TokenBucket) Allow() (ok bool, retryAfter time.Duration) {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
-	now := time.Now()
-	elapsed := now.Sub(tb.lastRefill).Seconds()
-	tb.tokens += elapsed * tb.rate
-	if tb.tokens > tb.capacity {
-		tb.tokens = tb.capacity
-	}
-	tb.lastRefill = now
+	tb.refill(time.Now())
 
 	if tb.tokens >= 1 {
 		tb.tokens--
@@ -52,3 +46,109 @@ func (tb *TokenBucket) Allow() (ok bool, retryAfter time.Duration) {
 	wait := time.Duration(deficit / tb.rate * float64(time.Second))
 	return false, wait
 }
+
+// Peek returns the current token count, refilled up to now, without
+// consuming one. It is negative while reservations are waiting on tokens.
+// For debugging and admin views; don't use it to decide whether to call
+// Allow, as another caller may take the token in between.
+func (tb *TokenBucket) Peek() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill(time.Now())
+	return tb.tokens
+}
+
+// SetRate changes the sustained rate. Tokens earned so far are credited at
+// the old rate first, so the change only applies from now on.
+func (tb *TokenBucket) SetRate(rate float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill(time.Now())
+	tb.rate = rate
+}
+
+// Rate returns the current sustained rate in tokens per second.
+func (tb *TokenBucket) Rate() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.rate
+}
+
+// Reservation is a token taken from a TokenBucket ahead of time, as by
+// golang.org/x/time/rate. Wait Delay() before acting on it, or Cancel it
+// to hand the token back.
+type Reservation struct {
+	tb        *TokenBucket
+	ok        bool
+	timeToAct time.Time
+	canceled  bool // guarded by tb.mu
+}
+
+// Reserve takes a token now, even if the bucket is empty: the token is then
+// borrowed from future refills and Delay says how long until it is earned.
+// Later Allow and Reserve calls queue up behind it, so nothing is spent
+// twice. If the bucket can never supply a token (zero rate and empty), the
+// reservation is not OK and takes nothing.
+func (tb *TokenBucket) Reserve() *Reservation {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.refill(now)
+
+	if tb.tokens < 1 && tb.rate <= 0 {
+		return &Reservation{tb: tb}
+	}
+	tb.tokens--
+	r := &Reservation{tb: tb, ok: true, timeToAct: now}
+	if tb.tokens < 0 {
+		r.timeToAct = now.Add(time.Duration(-tb.tokens / tb.rate * float64(time.Second)))
+	}
+	return r
+}
+
+// OK reports whether the reservation holds a token. Delay is meaningless
+// when it doesn't.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay is how long to wait before acting on the reservation; zero means
+// the token is available now.
+func (r *Reservation) Delay() time.Duration {
+	return max(time.Until(r.timeToAct), 0)
+}
+
+// Cancel returns the token to the bucket, for a reservation the caller
+// decided not to use. Only the first call has any effect, and only before
+// the reservation's time to act: from then on the caller may have acted on
+// it, so handing the token back could spend it twice.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+	tb := r.tb
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	if r.canceled || !r.timeToAct.After(now) {
+		return
+	}
+	r.canceled = true
+	tb.refill(now)
+	tb.tokens = min(tb.tokens+1, tb.capacity)
+}
+
+// refill adds the tokens earned since the last refill, capped at capacity.
+// Callers must hold tb.mu.
+func (tb *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(tb.lastRefill).Seconds()
+	tb.tokens += elapsed * tb.rate
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+	tb.lastRefill = now
+}
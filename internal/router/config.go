@@ -1,61 +1,447 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
-// RouteConfig defines a single route in the YAML config.
+// RouteConfig defines a single route in the config file (YAML or JSON).
 type RouteConfig struct {
-	Path     string            `yaml:"path"`
-	Headers  map[string]string `yaml:"headers,omitempty"`
-	Backends []string          `yaml:"backends"`
+	Path      string            `yaml:"path,omitempty" json:"path,omitempty"`
+	PathRegex string            `yaml:"path_regex,omitempty" json:"path_regex,omitempty"` // alternative to path; must match the whole request path and start with a literal "/"
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Backends  []string          `yaml:"backends,omitempty" json:"backends,omitempty"`
+
+	// WeightedBackends is an alternative to Backends for weighted balancing.
+	// A route uses one or the other, not both.
+	WeightedBackends []WeightedBackendConfig `yaml:"weighted_backends,omitempty" json:"weighted_backends,omitempty"`
+
+	// Timeout overrides the proxy's default upstream timeout (e.g. "2s", "120s").
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	// Default marks the catch-all route, matched only when no other route
+	// does, regardless of path length. At most one route may be the default.
+	// Its path is optional and not used for matching.
+	Default bool `yaml:"default,omitempty" json:"default,omitempty"`
+
+	// RateLimit throttles each client on this route separately from every
+	// other route. Nil means the route has no limit of its own.
+	RateLimit *RateLimitConfig `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+
+	// Rewrite changes the path sent to the backend. Nil forwards the
+	// request path as is.
+	Rewrite *RewriteConfig `yaml:"rewrite,omitempty" json:"rewrite,omitempty"`
+}
+
+// RateLimitConfig is a per-client token bucket: up to Burst requests at
+// once, refilled at Rate requests per Per (e.g. rate 5, per "1m").
+type RateLimitConfig struct {
+	Burst int     `yaml:"burst" json:"burst"`
+	Rate  float64 `yaml:"rate" json:"rate"`
+	Per   string  `yaml:"per,omitempty" json:"per,omitempty"` // duration; default "1s"
 }
 
-// GatewayConfig is the top-level YAML configuration.
+// perSecond returns the refill rate in tokens per second.
+// Assumes the config has been validated.
+func (rl RateLimitConfig) perSecond() float64 {
+	per := time.Second
+	if rl.Per != "" {
+		per, _ = time.ParseDuration(rl.Per)
+	}
+	return rl.Rate / per.Seconds()
+}
+
+// WeightedBackendConfig is a backend address with a relative weight.
+// Weight 0 defaults to 1 (matching lb.NewWeightedRoundRobin).
+type WeightedBackendConfig struct {
+	Addr   string `yaml:"addr" json:"addr"`
+	Weight int    `yaml:"weight" json:"weight"`
+}
+
+// GatewayConfig is the top-level configuration.
 type GatewayConfig struct {
-	Routes []RouteConfig `yaml:"routes"`
+	Routes []RouteConfig `yaml:"routes" json:"routes"`
+
+	// StrictPrefix makes path prefixes match whole segments only: "/api"
+	// matches "/api" and "/api/users" but not "/apiary". Off by default,
+	// where a path is a plain string prefix. Templates always match whole
+	// segments and path_regex the whole path, so neither is affected.
+	// Only the top-level file's setting counts, not included files'.
+	StrictPrefix bool `yaml:"strict_prefix,omitempty" json:"strict_prefix,omitempty"`
+
+	// Include lists more config files whose routes are appended to this
+	// one's, e.g. ["teams/payments.yaml", "routes.d/*.yaml"]. Paths are
+	// relative to the including file and may be globs. Only honoured by
+	// LoadConfig; cleared once resolved.
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
 }
 
-// LoadConfig reads and parses a YAML config file.
+// Config file formats understood by LoadConfig and ParseConfig.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// LoadConfig reads and parses a config file. The format is chosen by
+// extension (.json, or .yaml/.yml); other extensions are sniffed by content.
+//
+// Included files (see GatewayConfig.Include) are loaded recursively and
+// their routes merged before validation. The same route defined in two
+// different files is an error naming both.
 func LoadConfig(path string) (*GatewayConfig, error) {
+	cfg, _, err := loadConfig(path)
+	return cfg, err
+}
+
+// loadConfig is LoadConfig, also returning the files it read, so the
+// HotReloader can watch all of them. The files are returned even on error,
+// as far as loading got, so fixing the broken one is noticed.
+func loadConfig(path string) (*GatewayConfig, *configFiles, error) {
+	files := &configFiles{modTimes: make(map[string]time.Time), globs: make(map[string][]string)}
+	cfg, sources, err := loadConfigFile(path, make(map[string]bool), files)
+	if err != nil {
+		return nil, files, err
+	}
+
+	seen := make(map[string]int) // route identity -> index of first occurrence
+	for i, route := range cfg.Routes {
+		if route.Default {
+			continue
+		}
+		key := route.identity()
+		if first, dup := seen[key]; dup && sources[first] != sources[i] {
+			return nil, files, fmt.Errorf("route %s in %s duplicates the same route in %s", route.pattern(), sources[i], sources[first])
+		} else if !dup {
+			seen[key] = i
+		}
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		return nil, files, err
+	}
+	return cfg, files, nil
+}
+
+// configFiles is what a config load read: each file with the mtime it had
+// just before it was read (zero if it couldn't be), and each include
+// pattern with the files it matched.
+type configFiles struct {
+	modTimes map[string]time.Time
+	globs    map[string][]string
+}
+
+// changed reports whether a file was modified, created, or removed since
+// the load, or an include pattern now matches different files.
+func (f *configFiles) changed() bool {
+	for path, modTime := range f.modTimes {
+		if !statModTime(path).Equal(modTime) {
+			return true
+		}
+	}
+	for pattern, matches := range f.globs {
+		if now, _ := filepath.Glob(pattern); !slices.Equal(now, matches) {
+			return true
+		}
+	}
+	return false
+}
+
+// statModTime returns path's mtime, or zero if it can't be stat'ed.
+func statModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// loadConfigFile parses path and, depth first, everything it includes,
+// recording each file and include pattern in files. sources[i] is the
+// file cfg.Routes[i] came from. visiting holds the absolute paths on the
+// current include chain, to catch cycles.
+func loadConfigFile(path string, visiting map[string]bool, files *configFiles) (cfg *GatewayConfig, sources []string, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read config: %w", err)
+	}
+	if visiting[abs] {
+		return nil, nil, fmt.Errorf("config %s: include cycle", path)
+	}
+	visiting[abs] = true
+	defer delete(visiting, abs)
+
+	files.modTimes[path] = statModTime(path) // before reading, so a later write is never missed
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("read config: %w", err)
+		return nil, nil, fmt.Errorf("read config: %w", err)
+	}
+
+	format := sniffFormat(data)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		format = FormatJSON
+	case ".yaml", ".yml":
+		format = FormatYAML
 	}
-	return ParseConfig(data)
+	cfg, err = decodeConfig(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sources = make([]string, len(cfg.Routes))
+	for i := range sources {
+		sources[i] = path
+	}
+
+	includes := cfg.Include
+	cfg.Include = nil
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config %s: include %q: %w", path, pattern, err)
+		}
+		files.globs[pattern] = matches
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return nil, nil, fmt.Errorf("config %s: include %q: file not found", path, pattern)
+		}
+		for _, match := range matches {
+			sub, subSources, err := loadConfigFile(match, visiting, files)
+			if err != nil {
+				return nil, nil, err
+			}
+			cfg.Routes = append(cfg.Routes, sub.Routes...)
+			sources = append(sources, subSources...)
+		}
+	}
+	return cfg, sources, nil
 }
 
-// ParseConfig parses YAML bytes into a GatewayConfig.
+// hasGlobMeta reports whether pattern contains filepath.Match metacharacters.
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// ParseConfig parses config bytes into a GatewayConfig. JSON is detected
+// by a leading '{' (after whitespace); anything else is parsed as YAML.
 func ParseConfig(data []byte) (*GatewayConfig, error) {
-	var cfg GatewayConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parse config: %w", err)
+	return ParseConfigFormat(data, sniffFormat(data))
+}
+
+// ParseConfigFormat parses config bytes in the given format
+// (FormatYAML or FormatJSON) and validates the result. ${VAR} and
+// ${VAR:-default} references are expanded from the environment first;
+// write $$ for a literal "$".
+//
+// Include needs a file to resolve paths against, so it is rejected here;
+// use LoadConfig.
+func ParseConfigFormat(data []byte, format string) (*GatewayConfig, error) {
+	cfg, err := decodeConfig(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Include) > 0 {
+		return nil, fmt.Errorf("parse config: include is only supported when loading from a file")
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
 	}
 
-	if err := validateConfig(&cfg); err != nil {
+	return cfg, nil
+}
+
+// decodeConfig expands environment variables and unmarshals, without validating.
+func decodeConfig(data []byte, format string) (*GatewayConfig, error) {
+	data, err := expandEnv(data)
+	if err != nil {
 		return nil, err
 	}
 
+	var cfg GatewayConfig
+	switch format {
+	case FormatJSON:
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parse config (json): %w", err)
+		}
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parse config: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("parse config: unknown format %q", format)
+	}
 	return &cfg, nil
 }
 
+// sniffFormat guesses the config format from its content.
+func sniffFormat(data []byte) string {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
 // validateConfig checks that the config is semantically valid.
 func validateConfig(cfg *GatewayConfig) error {
 	if len(cfg.Routes) == 0 {
 		return fmt.Errorf("config must have at least one route")
 	}
 
+	defaultIdx := -1
+	seen := make(map[string]int) // route identity -> index of first occurrence
 	for i, route := range cfg.Routes {
-		if route.Path == "" {
+		if route.Default {
+			if defaultIdx >= 0 {
+				return fmt.Errorf("route %d: only one default route is allowed (route %d is already the default)", i, defaultIdx)
+			}
+			defaultIdx = i
+			if route.PathRegex != "" || len(route.Headers) > 0 {
+				return fmt.Errorf("route %d: default route matches everything and cannot set path_regex or headers", i)
+			}
+		}
+		if route.Path != "" && route.PathRegex != "" {
+			return fmt.Errorf("route %d: path and path_regex are mutually exclusive", i)
+		}
+		if route.Path == "" && route.PathRegex == "" && !route.Default {
 			return fmt.Errorf("route %d: path cannot be empty", i)
 		}
-		if len(route.Backends) == 0 {
-			return fmt.Errorf("route %d (%s): must have at least one backend", i, route.Path)
+		if route.PathRegex != "" {
+			if _, err := compilePathRegex(route.PathRegex); err != nil {
+				return fmt.Errorf("route %d (%s): invalid path_regex: %w", i, route.PathRegex, err)
+			}
+			// Routes are ordered by literal prefix, so one without any would
+			// sort after, and be shadowed by, a prefix route for "/"
+			if pathRegexLiteral(route.PathRegex) == "" {
+				return fmt.Errorf("route %d (%s): path_regex must start with a literal \"/\", e.g. /(a|b)/c rather than (/a|/b)/c", i, route.PathRegex)
+			}
+		}
+		if isPathTemplate(route.Path) {
+			if _, err := compilePathTemplate(route.Path); err != nil {
+				return fmt.Errorf("route %d: invalid path template: %w", i, err)
+			}
+		}
+		if len(route.Backends) > 0 && len(route.WeightedBackends) > 0 {
+			return fmt.Errorf("route %d (%s): backends and weighted_backends are mutually exclusive", i, route.pattern())
+		}
+		if len(route.Backends) == 0 && len(route.WeightedBackends) == 0 {
+			return fmt.Errorf("route %d (%s): must have at least one backend", i, route.pattern())
+		}
+		if route.Timeout != "" {
+			d, err := time.ParseDuration(route.Timeout)
+			if err != nil {
+				return fmt.Errorf("route %d (%s): invalid timeout: %w", i, route.pattern(), err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("route %d (%s): timeout must be positive", i, route.pattern())
+			}
+		}
+		if rl := route.RateLimit; rl != nil {
+			if rl.Burst <= 0 {
+				return fmt.Errorf("route %d (%s): rate_limit burst must be positive", i, route.pattern())
+			}
+			if rl.Rate <= 0 {
+				return fmt.Errorf("route %d (%s): rate_limit rate must be positive", i, route.pattern())
+			}
+			if rl.Per != "" {
+				d, err := time.ParseDuration(rl.Per)
+				if err != nil {
+					return fmt.Errorf("route %d (%s): invalid rate_limit per: %w", i, route.pattern(), err)
+				}
+				if d <= 0 {
+					return fmt.Errorf("route %d (%s): rate_limit per must be positive", i, route.pattern())
+				}
+			}
+		}
+		if route.Rewrite != nil {
+			if _, err := compileRewrite(*route.Rewrite); err != nil {
+				return fmt.Errorf("route %d (%s): invalid rewrite: %w", i, route.pattern(), err)
+			}
+		}
+		for j, wb := range route.WeightedBackends {
+			if wb.Addr == "" {
+				return fmt.Errorf("route %d (%s): weighted backend %d: addr cannot be empty", i, route.pattern(), j)
+			}
+			if wb.Weight < 0 {
+				return fmt.Errorf("route %d (%s): weighted backend %d (%s): weight cannot be negative", i, route.pattern(), j, wb.Addr)
+			}
+		}
+
+		if !route.Default {
+			key := route.identity()
+			if first, dup := seen[key]; dup {
+				return fmt.Errorf("route %d (%s): duplicate of route %d (same path and headers)", i, route.pattern(), first)
+			}
+			seen[key] = i
 		}
 	}
 
 	return nil
 }
+
+// pattern returns the configured path or path_regex, for error messages.
+func (rc RouteConfig) pattern() string {
+	if rc.PathRegex != "" {
+		return rc.PathRegex
+	}
+	if rc.Path == "" && rc.Default {
+		return "default"
+	}
+	return rc.Path
+}
+
+// identity returns a key that is equal for two routes exactly when they
+// match the same requests: same path (ignoring a trailing wildcard, as the
+// router does) or path_regex, and the same header requirements.
+func (rc RouteConfig) identity() string {
+	var b strings.Builder
+	if rc.PathRegex != "" {
+		b.WriteString("regex:" + rc.PathRegex)
+	} else {
+		path := strings.TrimSuffix(rc.Path, "/*")
+		path = strings.TrimSuffix(path, "*")
+		b.WriteString("path:" + path)
+	}
+
+	pairs := make([]string, 0, len(rc.Headers))
+	for k, v := range rc.Headers {
+		pairs = append(pairs, http.CanonicalHeaderKey(k)+"="+v)
+	}
+	sort.Strings(pairs)
+	for _, p := range pairs {
+		b.WriteString("\x00" + p)
+	}
+	return b.String()
+}
+
+// compilePathRegex compiles a path_regex anchored at both ends, so it must
+// match the entire request path rather than any substring of it.
+func compilePathRegex(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+// pathRegexLiteral returns the literal prefix every path a compiled
+// path_regex matches starts with. It asks the unanchored expression: the
+// anchored one only reports a prefix when it compiles to a one-pass
+// program, so "/files/(.+)\.pdf" would get none.
+func pathRegexLiteral(expr string) string {
+	re, err := regexp.Compile("(?:" + expr + ")")
+	if err != nil {
+		return ""
+	}
+	prefix, _ := re.LiteralPrefix()
+	return prefix
+}
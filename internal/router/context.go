@@ -0,0 +1,38 @@
+package router
+
+import "context"
+
+// routeKey is the context key for the matched route.
+type routeKey struct{}
+
+// paramsKey is the context key for captured path parameters.
+type paramsKey struct{}
+
+// WithRoute stores the matched route in the context so downstream
+// handlers (proxy, metrics, rate limiting) can read per-route settings.
+func WithRoute(ctx context.Context, route *Route) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// RouteFrom retrieves the matched route from context.
+// Returns nil if no route was stored.
+func RouteFrom(ctx context.Context) *Route {
+	if route, ok := ctx.Value(routeKey{}).(*Route); ok {
+		return route
+	}
+	return nil
+}
+
+// WithParams stores captured path parameters in the context.
+func WithParams(ctx context.Context, params Params) context.Context {
+	return context.WithValue(ctx, paramsKey{}, params)
+}
+
+// ParamsFrom retrieves captured path parameters from context.
+// Returns nil if none were stored.
+func ParamsFrom(ctx context.Context) Params {
+	if params, ok := ctx.Value(paramsKey{}).(Params); ok {
+		return params
+	}
+	return nil
+}
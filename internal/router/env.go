@@ -0,0 +1,69 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandEnv substitutes environment variables in raw config bytes:
+//
+//	${VAR}          value of VAR; error if VAR is unset
+//	${VAR:-default} value of VAR, or default if VAR is unset or empty
+//	$$              a literal "$"
+//
+// Any other "$" is left alone, so regexes like "^/v1$" need no escaping.
+func expandEnv(data []byte) ([]byte, error) {
+	if !bytes.ContainsRune(data, '$') {
+		return data, nil
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c != '$' || i+1 >= len(data) {
+			out.WriteByte(c)
+			continue
+		}
+
+		switch data[i+1] {
+		case '$':
+			out.WriteByte('$')
+			i++
+		case '{':
+			end := bytes.IndexByte(data[i+2:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("expand config: unterminated ${ at offset %d", i)
+			}
+			expr := string(data[i+2 : i+2+end])
+			value, err := lookupEnv(expr)
+			if err != nil {
+				return nil, err
+			}
+			out.WriteString(value)
+			i += 2 + end
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// lookupEnv resolves the inside of a ${...} reference.
+func lookupEnv(expr string) (string, error) {
+	name, def, hasDefault := strings.Cut(expr, ":-")
+	if name == "" {
+		return "", fmt.Errorf("expand config: empty variable name in ${%s}", expr)
+	}
+
+	value, ok := os.LookupEnv(name)
+	if hasDefault && value == "" {
+		return def, nil
+	}
+	if !ok {
+		return "", fmt.Errorf("expand config: environment variable %s is not set", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Params holds named path parameters captured by a route match,
+// e.g. {"id": "42"} for path "/users/{id}" and request "/users/42".
+type Params map[string]string
+
+// paramName matches valid parameter names inside {braces}.
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isPathTemplate reports whether path contains {name} parameters.
+func isPathTemplate(path string) bool {
+	return strings.Contains(path, "{")
+}
+
+// compilePathTemplate turns "/users/{id}/orders/{oid}" into a regex with
+// named groups. Each parameter matches exactly one path segment. Like plain
+// path routes, templates match by prefix: "/users/{id}" also matches
+// "/users/42/profile", but not "/users/42abc" -- a template always ends on
+// a segment boundary.
+func compilePathTemplate(path string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+
+	seen := make(map[string]bool)
+	rest := path
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.ContainsRune(rest, '}') {
+				return nil, fmt.Errorf("unmatched '}' in %q", path)
+			}
+			b.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		if strings.ContainsRune(rest[:open], '}') {
+			return nil, fmt.Errorf("unmatched '}' in %q", path)
+		}
+		b.WriteString(regexp.QuoteMeta(rest[:open]))
+
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed '{' in %q", path)
+		}
+		name := rest[open+1 : open+end]
+		if !paramName.MatchString(name) {
+			return nil, fmt.Errorf("invalid parameter name %q in %q", name, path)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate parameter %q in %q", name, path)
+		}
+		seen[name] = true
+
+		b.WriteString("(?P<" + name + ">[^/]+)")
+		rest = rest[open+end+1:]
+	}
+
+	if !strings.HasSuffix(path, "/") {
+		b.WriteString("(?:/|$)")
+	}
+	return regexp.Compile(b.String())
+}
+
+// captureParams extracts named groups from a regex match.
+// Returns nil if the regex has no named groups.
+func captureParams(re *regexp.Regexp, path string) Params {
+	if re.NumSubexp() == 0 {
+		return nil
+	}
+	names := re.SubexpNames()
+	var params Params
+	for i, value := range re.FindStringSubmatch(path) {
+		if i == 0 || names[i] == "" {
+			continue
+		}
+		if params == nil {
+			params = make(Params)
+		}
+		params[names[i]] = value
+	}
+	return params
+}
@@ -4,33 +4,43 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// HotReloader watches a config file and atomically swaps the router
-// when changes are detected.
+// HotReloader watches a config file, and every file it includes, and
+// atomically swaps the router when changes are detected.
 //
 // Uses polling (not fsnotify) for simplicity and cross-platform reliability.
+// A change is a new mtime on any file read at the last load, or an include
+// glob matching a different set of files (one added or removed).
 // The active router is stored in atomic.Value for lock-free reads.
 type HotReloader struct {
 	configPath string
 	interval   time.Duration
-	router     atomic.Value  // stores *Router
-	lastModTime time.Time
-	ctx        context.Context
-	cancel     context.CancelFunc
+	router     atomic.Value // stores *Router
+
+	mu       sync.Mutex   // serializes reloads (poller and signal handler)
+	files    *configFiles // what the last successful load read, for the poller
+	failed   *configFiles // what the last load read if it failed, else nil
+	onReload func(routes int, err error)
+	onSwap   func(*Router)
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewHotReloader creates a hot reloader that watches configPath and
 // polls for changes every interval.
 func NewHotReloader(configPath string, interval time.Duration) (*HotReloader, error) {
-	cfg, err := LoadConfig(configPath)
+	cfg, files, err := loadConfig(configPath)
 	if err != nil {
 		return nil, err
 	}
 
-	info, err := os.Stat(configPath)
+	r, err := New(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -38,14 +48,14 @@ func NewHotReloader(configPath string, interval time.Duration) (*HotReloader, er
 	ctx, cancel := context.WithCancel(context.Background())
 
 	hr := &HotReloader{
-		configPath:  configPath,
-		interval:    interval,
-		lastModTime: info.ModTime(),
-		ctx:         ctx,
-		cancel:      cancel,
+		configPath: configPath,
+		interval:   interval,
+		files:      files,
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 
-	hr.router.Store(New(cfg))
+	hr.router.Store(r)
 
 	go hr.watch()
 	return hr, nil
@@ -56,12 +66,13 @@ func (hr *HotReloader) Router() *Router {
 	return hr.router.Load().(*Router)
 }
 
-// Close stops the file watcher.
+// Close stops the file watcher and releases the active router.
 func (hr *HotReloader) Close() {
 	hr.cancel()
+	hr.Router().Close()
 }
 
-// watch polls the config file for changes.
+// watch polls the config files for changes.
 func (hr *HotReloader) watch() {
 	ticker := time.NewTicker(hr.interval)
 	defer ticker.Stop()
@@ -76,29 +87,125 @@ func (hr *HotReloader) watch() {
 	}
 }
 
-// checkAndReload checks if the config file changed and reloads if so.
-func (hr *HotReloader) checkAndReload() {
-	info, err := os.Stat(hr.configPath)
+// OnReload registers a callback invoked after every reload attempt with the
+// new route count on success, or the error that kept the old router active.
+// Useful for metrics and alerting (see observe.Metrics.RecordReload).
+func (hr *HotReloader) OnReload(fn func(routes int, err error)) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.onReload = fn
+}
+
+// OnSwap registers a callback invoked with the new router on each
+// successful reload, right before Router starts returning it, so state
+// derived from the routes (such as per-route balancers) is rebuilt on the
+// reload path and ready by the time requests see the router. Never called
+// for an invalid config. It runs while the reload holds its lock, so it
+// must not call Reload or the On* methods.
+func (hr *HotReloader) OnSwap(fn func(*Router)) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.onSwap = fn
+}
+
+// ReloadOnSignal triggers an immediate reload whenever one of sigs is
+// received (typically syscall.SIGHUP), so operators can apply a config
+// change with `kill -HUP` instead of waiting for the next poll. Mtime-based
+// polling keeps running alongside. Stops listening on Close.
+func (hr *HotReloader) ReloadOnSignal(sigs ...os.Signal) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sigs...)
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case sig := <-sigCh:
+				log.Printf("hot reload: received %s, reloading...", sig)
+				hr.Reload()
+			case <-hr.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Reload re-reads the config file unconditionally and swaps the router if
+// the new config is valid. On error the previous router stays active.
+func (hr *HotReloader) Reload() error {
+	hr.mu.Lock()
+	onReload := hr.onReload
+
+	routes, err := hr.reload()
+	hr.mu.Unlock()
+
 	if err != nil {
-		log.Printf("hot reload: cannot stat config: %v", err)
-		return
+		log.Printf("hot reload: invalid config, keeping old: %v", err)
+	}
+	if onReload != nil {
+		onReload(routes, err)
 	}
+	return err
+}
+
+// checkAndReload checks if any config file changed since the last good
+// load and reloads if so.
+//
+// A config that fails to load is retried every tick until it loads, since
+// it may have been read half-written, or depend on something other than
+// its files, such as an environment variable. Only the first failure of
+// each version is logged and reported to OnReload, so a broken config
+// isn't reported once per tick.
+func (hr *HotReloader) checkAndReload() {
+	hr.mu.Lock()
+	onReload := hr.onReload
 
-	if !info.ModTime().After(hr.lastModTime) {
+	if !hr.files.changed() {
+		hr.mu.Unlock()
 		return // no change
 	}
 
-	log.Printf("hot reload: config file changed, reloading...")
+	retry := hr.failed != nil && !hr.failed.changed()
+	if !retry {
+		log.Printf("hot reload: config file changed, reloading...")
+	}
+	routes, err := hr.reload()
+	hr.mu.Unlock()
 
-	cfg, err := LoadConfig(hr.configPath)
 	if err != nil {
+		if retry {
+			return // already reported
+		}
 		log.Printf("hot reload: invalid config, keeping old: %v", err)
-		return // keep running with old config
 	}
+	// Outside the lock so the callback may safely call back into hr
+	if onReload != nil {
+		onReload(routes, err)
+	}
+}
 
-	newRouter := New(cfg)
-	hr.router.Store(newRouter) // atomic swap
-	hr.lastModTime = info.ModTime()
+// reload loads, validates, and swaps in the config (must hold mu).
+// Returns the number of routes in the new config. On error the old router
+// stays active and the files read are kept in hr.failed.
+func (hr *HotReloader) reload() (int, error) {
+	cfg, files, err := loadConfig(hr.configPath)
+	if err != nil {
+		hr.failed = files
+		return 0, err // keep running with old config
+	}
+	newRouter, err := build(cfg, hr.Router())
+	if err != nil {
+		hr.failed = files
+		return 0, err
+	}
+	hr.files, hr.failed = files, nil
+
+	if hr.onSwap != nil {
+		hr.onSwap(newRouter) // prepare before publishing
+	}
+	old := hr.router.Swap(newRouter).(*Router) // atomic swap
+	old.closeExcept(newRouter)
 
 	log.Printf("hot reload: config reloaded successfully (%d routes)", len(cfg.Routes))
+	return len(cfg.Routes), nil
 }
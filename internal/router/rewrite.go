@@ -0,0 +1,96 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RewriteConfig rewrites the request path before it is sent to the backend,
+// e.g. from "/v1/users/(.*)" to "/users/$1". From is a regex that must match
+// the whole path; To may reference its groups as $1, $name, ${1}, or ${name}.
+// Paths From doesn't match are forwarded unchanged.
+//
+// In a config file ${...} is an environment variable, so write braced
+// references as $${name}.
+type RewriteConfig struct {
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+}
+
+// compileRewrite compiles rw.From and checks that every group rw.To
+// references exists.
+func compileRewrite(rw RewriteConfig) (*regexp.Regexp, error) {
+	if rw.From == "" {
+		return nil, fmt.Errorf("from cannot be empty")
+	}
+	if !strings.HasPrefix(rw.To, "/") {
+		return nil, fmt.Errorf("to must start with '/'")
+	}
+	re, err := compilePathRegex(rw.From)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range rewriteRefs(rw.To) {
+		if n, err := strconv.Atoi(ref); err == nil {
+			if n > re.NumSubexp() {
+				return nil, fmt.Errorf("to references $%d but from has %d groups", n, re.NumSubexp())
+			}
+			continue
+		}
+		if re.SubexpIndex(ref) < 0 {
+			return nil, fmt.Errorf("to references unknown group %q", ref)
+		}
+	}
+	return re, nil
+}
+
+// rewriteRefs returns the group references in a regexp.Expand template:
+// the name or number after each $ ("$1", "${id}"), skipping "$$".
+func rewriteRefs(template string) []string {
+	var refs []string
+	for {
+		i := strings.IndexByte(template, '$')
+		if i < 0 || i == len(template)-1 {
+			return refs
+		}
+		template = template[i+1:]
+		switch {
+		case template[0] == '$':
+			template = template[1:]
+		case template[0] == '{':
+			end := strings.IndexByte(template, '}')
+			if end < 0 {
+				return refs // Expand leaves an unterminated ${ as is
+			}
+			refs = append(refs, template[1:end])
+			template = template[end+1:]
+		default:
+			end := strings.IndexFunc(template, func(r rune) bool {
+				return r != '_' && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+			})
+			if end < 0 {
+				end = len(template)
+			}
+			if end > 0 {
+				refs = append(refs, template[:end])
+			}
+			template = template[end:]
+		}
+	}
+}
+
+// RewritePath returns the path to send to the backend: path rewritten by
+// the route's rewrite rule, or unchanged if it has none or it doesn't match.
+func (r *Route) RewritePath(path string) string {
+	if r.rewrite == nil {
+		return path
+	}
+	m := r.rewrite.FindStringSubmatchIndex(path)
+	if m == nil {
+		return path
+	}
+	return string(r.rewrite.ExpandString(nil, r.rewriteTo, path, m))
+}
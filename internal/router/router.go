@@ -1,89 +1,387 @@
 package router
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/lb"
+	"github.com/G1D0/Api-Gateway/internal/ratelimit"
 )
 
+// rateLimitStaleAfter is how long a client's per-route bucket is kept idle.
+const rateLimitStaleAfter = 10 * time.Minute
+
 // Route is a compiled route ready for matching.
 type Route struct {
-	Path     string            // prefix to match (e.g., "/api/users")
+	Path     string            // prefix or template to match (e.g., "/api/users", "/users/{id}"); empty for regex routes
+	Regex    *regexp.Regexp    // compiled path_regex or template; nil for plain prefix routes
 	Headers  map[string]string // headers that must match (all of them)
-	Backends []string
+	Backends []string          // backend addresses (also populated for weighted routes)
+
+	// WeightedBackends is set when the route was configured with
+	// weighted_backends; nil otherwise. Feed it to lb.NewWeightedRoundRobin.
+	WeightedBackends []lb.WeightedBackend
+
+	Timeout time.Duration // upstream timeout override; 0 means use the proxy default
+	Default bool          // catch-all route, matched after every other route
+
+	// RateLimit is the route's own per-client limiter, nil if the route
+	// sets no rate_limit. Applied by middleware.RouteRateLimit.
+	RateLimit *ratelimit.PerClient
+
+	// rewrite and rewriteTo implement RewritePath; rewrite is nil if the
+	// route has no rewrite rule.
+	rewrite   *regexp.Regexp
+	rewriteTo string
+
+	// pattern is the path, path_regex, or "default" as written in the
+	// config. Bounded-cardinality label for logs and metrics.
+	pattern string
+
+	// literal is the prefix every matching path must start with. For prefix
+	// routes it equals Path; for regex routes it is the regex's literal prefix.
+	// Used for sorting and as a cheap pre-check before running the regex.
+	literal string
+
+	// strict requires a prefix route's literal to end on a segment
+	// boundary of the path (see GatewayConfig.StrictPrefix).
+	strict bool
+}
+
+// Pattern returns the route's path or path_regex as written in the config
+// (e.g. "/users/{id}", "/api/*"), or "default" for an unnamed default route.
+// Unlike the request path, its cardinality is bounded by the config.
+func (r *Route) Pattern() string {
+	return r.pattern
 }
 
 // Router matches incoming requests to routes based on path and headers.
 //
 // Matching rules:
-//  1. Path is matched by prefix (longest prefix wins)
+//  1. Path is matched by prefix (longest prefix wins; whole segments only
+//     with strict_prefix), or by a full-path regex
 //  2. If a route specifies headers, ALL must match
 //  3. Routes with headers are checked before routes without (more specific first)
-//  4. If no route matches, returns nil
+//  4. If no route matches, the default route (if configured) is returned
+//  5. Otherwise returns nil
+//
+// Regex routes are ordered by the length of their literal prefix, so
+// "/users/\d+" sorts alongside prefix routes of length 7 ("/users/").
+// On a tie the regex route goes first: it matches a strict subset of
+// what the equal-length prefix route would, so putting it second would
+// make it unreachable. For the same reason a path_regex must have a
+// literal prefix of at least "/": with none it would sort last, behind any
+// prefix route for "/", so validation rejects it. Non-matching regex
+// routes cost only a HasPrefix.
+// Templates sharing a literal prefix ("/users/{id}", "/users/{id}/orders")
+// go longest first for the same reason, whatever their config order.
+//
+// Match doesn't scan every route: an index of literal prefixes (a byte
+// trie) narrows it to the routes whose literal prefixes the path, tried
+// in the same order, so matching cost follows path length rather than
+// the size of the config.
 type Router struct {
-	routes []Route // sorted: longest path first, header routes before non-header routes
+	routes   []Route      // sorted: longest literal first, regex before prefix, header routes before non-header routes
+	fallback *Route       // default route, nil if none configured
+	index    *literalTrie // routes by literal prefix
+
+	limiters map[string]*ratelimit.PerClient // route rate limiters by limiterKey
 }
 
-// New creates a router from config.
-func New(cfg *GatewayConfig) *Router {
-	routes := make([]Route, len(cfg.Routes))
-	for i, rc := range cfg.Routes {
+// New creates a router from config. It fails only on a route ParseConfig
+// would have rejected, such as a path_regex, path template, or rewrite.from
+// that doesn't compile.
+func New(cfg *GatewayConfig) (*Router, error) {
+	return build(cfg, nil)
+}
+
+// build creates a router from config, taking over prev's rate limiter for
+// every route whose identity and rate_limit are unchanged, so a reload
+// doesn't hand every client a fresh burst. prev may be nil.
+func build(cfg *GatewayConfig, prev *Router) (*Router, error) {
+	limiters := make(map[string]*ratelimit.PerClient)
+	var created []*ratelimit.PerClient // closed again if the config turns out invalid
+	fail := func(err error) (*Router, error) {
+		for _, rl := range created {
+			rl.Close()
+		}
+		return nil, err
+	}
+	routes := make([]Route, 0, len(cfg.Routes))
+	var fallback *Route
+	for _, rc := range cfg.Routes {
 		// Strip trailing wildcard for prefix matching
 		path := strings.TrimSuffix(rc.Path, "/*")
 		path = strings.TrimSuffix(path, "*")
 
-		routes[i] = Route{
+		routes = append(routes, Route{
 			Path:     path,
 			Headers:  rc.Headers,
 			Backends: rc.Backends,
+			Default:  rc.Default,
+			pattern:  rc.pattern(),
+			literal:  path,
+			strict:   cfg.StrictPrefix,
+		})
+		i := len(routes) - 1
+
+		if rc.Timeout != "" {
+			// Already validated by ParseConfig
+			routes[i].Timeout, _ = time.ParseDuration(rc.Timeout)
+		}
+
+		if rc.RateLimit != nil {
+			key := limiterKey(rc)
+			rl := prev.limiter(key)
+			if rl == nil {
+				rl = ratelimit.NewPerClient(rc.RateLimit.Burst, rc.RateLimit.perSecond(), rateLimitStaleAfter)
+				created = append(created, rl)
+			}
+			routes[i].RateLimit = rl
+			limiters[key] = rl
+		}
+
+		if rc.Rewrite != nil {
+			re, err := compileRewrite(*rc.Rewrite)
+			if err != nil {
+				return fail(fmt.Errorf("route %s: invalid rewrite: %w", rc.pattern(), err))
+			}
+			routes[i].rewrite = re
+			routes[i].rewriteTo = rc.Rewrite.To
+		}
+
+		if len(rc.WeightedBackends) > 0 {
+			routes[i].Backends = make([]string, len(rc.WeightedBackends))
+			routes[i].WeightedBackends = make([]lb.WeightedBackend, len(rc.WeightedBackends))
+			for j, wb := range rc.WeightedBackends {
+				routes[i].Backends[j] = wb.Addr
+				routes[i].WeightedBackends[j] = lb.WeightedBackend{Addr: wb.Addr, Weight: wb.Weight}
+			}
+		}
+
+		if rc.Default {
+			// Kept out of the sorted list: matches anything, checked last
+			def := routes[i]
+			fallback = &def
+			routes = routes[:i]
+			continue
+		}
+
+		if rc.PathRegex != "" {
+			re, err := compilePathRegex(rc.PathRegex)
+			if err != nil {
+				return fail(fmt.Errorf("route %s: invalid path_regex: %w", rc.pattern(), err))
+			}
+			routes[i].Path = ""
+			routes[i].Regex = re
+			routes[i].literal = pathRegexLiteral(rc.PathRegex)
+		} else if isPathTemplate(path) {
+			re, err := compilePathTemplate(path)
+			if err != nil {
+				return fail(fmt.Errorf("route %s: invalid path template: %w", rc.pattern(), err))
+			}
+			routes[i].Regex = re
+			routes[i].literal = path[:strings.IndexByte(path, '{')]
 		}
 	}
 
 	// Sort by specificity:
-	// 1. Longer paths first
-	// 2. Routes with headers before routes without (at same path length)
-	sort.Slice(routes, func(i, j int) bool {
-		if len(routes[i].Path) != len(routes[j].Path) {
-			return len(routes[i].Path) > len(routes[j].Path)
+	// 1. Longer literal prefixes first
+	// 2. Regex routes before prefix routes (at same length)
+	// 3. Templates with more segments before fewer (at same length)
+	// 4. Routes with headers before routes without (at same length)
+	sort.SliceStable(routes, func(i, j int) bool {
+		if len(routes[i].literal) != len(routes[j].literal) {
+			return len(routes[i].literal) > len(routes[j].literal)
+		}
+		if (routes[i].Regex != nil) != (routes[j].Regex != nil) {
+			return routes[i].Regex != nil
+		}
+		// Templates match by prefix, so "/users/{id}" would swallow
+		// "/users/42/orders" if tried before "/users/{id}/orders"
+		if si, sj := templateSegments(&routes[i]), templateSegments(&routes[j]); si != sj {
+			return si > sj
 		}
 		// Same length: routes with headers are more specific
 		return len(routes[i].Headers) > len(routes[j].Headers)
 	})
 
-	return &Router{routes: routes}
+	return &Router{routes: routes, fallback: fallback, index: newLiteralTrie(routes), limiters: limiters}, nil
+}
+
+// limiterKey is equal for two routes exactly when they match the same
+// requests with the same rate_limit, and so can share a limiter.
+func limiterKey(rc RouteConfig) string {
+	key := rc.identity()
+	if rc.Default {
+		key = "default"
+	}
+	return fmt.Sprintf("%s\x00rl:%d/%g", key, rc.RateLimit.Burst, rc.RateLimit.perSecond())
+}
+
+// limiter returns the rate limiter stored under key, or nil (also for a
+// nil router).
+func (r *Router) limiter(key string) *ratelimit.PerClient {
+	if r == nil {
+		return nil
+	}
+	return r.limiters[key]
+}
+
+// templateSegments returns the number of path segments in a template
+// route ("/users/{id}/orders" has 3), or 0 for other routes.
+func templateSegments(route *Route) int {
+	if route.Regex == nil || route.Path == "" {
+		return 0
+	}
+	return strings.Count(strings.Trim(route.Path, "/"), "/") + 1
+}
+
+// Routes returns a copy of the routes in the order Match tries them,
+// with the default route (if any) last.
+func (r *Router) Routes() []Route {
+	routes := append([]Route(nil), r.routes...)
+	if r.fallback != nil {
+		routes = append(routes, *r.fallback)
+	}
+	return routes
+}
+
+// Each calls fn for every route in match order, the default route (if any)
+// last. Unlike Routes, fn gets the same pointers Match returns, so callers
+// can key per-route state (such as a balancer) on them.
+func (r *Router) Each(fn func(*Route)) {
+	for i := range r.routes {
+		fn(&r.routes[i])
+	}
+	if r.fallback != nil {
+		fn(r.fallback)
+	}
+}
+
+// Close releases the routes' rate limiters. Requests still holding a route
+// from this router keep working; their limiters just stop garbage-collecting.
+func (r *Router) Close() {
+	r.closeExcept(nil)
+}
+
+// closeExcept is Close, but leaves the rate limiters next took over
+// running. next may be nil.
+func (r *Router) closeExcept(next *Router) {
+	kept := make(map[*ratelimit.PerClient]bool)
+	if next != nil {
+		for _, rl := range next.limiters {
+			kept[rl] = true
+		}
+	}
+	for _, rl := range r.limiters {
+		if !kept[rl] {
+			rl.Close()
+		}
+	}
 }
 
 // Match finds the best matching route for the request.
 // Returns nil if no route matches.
 func (r *Router) Match(req *http.Request) *Route {
+	route, _ := r.MatchWithParams(req)
+	return route
+}
+
+// MatchWithParams is like Match but also returns the named parameters
+// captured from the path by template routes ("/users/{id}") and by
+// path_regex routes with named groups. Params is nil when nothing was
+// captured.
+func (r *Router) MatchWithParams(req *http.Request) (*Route, Params) {
+	i := r.index.match(r, req, req.URL.Path, 0)
+	if i < 0 {
+		return r.fallback, nil
+	}
+	return withParams(&r.routes[i], req)
+}
+
+// matchLinear is MatchWithParams without the index: every route in order.
+// Kept as the reference the index must agree with.
+func (r *Router) matchLinear(req *http.Request) (*Route, Params) {
 	for i := range r.routes {
 		route := &r.routes[i]
 
-		// Check path prefix
-		if !strings.HasPrefix(req.URL.Path, route.Path) {
+		// Check path prefix (for regex routes, the literal prefix is a cheap pre-check)
+		if !strings.HasPrefix(req.URL.Path, route.literal) {
 			continue
 		}
-
-		// Check headers (all must match)
-		if !matchHeaders(req, route.Headers) {
-			continue
+		if r.matches(route, req) {
+			return withParams(route, req)
 		}
+	}
+	return r.fallback, nil
+}
 
-		return route
+// matches reports whether req matches route, given that the path starts
+// with route.literal.
+func (r *Router) matches(route *Route, req *http.Request) bool {
+	if route.Regex != nil && !route.Regex.MatchString(req.URL.Path) {
+		return false
+	}
+	if route.Regex == nil && route.strict && !segmentPrefix(req.URL.Path, route.literal) {
+		return false
 	}
-	return nil
+	// Check headers (all must match)
+	return matchHeaders(req, route.Headers)
+}
+
+// withParams returns route with the params it captures from req's path.
+func withParams(route *Route, req *http.Request) (*Route, Params) {
+	if route.Regex != nil {
+		return route, captureParams(route.Regex, req.URL.Path)
+	}
+	return route, nil
+}
+
+// segmentPrefix reports whether prefix, a prefix of path, ends on a segment
+// boundary: "/api" is one of "/api" and "/api/users" but not "/apiary".
+func segmentPrefix(path, prefix string) bool {
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
 }
 
 // matchHeaders returns true if all required headers are present and match.
+//
+// Required values support three forms:
+//   - "*"             presence check: header must exist, any value
+//   - "*.example.com" suffix wildcard: matches "a.example.com", not "example.com"
+//   - anything else   exact match
+//
+// Host is special-cased: Go moves it out of req.Header into req.Host, so we
+// fall back to req.Host and compare hostnames case-insensitively without the port.
 func matchHeaders(req *http.Request, required map[string]string) bool {
 	for key, value := range required {
 		got := req.Header.Get(key)
-		if value == "*" {
+		if http.CanonicalHeaderKey(key) == "Host" {
+			if got == "" {
+				got = req.Host
+			}
+			got = stripPort(strings.ToLower(got))
+			value = strings.ToLower(value)
+		}
+
+		switch {
+		case value == "*":
 			// Presence check: header must exist, any value
 			if got == "" {
 				return false
 			}
-		} else {
+		case strings.HasPrefix(value, "*."):
+			// Suffix wildcard: at least one label before the suffix
+			suffix := value[1:] // ".example.com"
+			if len(got) <= len(suffix) || !strings.HasSuffix(got, suffix) {
+				return false
+			}
+		default:
 			// Exact match
 			if got != value {
 				return false
@@ -92,3 +390,11 @@ func matchHeaders(req *http.Request, required map[string]string) bool {
 	}
 	return true
 }
+
+// stripPort removes a trailing ":port" from a host, handling IPv6 literals.
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -1,12 +1,20 @@
 package router
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/G1D0/Api-Gateway/internal/lb"
 )
 
 // --- Config Parsing ---
@@ -76,45 +84,977 @@ routes:
 	}
 }
 
-func TestParseConfigRejectsEmptyPath(t *testing.T) {
-	yaml := `
+func TestParseConfigRejectsEmptyPath(t *testing.T) {
+	yaml := `
+routes:
+  - path: ""
+    backends:
+      - http://localhost:8080
+`
+	_, err := ParseConfig([]byte(yaml))
+	if err == nil {
+		t.Fatal("should reject empty path")
+	}
+}
+
+func TestParseConfigWeightedBackends(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /api
+    weighted_backends:
+      - addr: http://big:8080
+        weight: 5
+      - addr: http://small:8080
+        weight: 1
+`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	route := mustNew(t, cfg).Match(httptest.NewRequest(http.MethodGet, "/api/x", nil))
+	if route == nil {
+		t.Fatal("expected match")
+	}
+	if len(route.Backends) != 2 || route.Backends[0] != "http://big:8080" {
+		t.Fatalf("Backends should list weighted addresses, got %v", route.Backends)
+	}
+	if route.WeightedBackends[0].Weight != 5 || route.WeightedBackends[1].Weight != 1 {
+		t.Fatalf("unexpected weights: %+v", route.WeightedBackends)
+	}
+
+	wrr := lb.NewWeightedRoundRobin(route.WeightedBackends)
+	counts := map[string]int{}
+	for i := 0; i < 600; i++ {
+		counts[wrr.Next()]++
+	}
+	if counts["http://big:8080"] != 500 || counts["http://small:8080"] != 100 {
+		t.Fatalf("expected 500/100 split, got %v", counts)
+	}
+}
+
+func TestParseConfigRejectsNegativeWeight(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+routes:
+  - path: /api
+    weighted_backends:
+      - addr: http://a:8080
+        weight: -1
+`))
+	if err == nil {
+		t.Fatal("should reject negative weight")
+	}
+}
+
+func TestParseConfigRejectsBothBackendForms(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+routes:
+  - path: /api
+    backends: ["http://a:8080"]
+    weighted_backends:
+      - addr: http://b:8080
+        weight: 1
+`))
+	if err == nil {
+		t.Fatal("should reject route with both backends and weighted_backends")
+	}
+}
+
+func TestParseConfigTimeout(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /reports
+    timeout: 120s
+    backends: ["http://reports:8080"]
+`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	route := mustNew(t, cfg).Match(httptest.NewRequest(http.MethodGet, "/reports", nil))
+	if route.Timeout != 120*time.Second {
+		t.Fatalf("expected 120s timeout, got %v", route.Timeout)
+	}
+
+	_, err = ParseConfig([]byte(`
+routes:
+  - path: /reports
+    timeout: soon
+    backends: ["http://reports:8080"]
+`))
+	if err == nil {
+		t.Fatal("should reject unparseable timeout")
+	}
+}
+
+func TestParseConfigRateLimit(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /login
+    backends: ["http://localhost:3001"]
+    rate_limit:
+      burst: 5
+      rate: 30
+      per: 1m
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rl := cfg.Routes[0].RateLimit
+	if rl == nil || rl.Burst != 5 || rl.Rate != 30 || rl.Per != "1m" {
+		t.Fatalf("unexpected rate_limit: %+v", rl)
+	}
+	if got := rl.perSecond(); got != 0.5 {
+		t.Fatalf("expected 0.5 tokens/sec, got %v", got)
+	}
+
+	r := mustNew(t, cfg)
+	defer r.Close()
+	if r.Match(httptest.NewRequest(http.MethodGet, "/login", nil)).RateLimit == nil {
+		t.Fatal("expected the compiled route to carry a limiter")
+	}
+}
+
+func TestParseConfigRejectsBadRateLimit(t *testing.T) {
+	for _, rl := range []string{
+		"{burst: 0, rate: 1}",
+		"{burst: 1, rate: -1}",
+		"{burst: 1, rate: 1, per: soon}",
+		"{burst: 1, rate: 1, per: 0s}",
+	} {
+		_, err := ParseConfig([]byte(`
+routes:
+  - path: /login
+    backends: ["http://localhost:3001"]
+    rate_limit: ` + rl + `
+`))
+		if err == nil || !strings.Contains(err.Error(), "rate_limit") {
+			t.Errorf("rate_limit %s: expected a rate_limit error, got %v", rl, err)
+		}
+	}
+}
+
+func TestParseConfigExpandsEnv(t *testing.T) {
+	t.Setenv("USERS_BACKEND", "http://users.staging:3001")
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /users
+    backends: ["${USERS_BACKEND}", "${ORDERS_BACKEND:-http://localhost:3002}"]
+    headers:
+      X-Price: "$$5"
+  - path_regex: "/v[0-9]+$"
+    backends: ["http://localhost:3003"]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"http://users.staging:3001", "http://localhost:3002"}
+	if !reflect.DeepEqual(cfg.Routes[0].Backends, want) {
+		t.Fatalf("expected backends %v, got %v", want, cfg.Routes[0].Backends)
+	}
+	if got := cfg.Routes[0].Headers["X-Price"]; got != "$5" {
+		t.Fatalf("expected $$ to become a literal $, got %q", got)
+	}
+	if got := cfg.Routes[1].PathRegex; got != "/v[0-9]+$" {
+		t.Fatalf("expected a lone $ to be left alone, got %q", got)
+	}
+}
+
+func TestParseConfigRejectsUnsetEnv(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+routes:
+  - path: /users
+    backends: ["${GATEWAY_TEST_UNSET_VAR}"]
+`))
+	if err == nil || !strings.Contains(err.Error(), "GATEWAY_TEST_UNSET_VAR") {
+		t.Fatalf("expected an error naming the unset variable, got %v", err)
+	}
+}
+
+func TestParseConfigJSONMatchesYAML(t *testing.T) {
+	yamlCfg, err := ParseConfig([]byte(`
+routes:
+  - path: /api/users
+    headers:
+      X-API-Version: v2
+    timeout: 5s
+    backends:
+      - http://localhost:8081
+  - path: /reports
+    weighted_backends:
+      - addr: http://localhost:8082
+        weight: 3
+`))
+	if err != nil {
+		t.Fatalf("yaml parse failed: %v", err)
+	}
+
+	jsonCfg, err := ParseConfig([]byte(`{
+  "routes": [
+    {
+      "path": "/api/users",
+      "headers": {"X-API-Version": "v2"},
+      "timeout": "5s",
+      "backends": ["http://localhost:8081"]
+    },
+    {
+      "path": "/reports",
+      "weighted_backends": [{"addr": "http://localhost:8082", "weight": 3}]
+    }
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("json parse failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(yamlCfg, jsonCfg) {
+		t.Fatalf("configs differ:\nyaml: %+v\njson: %+v", yamlCfg, jsonCfg)
+	}
+}
+
+func TestParseConfigJSONValidates(t *testing.T) {
+	_, err := ParseConfig([]byte(`{"routes": [{"path": "/api", "backends": []}]}`))
+	if err == nil {
+		t.Fatal("JSON config should go through the same validation")
+	}
+}
+
+func TestLoadConfigByExtension(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"routes": [{"path": "/api", "backends": ["http://a:8080"]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.Routes[0].Backends[0] != "http://a:8080" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+// writeFiles creates each name -> content under dir, making parent dirs.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"gateway.yaml": `
+include: ["routes.d/*.yaml"]
+routes:
+  - path: /api
+    backends: ["http://a:8080"]
+`,
+		"routes.d/payments.yaml": `
+routes:
+  - path: /payments
+    backends: ["http://payments:8080"]
+`,
+		"routes.d/users.json": `{"routes": [{"path": "/ignored", "backends": ["http://x:8080"]}]}`,
+		"routes.d/users.yaml": `
+routes:
+  - path: /users
+    backends: ["http://users:8080"]
+`,
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "gateway.yaml"))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	var paths []string
+	for _, r := range cfg.Routes {
+		paths = append(paths, r.Path)
+	}
+	// Parent routes first, then included files in lexical order
+	want := []string{"/api", "/payments", "/users"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("expected routes %v, got %v", want, paths)
+	}
+	if cfg.Include != nil {
+		t.Fatalf("expected include to be cleared after resolving, got %v", cfg.Include)
+	}
+}
+
+func TestLoadConfigRejectsCrossFileDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"gateway.yaml": `
+include: [team-a.yaml, team-b.yaml]
+routes: []
+`,
+		"team-a.yaml": `
+routes:
+  - path: /orders
+    backends: ["http://a:8080"]
+`,
+		"team-b.yaml": `
+routes:
+  - path: /orders/*
+    backends: ["http://b:8080"]
+`,
+	})
+
+	_, err := LoadConfig(filepath.Join(dir, "gateway.yaml"))
+	if err == nil {
+		t.Fatal("expected an error for a route defined in two files")
+	}
+	if !strings.Contains(err.Error(), "team-a.yaml") || !strings.Contains(err.Error(), "team-b.yaml") {
+		t.Fatalf("expected the error to name both files, got %v", err)
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"missing.yaml": "include: [nope.yaml]\nroutes: []\n",
+		"loop-a.yaml":  "include: [loop-b.yaml]\nroutes: []\n",
+		"loop-b.yaml":  "include: [loop-a.yaml]\nroutes: []\n",
+	})
+
+	if _, err := LoadConfig(filepath.Join(dir, "missing.yaml")); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing include: expected not found error, got %v", err)
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "loop-a.yaml")); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("include loop: expected cycle error, got %v", err)
+	}
+	if _, err := ParseConfig([]byte("include: [x.yaml]\nroutes: []\n")); err == nil {
+		t.Error("ParseConfig: expected include to be rejected without a file")
+	}
+}
+
+func TestParseConfigRejectsDuplicateRoutes(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+routes:
+  - path: /api
+    headers:
+      X-API-Version: v2
+    backends: ["http://a:8080"]
+  - path: /web
+    backends: ["http://web:8080"]
+  - path: /api
+    headers:
+      x-api-version: v2
+    backends: ["http://b:8080"]
+`))
+	if err == nil {
+		t.Fatal("should reject duplicate path + headers")
+	}
+	if !strings.Contains(err.Error(), "route 2") || !strings.Contains(err.Error(), "route 0") {
+		t.Fatalf("error should name both route indices, got: %v", err)
+	}
+}
+
+func TestParseConfigAllowsSamePathDifferentHeaders(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+routes:
+  - path: /api
+    headers:
+      X-API-Version: v2
+    backends: ["http://v2:8080"]
+  - path: /api
+    headers:
+      X-API-Version: v3
+    backends: ["http://v3:8080"]
+  - path: /api
+    backends: ["http://v1:8080"]
+`))
+	if err != nil {
+		t.Fatalf("header-differentiated routes should be allowed: %v", err)
+	}
+}
+
+// --- Path-Based Routing ---
+
+func TestRouterMatchesLongestPrefix(t *testing.T) {
+	cfg, _ := ParseConfig([]byte(`
+routes:
+  - path: /api/users
+    backends: ["http://users:8080"]
+  - path: /api
+    backends: ["http://api:8080"]
+  - path: /
+    backends: ["http://default:8080"]
+`))
+	r := mustNew(t, cfg)
+
+	tests := []struct {
+		path        string
+		wantBackend string
+	}{
+		{"/api/users/123", "http://users:8080"},
+		{"/api/orders/456", "http://api:8080"},
+		{"/static/file.js", "http://default:8080"},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		route := r.Match(req)
+		if route == nil {
+			t.Fatalf("path %s: expected match, got nil", tc.path)
+		}
+		if route.Backends[0] != tc.wantBackend {
+			t.Errorf("path %s: expected %s, got %s", tc.path, tc.wantBackend, route.Backends[0])
+		}
+	}
+}
+
+func TestRouterWildcard(t *testing.T) {
+	cfg, _ := ParseConfig([]byte(`
+routes:
+  - path: /api/users/*
+    backends: ["http://users:8080"]
+`))
+	r := mustNew(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/123/profile", nil)
+	route := r.Match(req)
+	if route == nil {
+		t.Fatal("expected match for wildcard route")
+	}
+}
+
+func TestRouterNoMatch(t *testing.T) {
+	cfg, _ := ParseConfig([]byte(`
+routes:
+  - path: /api
+    backends: ["http://api:8080"]
+`))
+	r := mustNew(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/other/path", nil)
+	route := r.Match(req)
+	if route != nil {
+		t.Fatal("expected nil for unmatched path")
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - default: true
+    backends: ["http://default:8080"]
+  - path: /api/users/*
+    backends: ["http://users:8080"]
+  - path_regex: /v[0-9]+/items
+    backends: ["http://items:8080"]
+`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	r := mustNew(t, cfg)
+
+	tests := map[string]string{
+		"/api/users/42": "/api/users/*",
+		"/v2/items":     "/v[0-9]+/items",
+		"/elsewhere":    "default",
+	}
+	for path, want := range tests {
+		route := r.Match(httptest.NewRequest(http.MethodGet, path, nil))
+		if route == nil {
+			t.Fatalf("path %s: expected match, got nil", path)
+		}
+		if route.Pattern() != want {
+			t.Errorf("path %s: expected pattern %q, got %q", path, want, route.Pattern())
+		}
+	}
+}
+
+func TestRouterStrictPrefixMatchesWholeSegments(t *testing.T) {
+	config := func(strict bool) *Router {
+		t.Helper()
+		cfg, err := ParseConfig([]byte(fmt.Sprintf(`
+strict_prefix: %v
+routes:
+  - path: /api
+    backends: ["http://api:8080"]
+  - path: /static/*
+    backends: ["http://static:8080"]
+  - path: /
+    backends: ["http://root:8080"]
+`, strict)))
+		if err != nil {
+			t.Fatalf("ParseConfig: %v", err)
+		}
+		return mustNew(t, cfg)
+	}
+
+	tests := []struct {
+		path          string
+		strict, loose string
+	}{
+		{"/api", "/api", "/api"},
+		{"/api/", "/api", "/api"},
+		{"/api/users", "/api", "/api"},
+		{"/apiary", "/", "/api"},
+		{"/static/app.js", "/static/*", "/static/*"},
+		{"/static", "/static/*", "/static/*"},
+		{"/staticky", "/", "/static/*"},
+	}
+	strict, loose := config(true), config(false)
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if got := patternOf(strict.Match(req)); got != tc.strict {
+			t.Errorf("strict %s: expected %s, got %s", tc.path, tc.strict, got)
+		}
+		if got := patternOf(loose.Match(req)); got != tc.loose {
+			t.Errorf("loose %s: expected %s, got %s", tc.path, tc.loose, got)
+		}
+		if route, _ := strict.matchLinear(req); patternOf(route) != tc.strict {
+			t.Errorf("strict linear %s: expected %s, got %s", tc.path, tc.strict, patternOf(route))
+		}
+	}
+}
+
+// mustNew builds a router from a parsed config.
+func mustNew(t testing.TB, cfg *GatewayConfig) *Router {
+	t.Helper()
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+// manyRoutes builds a router with n services, each with a prefix route, a
+// template route, and a header-gated canary route, plus a catch-all.
+func manyRoutes(t testing.TB, n int) *Router {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("routes:\n")
+	for i := range n {
+		fmt.Fprintf(&b, "  - path: /svc%d/*\n    backends: [\"http://svc%d:8080\"]\n", i, i)
+		fmt.Fprintf(&b, "  - path: /svc%d/items/{id}\n    backends: [\"http://svc%d-items:8080\"]\n", i, i)
+		fmt.Fprintf(&b, "  - path: /svc%d/*\n    headers: {X-Canary: \"true\"}\n    backends: [\"http://svc%d-canary:8080\"]\n", i, i)
+	}
+	b.WriteString("  - path: /\n    backends: [\"http://root:8080\"]\n")
+	cfg, err := ParseConfig([]byte(b.String()))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	return mustNew(t, cfg)
+}
+
+func TestRouterIndexAgreesWithLinearScan(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /api
+    backends: ["http://api:8080"]
+  - path: /api/users
+    backends: ["http://users:8080"]
+  - path: /api/users
+    headers: {X-Version: "2"}
+    backends: ["http://users-v2:8080"]
+  - path: /api/users/{id}
+    backends: ["http://user:8080"]
+  - path_regex: /api/users/\\d+/orders
+    backends: ["http://orders:8080"]
+  - path_regex: /(img|css)/.*
+    backends: ["http://static:8080"]
+  - path: /apiary
+    backends: ["http://bees:8080"]
+  - default: true
+    backends: ["http://fallback:8080"]
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	routers := map[string]*Router{"mixed": mustNew(t, cfg), "many": manyRoutes(t, 50)}
+
+	paths := []string{
+		"/", "", "/a", "/api", "/apix", "/api/", "/api/users", "/api/users/", "/api/users/7",
+		"/api/users/7/orders", "/api/users/x/orders", "/apiary/hive", "/img/a.png", "/css/",
+		"/nope", "/svc7", "/svc7/", "/svc7/items/3", "/svc49/items/3/x", "/svc4/items", "/svc50/",
+	}
+	for name, rt := range routers {
+		for _, path := range paths {
+			for _, headers := range []map[string]string{nil, {"X-Version": "2"}, {"X-Canary": "true"}} {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.URL.Path = path
+				for k, v := range headers {
+					req.Header.Set(k, v)
+				}
+				gotRoute, gotParams := rt.MatchWithParams(req)
+				wantRoute, wantParams := rt.matchLinear(req)
+				if gotRoute != wantRoute || !reflect.DeepEqual(gotParams, wantParams) {
+					t.Errorf("%s: %q %v: index matched %v %v, linear scan %v %v",
+						name, path, headers, patternOf(gotRoute), gotParams, patternOf(wantRoute), wantParams)
+				}
+			}
+		}
+	}
+}
+
+// patternOf is route.Pattern(), or "<nil>" for no route.
+func patternOf(route *Route) string {
+	if route == nil {
+		return "<nil>"
+	}
+	return route.Pattern()
+}
+
+func BenchmarkRouterMatch(b *testing.B) {
+	rt := manyRoutes(b, 1000) // 3,001 routes
+	for _, bc := range []struct{ path, want string }{
+		{"/svc500/static/app.js", "/svc500/*"},
+		{"/svc500/items/42", "/svc500/items/{id}"},
+		{"/unknown", "/"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, bc.path, nil)
+		if route := rt.Match(req); patternOf(route) != bc.want {
+			b.Fatalf("%s: expected %s, got %s", bc.path, bc.want, patternOf(route))
+		}
+		b.Run(bc.path+"/index", func(b *testing.B) {
+			for b.Loop() {
+				rt.MatchWithParams(req)
+			}
+		})
+		b.Run(bc.path+"/linear", func(b *testing.B) {
+			for b.Loop() {
+				rt.matchLinear(req)
+			}
+		})
+	}
+}
+
+// --- Regex Routing ---
+
+func TestRouterRegexMatch(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path_regex: /users/\d+/orders
+    backends: ["http://orders:8080"]
+  - path: /users
+    backends: ["http://users:8080"]
+`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	r := mustNew(t, cfg)
+
+	tests := []struct {
+		path        string
+		wantBackend string
+	}{
+		{"/users/42/orders", "http://orders:8080"},
+		{"/users/abc/orders", "http://users:8080"},  // \d+ doesn't match letters
+		{"/users/42/orders/7", "http://users:8080"}, // regex must match the whole path
+		{"/users/42", "http://users:8080"},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		route := r.Match(req)
+		if route == nil {
+			t.Fatalf("path %s: expected match, got nil", tc.path)
+		}
+		if route.Backends[0] != tc.wantBackend {
+			t.Errorf("path %s: expected %s, got %s", tc.path, tc.wantBackend, route.Backends[0])
+		}
+	}
+}
+
+func TestRouterRegexNoMatch(t *testing.T) {
+	cfg, _ := ParseConfig([]byte(`
+routes:
+  - path_regex: /users/\d+/orders
+    backends: ["http://orders:8080"]
+`))
+	r := mustNew(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/orders", nil)
+	if route := r.Match(req); route != nil {
+		t.Fatalf("expected nil, got route to %s", route.Backends[0])
+	}
+}
+
+func TestParseConfigRejectsInvalidRegex(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+routes:
+  - path_regex: /users/(\d+
+    backends: ["http://orders:8080"]
+`))
+	if err == nil {
+		t.Fatal("should reject path_regex that doesn't compile")
+	}
+}
+
+func TestNewRejectsInvalidRegex(t *testing.T) {
+	// A config that skipped ParseConfig's validation
+	cfg := &GatewayConfig{Routes: []RouteConfig{
+		{PathRegex: `/users/(\d+`, Backends: []string{"http://users:8080"}},
+	}}
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "path_regex") {
+		t.Fatalf("expected an invalid path_regex error, got %v", err)
+	}
+}
+
+func TestParseConfigRejectsRegexWithoutLiteralPrefix(t *testing.T) {
+	for _, expr := range []string{`.*`, `(?i)api/.*`} {
+		_, err := ParseConfig([]byte(`
+routes:
+  - path: /
+    backends: ["http://catchall:8080"]
+  - path_regex: ` + expr + `
+    backends: ["http://regex:8080"]
+`))
+		if err == nil || !strings.Contains(err.Error(), "literal") {
+			t.Errorf("%s: should reject a path_regex a prefix route for / would shadow, got %v", expr, err)
+		}
+	}
+
+	// These do have "/" (or more) to sort on, and go ahead of the / route
+	for expr, path := range map[string]string{
+		`(?i)/x`:                   "/X",
+		`(/a|/b)/c`:                "/b/c",
+		`/files/(?P<name>.+)\.pdf`: "/files/report.pdf",
+	} {
+		cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /
+    backends: ["http://catchall:8080"]
+  - path_regex: ` + expr + `
+    backends: ["http://regex:8080"]
+`))
+		if err != nil {
+			t.Fatalf("%s: ParseConfig: %v", expr, err)
+		}
+		route := mustNew(t, cfg).Match(httptest.NewRequest(http.MethodGet, path, nil))
+		if route == nil || route.Backends[0] != "http://regex:8080" {
+			t.Errorf("%s: expected the regex route for %s, got %+v", expr, path, route)
+		}
+	}
+}
+
+func TestParseConfigRejectsPathAndRegex(t *testing.T) {
+	_, err := ParseConfig([]byte(`
+routes:
+  - path: /users
+    path_regex: /users/\d+
+    backends: ["http://users:8080"]
+`))
+	if err == nil {
+		t.Fatal("should reject route with both path and path_regex")
+	}
+}
+
+// --- Path Parameters ---
+
+func TestRouterLongerTemplateWinsInEitherOrder(t *testing.T) {
+	user := `
+  - path: /users/{id}
+    backends: ["http://user:8080"]
+`
+	orders := `
+  - path: /users/{id}/orders
+    backends: ["http://orders:8080"]
+`
+	for name, routes := range map[string]string{
+		"short first": user + orders,
+		"long first":  orders + user,
+	} {
+		cfg, err := ParseConfig([]byte("routes:" + routes))
+		if err != nil {
+			t.Fatalf("%s: ParseConfig: %v", name, err)
+		}
+		r := mustNew(t, cfg)
+		for path, want := range map[string]string{
+			"/users/42":          "/users/{id}",
+			"/users/42/profile":  "/users/{id}",
+			"/users/42/orders":   "/users/{id}/orders",
+			"/users/42/orders/7": "/users/{id}/orders",
+		} {
+			if got := patternOf(r.Match(httptest.NewRequest(http.MethodGet, path, nil))); got != want {
+				t.Errorf("%s: %s: expected %s, got %s", name, path, want, got)
+			}
+		}
+	}
+}
+
+func TestRouterCapturesPathParams(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /users/{id}/orders/{oid}
+    backends: ["http://orders:8080"]
+  - path: /users
+    backends: ["http://users:8080"]
+`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	r := mustNew(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42/orders/7", nil)
+	route, params := r.MatchWithParams(req)
+	if route == nil || route.Backends[0] != "http://orders:8080" {
+		t.Fatalf("expected orders route, got %+v", route)
+	}
+	if params["id"] != "42" || params["oid"] != "7" {
+		t.Fatalf("expected id=42 oid=7, got %v", params)
+	}
+
+	// Retrievable from context after being stored by the caller
+	ctx := WithParams(req.Context(), params)
+	if got := ParamsFrom(ctx)["oid"]; got != "7" {
+		t.Fatalf("expected oid=7 from context, got %q", got)
+	}
+
+	// A parameter matches exactly one segment
+	req2 := httptest.NewRequest(http.MethodGet, "/users/42/orders", nil)
+	route2, params2 := r.MatchWithParams(req2)
+	if route2.Backends[0] != "http://users:8080" {
+		t.Fatalf("incomplete path should fall through to /users, got %s", route2.Backends[0])
+	}
+	if params2 != nil {
+		t.Fatalf("prefix route should capture no params, got %v", params2)
+	}
+}
+
+func TestRouterRegexNamedGroups(t *testing.T) {
+	cfg, _ := ParseConfig([]byte(`
+routes:
+  - path_regex: /files/(?P<name>.+)\.(?P<ext>[a-z]+)
+    backends: ["http://files:8080"]
+`))
+	r := mustNew(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/report.pdf", nil)
+	_, params := r.MatchWithParams(req)
+	if params["name"] != "report" || params["ext"] != "pdf" {
+		t.Fatalf("expected name=report ext=pdf, got %v", params)
+	}
+}
+
+func TestParseConfigRejectsBadTemplate(t *testing.T) {
+	for _, path := range []string{"/users/{id", "/users/{}", "/a/{id}/b/{id}"} {
+		_, err := ParseConfig([]byte(`
+routes:
+  - path: "` + path + `"
+    backends: ["http://users:8080"]
+`))
+		if err == nil {
+			t.Errorf("path %q: should be rejected", path)
+		}
+	}
+}
+
+func TestNewRejectsBadTemplate(t *testing.T) {
+	// A config that skipped ParseConfig's validation
+	cfg := &GatewayConfig{Routes: []RouteConfig{
+		{Path: "/users/{id", Backends: []string{"http://users:8080"}},
+	}}
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "path template") {
+		t.Fatalf("expected an invalid path template error, got %v", err)
+	}
+}
+
+// --- Path Rewriting ---
+
+func TestRouteRewritePath(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+routes:
+  - path: /v1/users
+    rewrite: {from: "/v1/users/(.*)", to: "/users/$1"}
+    backends: ["http://users:8080"]
+  - path: /v1/files
+    rewrite: {from: "/v1/files/(?P<name>[^/]+)", to: "/storage/$${name}/raw"}
+    backends: ["http://files:8080"]
+  - path: /static
+    backends: ["http://static:8080"]
+`))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	r := mustNew(t, cfg)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/users/42/orders", "/users/42/orders"},
+		{"/v1/users", "/v1/users"}, // from doesn't match: forwarded as is
+		{"/v1/files/report.pdf", "/storage/report.pdf/raw"},
+		{"/static/app.js", "/static/app.js"}, // no rewrite rule
+	}
+	for _, tc := range tests {
+		route := r.Match(httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if got := route.RewritePath(tc.path); got != tc.want {
+			t.Errorf("path %s: expected rewrite to %s, got %s", tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestParseConfigRejectsBadRewrite(t *testing.T) {
+	for name, rewrite := range map[string]string{
+		"invalid regex": `{from: "/v1/(.*", to: "/$1"}`,
+		"missing group": `{from: "/v1/(.*)", to: "/$2"}`,
+		"unknown name":  `{from: "/v1/(?P<id>.*)", to: "/$${user}"}`,
+		"ambiguous ref": `{from: "/v1/(.*)", to: "/$1x"}`,
+		"relative to":   `{from: "/v1/(.*)", to: "$1"}`,
+		"empty from":    `{to: "/users"}`,
+	} {
+		_, err := ParseConfig([]byte(`
 routes:
-  - path: ""
-    backends:
-      - http://localhost:8080
-`
-	_, err := ParseConfig([]byte(yaml))
-	if err == nil {
-		t.Fatal("should reject empty path")
+  - path: /v1
+    rewrite: ` + rewrite + `
+    backends: ["http://users:8080"]
+`))
+		if err == nil {
+			t.Errorf("%s: should be rejected", name)
+		}
 	}
 }
 
-// --- Path-Based Routing ---
+func TestNewRejectsBadRewrite(t *testing.T) {
+	// A config that skipped ParseConfig's validation
+	cfg := &GatewayConfig{Routes: []RouteConfig{
+		{Path: "/v1", Rewrite: &RewriteConfig{From: "/v1/(.*", To: "/$1"}, Backends: []string{"http://users:8080"}},
+	}}
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "rewrite") {
+		t.Fatalf("expected an invalid rewrite error, got %v", err)
+	}
+}
 
-func TestRouterMatchesLongestPrefix(t *testing.T) {
-	cfg, _ := ParseConfig([]byte(`
+// --- Default Route ---
+
+func TestRouterDefaultRoute(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
 routes:
-  - path: /api/users
-    backends: ["http://users:8080"]
+  - default: true
+    backends: ["http://default:8080"]
   - path: /api
     backends: ["http://api:8080"]
-  - path: /
-    backends: ["http://default:8080"]
+  - path: /api/users/{id}
+    backends: ["http://users:8080"]
 `))
-	r := New(cfg)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	r := mustNew(t, cfg)
 
 	tests := []struct {
-		path    string
+		path        string
 		wantBackend string
 	}{
-		{"/api/users/123", "http://users:8080"},
-		{"/api/orders/456", "http://api:8080"},
-		{"/static/file.js", "http://default:8080"},
+		{"/api/orders", "http://api:8080"},
+		{"/api/users/7", "http://users:8080"},
+		{"/static/app.js", "http://default:8080"},
+		{"/", "http://default:8080"},
 	}
-
 	for _, tc := range tests {
-		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
-		route := r.Match(req)
+		route := r.Match(httptest.NewRequest(http.MethodGet, tc.path, nil))
 		if route == nil {
 			t.Fatalf("path %s: expected match, got nil", tc.path)
 		}
@@ -124,33 +1064,17 @@ routes:
 	}
 }
 
-func TestRouterWildcard(t *testing.T) {
-	cfg, _ := ParseConfig([]byte(`
-routes:
-  - path: /api/users/*
-    backends: ["http://users:8080"]
-`))
-	r := New(cfg)
-
-	req := httptest.NewRequest(http.MethodGet, "/api/users/123/profile", nil)
-	route := r.Match(req)
-	if route == nil {
-		t.Fatal("expected match for wildcard route")
-	}
-}
-
-func TestRouterNoMatch(t *testing.T) {
-	cfg, _ := ParseConfig([]byte(`
+func TestParseConfigRejectsMultipleDefaults(t *testing.T) {
+	_, err := ParseConfig([]byte(`
 routes:
-  - path: /api
-    backends: ["http://api:8080"]
+  - default: true
+    backends: ["http://a:8080"]
+  - path: /
+    default: true
+    backends: ["http://b:8080"]
 `))
-	r := New(cfg)
-
-	req := httptest.NewRequest(http.MethodGet, "/other/path", nil)
-	route := r.Match(req)
-	if route != nil {
-		t.Fatal("expected nil for unmatched path")
+	if err == nil {
+		t.Fatal("should reject more than one default route")
 	}
 }
 
@@ -166,7 +1090,7 @@ routes:
   - path: /api
     backends: ["http://v1:8080"]
 `))
-	r := New(cfg)
+	r := mustNew(t, cfg)
 
 	// With header → v2
 	req := httptest.NewRequest(http.MethodGet, "/api/endpoint", nil)
@@ -196,7 +1120,7 @@ routes:
       Host: blog.example.com
     backends: ["http://blog:8080"]
 `))
-	r := New(cfg)
+	r := mustNew(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set("Host", "shop.example.com")
@@ -206,6 +1130,39 @@ routes:
 	}
 }
 
+func TestRouterWildcardHost(t *testing.T) {
+	cfg, _ := ParseConfig([]byte(`
+routes:
+  - path: /
+    headers:
+      Host: "*.example.com"
+    backends: ["http://tenant:8080"]
+  - path: /
+    backends: ["http://fallback:8080"]
+`))
+	r := mustNew(t, cfg)
+
+	tests := []struct {
+		host        string
+		wantBackend string
+	}{
+		{"a.example.com", "http://tenant:8080"},
+		{"b.example.com", "http://tenant:8080"},
+		{"B.Example.com:9000", "http://tenant:8080"},
+		{"example.com", "http://fallback:8080"},
+		{"evil.com", "http://fallback:8080"},
+		{"notexample.com", "http://fallback:8080"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tc.host // as set by net/http for real requests
+		route := r.Match(req)
+		if route == nil || route.Backends[0] != tc.wantBackend {
+			t.Errorf("host %s: expected %s, got %+v", tc.host, tc.wantBackend, route)
+		}
+	}
+}
+
 func TestRouterHeaderPresenceCheck(t *testing.T) {
 	cfg, _ := ParseConfig([]byte(`
 routes:
@@ -216,7 +1173,7 @@ routes:
   - path: /api
     backends: ["http://stable:8080"]
 `))
-	r := New(cfg)
+	r := mustNew(t, cfg)
 
 	// With X-Canary header (any value)
 	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
@@ -313,6 +1270,75 @@ routes:
 	}
 }
 
+func TestHotReloaderWatchesIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"gateway.yaml": `
+include: ["routes.d/*.yaml"]
+routes:
+  - path: /api
+    backends: ["http://api:8080"]
+`,
+		"routes.d/users.yaml": `
+routes:
+  - path: /users
+    backends: ["http://old-users:8080"]
+`,
+	})
+
+	hr, err := NewHotReloader(filepath.Join(dir, "gateway.yaml"), 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+
+	backendFor := func(path string) string {
+		if route := hr.Router().Match(httptest.NewRequest(http.MethodGet, path, nil)); route != nil {
+			return route.Backends[0]
+		}
+		return ""
+	}
+	waitFor := func(what, path, want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if backendFor(path) == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s: expected %s on %s, got %q", what, want, path, backendFor(path))
+	}
+
+	// Edit the included file; the top-level file is untouched
+	time.Sleep(50 * time.Millisecond) // a new mtime even on coarse clocks
+	writeFiles(t, dir, map[string]string{"routes.d/users.yaml": `
+routes:
+  - path: /users
+    backends: ["http://new-users:8080"]
+`})
+	waitFor("edited include", "/users", "http://new-users:8080")
+
+	// A file added to the glob, with an mtime older than the last load
+	orders := filepath.Join(dir, "routes.d", "orders.yaml")
+	writeFiles(t, dir, map[string]string{"routes.d/orders.yaml": `
+routes:
+  - path: /orders
+    backends: ["http://orders:8080"]
+`})
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(orders, old, old); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("added include", "/orders", "http://orders:8080")
+
+	// And removed again
+	if err := os.Remove(orders); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("removed include", "/orders", "")
+}
+
 func TestHotReloaderRejectsInvalidConfig(t *testing.T) {
 	dir := t.TempDir()
 	cfgPath := filepath.Join(dir, "config.yaml")
@@ -355,3 +1381,279 @@ routes:
 		t.Fatalf("should keep old config on invalid reload, got %s", route.Backends[0])
 	}
 }
+
+func TestHotReloaderRetriesInvalidConfig(t *testing.T) {
+	t.Setenv("GW_RETRY_BACKEND", "")
+	os.Unsetenv("GW_RETRY_BACKEND")
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	writeFiles(t, dir, map[string]string{"config.yaml": `
+routes:
+  - path: /api
+    backends: ["http://old-backend:8080"]
+`})
+
+	hr, err := NewHotReloader(cfgPath, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+
+	var mu sync.Mutex
+	var errs []error
+	hr.OnReload(func(routes int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+	reports := func() []error {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(errs)
+	}
+
+	// Invalid until the variable is set; the file doesn't change again
+	time.Sleep(50 * time.Millisecond)
+	writeFiles(t, dir, map[string]string{"config.yaml": `
+routes:
+  - path: /api
+    backends: ["${GW_RETRY_BACKEND}"]
+`})
+	time.Sleep(200 * time.Millisecond) // several polls
+	if got := reports(); len(got) != 1 || got[0] == nil {
+		t.Fatalf("expected the failure reported once, got %v", got)
+	}
+
+	os.Setenv("GW_RETRY_BACKEND", "http://new-backend:8080")
+	deadline := time.Now().Add(2 * time.Second)
+	for len(reports()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("invalid config was not retried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := reports(); len(got) != 2 || got[1] != nil {
+		t.Fatalf("expected the failure then a success, got %v", got)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	if got := hr.Router().Match(req).Backends[0]; got != "http://new-backend:8080" {
+		t.Fatalf("expected the retried config swapped in, got %s", got)
+	}
+}
+
+func TestHotReloaderReloadsOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+
+	err := os.WriteFile(cfgPath, []byte(`
+routes:
+  - path: /api
+    backends: ["http://old-backend:8080"]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Poll interval far longer than the test: only the signal can trigger a reload
+	hr, err := NewHotReloader(cfgPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+	hr.ReloadOnSignal(syscall.SIGHUP)
+
+	err = os.WriteFile(cfgPath, []byte(`
+routes:
+  - path: /api
+    backends: ["http://new-backend:8080"]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if hr.Router().Match(req).Backends[0] == "http://new-backend:8080" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("router was not swapped after SIGHUP")
+}
+
+func TestHotReloaderReloadKeepsOldOnError(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+
+	err := os.WriteFile(cfgPath, []byte(`
+routes:
+  - path: /api
+    backends: ["http://good-backend:8080"]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hr, err := NewHotReloader(cfgPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+
+	os.WriteFile(cfgPath, []byte(`routes: []`), 0644)
+
+	if err := hr.Reload(); err == nil {
+		t.Fatal("Reload should return the validation error")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	if got := hr.Router().Match(req).Backends[0]; got != "http://good-backend:8080" {
+		t.Fatalf("should keep old router on failed reload, got %s", got)
+	}
+}
+
+func TestHotReloaderKeepsUnchangedRateLimiters(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+
+	write := func(backend string, burst int) {
+		t.Helper()
+		err := os.WriteFile(cfgPath, []byte(fmt.Sprintf(`
+routes:
+  - path: /login
+    backends: [%q]
+    rate_limit:
+      burst: %d
+      rate: 1
+      per: 1h
+`, backend, burst)), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("http://a:8080", 1)
+	reloader, err := NewHotReloader(cfgPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Close()
+	route := func() *Route {
+		return reloader.Router().Match(httptest.NewRequest(http.MethodGet, "/login", nil))
+	}
+
+	if ok, _ := route().RateLimit.Allow("client"); !ok {
+		t.Fatal("first request should be allowed")
+	}
+
+	// Same route and rate_limit, different backend: the client's empty
+	// bucket carries over
+	write("http://b:8080", 1)
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if route().Backends[0] != "http://b:8080" {
+		t.Fatal("reload not applied")
+	}
+	if ok, _ := route().RateLimit.Allow("client"); ok {
+		t.Fatal("an unchanged rate_limit should keep its buckets across a reload")
+	}
+
+	// A changed rate_limit starts over
+	write("http://b:8080", 2)
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := route().RateLimit.Allow("client"); !ok {
+		t.Fatal("a changed rate_limit should get a fresh limiter")
+	}
+}
+
+func TestHotReloaderOnSwapRunsBeforePublishing(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte("routes:\n  - path: /a\n    backends: [\"http://a:8080\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hr, err := NewHotReloader(cfgPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+
+	old := hr.Router()
+	var swapped *Router
+	hr.OnSwap(func(r *Router) {
+		swapped = r
+		if hr.Router() != old {
+			t.Error("router published before OnSwap returned")
+		}
+	})
+
+	if err := os.WriteFile(cfgPath, []byte("routes:\n  - path: /b\n    backends: [\"http://b:8080\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := hr.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if swapped == nil || hr.Router() != swapped {
+		t.Fatal("expected the router passed to OnSwap to be published")
+	}
+}
+
+func TestHotReloaderOnReloadCallback(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+
+	err := os.WriteFile(cfgPath, []byte(`
+routes:
+  - path: /api
+    backends: ["http://good-backend:8080"]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hr, err := NewHotReloader(cfgPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+
+	type outcome struct {
+		routes int
+		err    error
+	}
+	var got []outcome
+	hr.OnReload(func(routes int, err error) {
+		got = append(got, outcome{routes, err})
+	})
+
+	// Invalid reload: callback gets the error, old router stays
+	os.WriteFile(cfgPath, []byte(`routes: []`), 0644)
+	hr.Reload()
+
+	// Valid reload: callback gets the route count
+	os.WriteFile(cfgPath, []byte(`
+routes:
+  - path: /api
+    backends: ["http://a:8080"]
+  - path: /web
+    backends: ["http://b:8080"]
+`), 0644)
+	hr.Reload()
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 callbacks, got %d", len(got))
+	}
+	if got[0].err == nil {
+		t.Fatal("first callback should carry the validation error")
+	}
+	if got[1].err != nil || got[1].routes != 2 {
+		t.Fatalf("second callback should report 2 routes and no error, got %+v", got[1])
+	}
+}
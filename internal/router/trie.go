@@ -0,0 +1,59 @@
+package router
+
+import "net/http"
+
+// literalTrie indexes routes by their literal prefix, one byte per edge, so
+// Match only looks at routes whose literal is a prefix of the request path
+// instead of running HasPrefix against every route.
+//
+// Each node holds the routes whose literal ends there, as indices into
+// Router.routes in match order. Routes are sorted by literal length first,
+// and every route a path can match at one length has the same literal, so
+// visiting the path's nodes deepest first, each node's routes in order,
+// tries candidates in exactly the order the linear scan would.
+type literalTrie struct {
+	routes   []int // indices into Router.routes, ascending
+	children map[byte]*literalTrie
+}
+
+// newLiteralTrie indexes routes, which must already be in match order.
+func newLiteralTrie(routes []Route) *literalTrie {
+	root := &literalTrie{}
+	for i := range routes {
+		node := root
+		lit := routes[i].literal
+		for j := 0; j < len(lit); j++ {
+			child := node.children[lit[j]]
+			if child == nil {
+				if node.children == nil {
+					node.children = make(map[byte]*literalTrie)
+				}
+				child = &literalTrie{}
+				node.children[lit[j]] = child
+			}
+			node = child
+		}
+		node.routes = append(node.routes, i)
+	}
+	return root
+}
+
+// match returns the index of the first route in rt whose literal is a
+// prefix of path and that rt.matches, longest literal first, or -1. depth
+// is how much of path the node has consumed; recursion is bounded by the
+// longest literal, not by the path.
+func (t *literalTrie) match(rt *Router, req *http.Request, path string, depth int) int {
+	if depth < len(path) {
+		if child := t.children[path[depth]]; child != nil {
+			if i := child.match(rt, req, path, depth+1); i >= 0 {
+				return i
+			}
+		}
+	}
+	for _, i := range t.routes {
+		if rt.matches(&rt.routes[i], req) {
+			return i
+		}
+	}
+	return -1
+}
@@ -2,29 +2,89 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 )
 
+// ErrDrainTimeout is returned (joined with any other shutdown errors) by
+// ListenAndServe when in-flight requests outlived DrainTimeout and their
+// connections were force-closed.
+var ErrDrainTimeout = errors.New("drain timeout exceeded, connections force-closed")
+
 // Server wraps http.Server with graceful shutdown support.
 type Server struct {
-	httpServer   *http.Server
+	httpServers  []*http.Server // one per listen address, sharing the handler
 	drainTimeout time.Duration
 	logger       *slog.Logger
 	closers      []io.Closer // background resources to close on shutdown
+	onShutdown   func()
+	preDrain     time.Duration
+	certFile     string
+	keyFile      string
+	useTLS       bool
+
+	mu        sync.Mutex
+	listeners []net.Listener // bound once ListenAndServe starts
 }
 
 // Config holds server configuration.
 type Config struct {
-	Addr         string        // listen address, e.g., ":9000"
+	Addr         string   // listen address, e.g., ":9000"
+	Addrs        []string // more addresses served alongside Addr, e.g. an internal port
 	Handler      http.Handler
 	DrainTimeout time.Duration // max time to wait for in-flight requests
 	Logger       *slog.Logger
+
+	// Connection timeouts, applied to the underlying http.Server. Zero picks
+	// the default below; a negative value disables the timeout.
+	//
+	// ReadHeaderTimeout (default 10s) is the Slowloris guard: clients that
+	// trickle headers are dropped. ReadTimeout (default none) also covers the
+	// body, so keep it generous for uploads. WriteTimeout (default none)
+	// bounds the whole response from the end of the request headers -- it
+	// cuts off long-lived streams such as SSE or slow downloads, so leave it
+	// unset when proxying those and rely on per-route timeouts instead.
+	// IdleTimeout (default 120s) closes idle keep-alive connections.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// OnShutdown runs as soon as a shutdown signal arrives, before anything
+	// else. Use it to flip readiness (/readyz -> 503).
+	OnShutdown func()
+
+	// PreDrainDelay is how long to keep serving normally after OnShutdown
+	// before draining starts. It gives load balancers time to notice the
+	// failing readiness probe and stop routing new traffic here. In
+	// Kubernetes, set it to at least the readiness probe period times its
+	// failure threshold, and keep PreDrainDelay + DrainTimeout below
+	// terminationGracePeriodSeconds. Zero means drain immediately.
+	PreDrainDelay time.Duration
+
+	// EnableH2C accepts HTTP/2 over cleartext (prior knowledge, as gRPC
+	// clients behind a TLS-terminating mesh send it) alongside HTTP/1.1.
+	// Uses net/http's built-in support; no effect on TLS listeners, which
+	// negotiate HTTP/2 via ALPN anyway.
+	EnableH2C bool
+
+	// TLS termination. Serving HTTPS requires CertFile and KeyFile, or a
+	// TLSConfig with Certificates (or GetCertificate) set. Plain HTTP otherwise.
+	CertFile      string
+	KeyFile       string
+	TLSConfig     *tls.Config
+	MinTLSVersion uint16 // e.g. tls.VersionTLS13; default tls.VersionTLS12
 }
 
 // New creates a server with graceful shutdown support.
@@ -35,15 +95,63 @@ func New(cfg Config) *Server {
 	if cfg.Logger == nil {
 		cfg.Logger = slog.Default()
 	}
+	if cfg.ReadHeaderTimeout == 0 {
+		cfg.ReadHeaderTimeout = 10 * time.Second
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 120 * time.Second
+	}
 
-	return &Server{
-		httpServer: &http.Server{
-			Addr:    cfg.Addr,
-			Handler: cfg.Handler,
-		},
+	s := &Server{
 		drainTimeout: cfg.DrainTimeout,
 		logger:       cfg.Logger,
+		onShutdown:   cfg.OnShutdown,
+		preDrain:     cfg.PreDrainDelay,
+		certFile:     cfg.CertFile,
+		keyFile:      cfg.KeyFile,
+	}
+
+	var protocols *http.Protocols
+	if cfg.EnableH2C {
+		protocols = new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
 	}
+
+	var tlsCfg *tls.Config
+	hasCert := cfg.TLSConfig != nil && (len(cfg.TLSConfig.Certificates) > 0 || cfg.TLSConfig.GetCertificate != nil)
+	if cfg.CertFile != "" || hasCert {
+		tlsCfg = &tls.Config{}
+		if cfg.TLSConfig != nil {
+			tlsCfg = cfg.TLSConfig.Clone()
+		}
+		if cfg.MinTLSVersion != 0 {
+			tlsCfg.MinVersion = cfg.MinTLSVersion
+		} else if tlsCfg.MinVersion == 0 {
+			tlsCfg.MinVersion = tls.VersionTLS12
+		}
+		s.useTLS = true
+	}
+
+	addrs := cfg.Addrs
+	if cfg.Addr != "" || len(addrs) == 0 {
+		addrs = append([]string{cfg.Addr}, addrs...)
+	}
+	for _, addr := range addrs {
+		s.httpServers = append(s.httpServers, &http.Server{
+			Addr:              addr,
+			Handler:           cfg.Handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			Protocols:         protocols,
+			TLSConfig:         tlsCfg,
+		})
+	}
+
+	return s
 }
 
 // RegisterCloser adds a resource to be closed during shutdown.
@@ -52,55 +160,172 @@ func (s *Server) RegisterCloser(c io.Closer) {
 	s.closers = append(s.closers, c)
 }
 
+// Addrs returns the addresses the server is listening on, in config order
+// (Addr, then Addrs), with ports resolved when ":0" was asked for. Empty
+// until ListenAndServe has bound them.
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, ln := range s.listeners {
+		addrs[i] = ln.Addr()
+	}
+	return addrs
+}
+
 // ListenAndServe starts the server and blocks until shutdown completes.
 //
 // Shutdown sequence:
 //  1. Wait for SIGTERM or SIGINT
-//  2. Stop accepting new connections
-//  3. Wait for in-flight requests to finish (up to drainTimeout)
-//  4. Close registered background resources
-//  5. Return
+//  2. Run OnShutdown (e.g. fail readiness)
+//  3. Keep serving for PreDrainDelay while load balancers catch up
+//  4. Stop accepting new connections on every address
+//  5. Wait for in-flight requests to finish (up to drainTimeout)
+//  6. Close registered background resources
+//  7. Return
+//
+// Every address is bound before any is served; if some fail, the rest are
+// released and the joined bind errors returned. After a signal, the
+// returned error joins the drain errors (if the timeout expired) with every
+// closer error, so callers can see a failed shutdown; use
+// errors.Is(err, ErrDrainTimeout) to tell a forced close from a clean drain.
 func (s *Server) ListenAndServe() error {
-	// Start server in background
-	errCh := make(chan error, 1)
-	go func() {
-		s.logger.Info("server starting", "addr", s.httpServer.Addr)
-		if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
-			errCh <- err
-		}
-		close(errCh)
-	}()
+	return s.serve(nil)
+}
 
-	// Wait for signal or server error
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+// ListenAndServeContext is like ListenAndServe, but shuts down when ctx is
+// done instead of on a signal. Use it for a secondary server, such as the
+// admin listener, that should stop when the main one has finished, not
+// race it on the same SIGTERM.
+func (s *Server) ListenAndServeContext(ctx context.Context) error {
+	return s.serve(ctx)
+}
+
+// serve runs ListenAndServe, shutting down on a signal if ctx is nil and
+// when ctx is done otherwise.
+func (s *Server) serve(ctx context.Context) error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+
+	// Start servers in background
+	errCh := make(chan error, len(s.httpServers))
+	for i, srv := range s.httpServers {
+		ln := s.listeners[i]
+		go func() {
+			s.logger.Info("server starting", "addr", ln.Addr().String(), "tls", s.useTLS)
+			var err error
+			if s.useTLS {
+				// Empty file names are fine when TLSConfig already has certificates
+				err = srv.ServeTLS(ln, s.certFile, s.keyFile)
+			} else {
+				err = srv.Serve(ln)
+			}
+			if err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("serve %s: %w", ln.Addr(), err)
+			}
+		}()
+	}
+
+	// Wait for signal (or ctx) or server error
+	var sigCh chan os.Signal
+	var done <-chan struct{}
+	if ctx == nil {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	} else {
+		done = ctx.Done()
+	}
 
 	select {
 	case err := <-errCh:
-		return err // server failed to start
+		// One address failed: take the others down with it
+		for _, srv := range s.httpServers {
+			srv.Close()
+		}
+		return err
 	case sig := <-sigCh:
 		s.logger.Info("shutdown signal received", "signal", sig.String())
+	case <-done:
+		s.logger.Info("shutdown requested", "reason", context.Cause(ctx).Error())
 	}
 
-	// Graceful shutdown
+	if s.onShutdown != nil {
+		s.onShutdown()
+	}
+	if s.preDrain > 0 {
+		s.logger.Info("waiting before drain", "delay", s.preDrain.String())
+		time.Sleep(s.preDrain)
+	}
+
+	// Graceful shutdown, all addresses at once under the same deadline
 	s.logger.Info("draining connections", "timeout", s.drainTimeout.String())
 
 	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
 	defer cancel()
 
-	err := s.httpServer.Shutdown(ctx)
-	if err != nil {
-		s.logger.Error("shutdown error, forcing close", "error", err)
-		s.httpServer.Close()
+	shutdownErrs := make([]error, len(s.httpServers))
+	var wg sync.WaitGroup
+	for i, srv := range s.httpServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				s.logger.Error("shutdown error, forcing close", "addr", s.listeners[i].Addr().String(), "error", err)
+				srv.Close()
+				if errors.Is(err, context.DeadlineExceeded) {
+					err = fmt.Errorf("%w: %w", ErrDrainTimeout, err)
+				}
+				shutdownErrs[i] = fmt.Errorf("shutdown %s: %w", s.listeners[i].Addr(), err)
+			}
+		}()
 	}
+	wg.Wait()
+	errs := slices.DeleteFunc(shutdownErrs, func(err error) bool { return err == nil })
 
-	// Close background resources
+	// Close background resources; one failure doesn't stop the rest
 	for _, c := range s.closers {
 		if err := c.Close(); err != nil {
 			s.logger.Warn("error closing resource", "error", err)
+			errs = append(errs, fmt.Errorf("close resource: %w", err))
 		}
 	}
 
 	s.logger.Info("shutdown complete")
+	return errors.Join(errs...)
+}
+
+// listen binds every address. On any failure it closes what it did bind
+// and returns all the bind errors.
+func (s *Server) listen() error {
+	var (
+		listeners []net.Listener
+		errs      []error
+	)
+	for _, srv := range s.httpServers {
+		addr := srv.Addr
+		if addr == "" {
+			addr = ":http" // net/http's defaults for an empty Addr
+			if s.useTLS {
+				addr = ":https"
+			}
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listen %s: %w", addr, err))
+			continue
+		}
+		listeners = append(listeners, ln)
+	}
+	if len(errs) > 0 {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		return errors.Join(errs...)
+	}
+
+	s.mu.Lock()
+	s.listeners = listeners
+	s.mu.Unlock()
 	return nil
 }
@@ -1,9 +1,23 @@
 package server
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -77,6 +91,38 @@ func TestServerGracefulShutdown(t *testing.T) {
 	}
 }
 
+func TestServerReturnsErrDrainTimeout(t *testing.T) {
+	requestStarted := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := New(Config{
+		Addr: "127.0.0.1:19884",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(requestStarted)
+			<-release // outlives the drain window
+		}),
+		DrainTimeout: 100 * time.Millisecond,
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	time.Sleep(100 * time.Millisecond)
+
+	go http.Get("http://127.0.0.1:19884/hang")
+	<-requestStarted
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrDrainTimeout) {
+			t.Fatalf("expected ErrDrainTimeout, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("shutdown should force-close after the drain timeout")
+	}
+}
+
 // testCloser tracks whether Close was called.
 type testCloser struct {
 	closed bool
@@ -87,6 +133,49 @@ func (tc *testCloser) Close() error {
 	return nil
 }
 
+// failingCloser returns err from Close and records the call.
+type failingCloser struct {
+	err    error
+	closed bool
+}
+
+func (fc *failingCloser) Close() error {
+	fc.closed = true
+	return fc.err
+}
+
+func TestServerReturnsCloserErrors(t *testing.T) {
+	errA := errors.New("flush failed")
+	errB := errors.New("disk full")
+	c1 := &failingCloser{err: errA}
+	c2 := &testCloser{}
+	c3 := &failingCloser{err: errB}
+
+	srv := New(Config{
+		Addr: "127.0.0.1:19881",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(200)
+		}),
+		DrainTimeout: 1 * time.Second,
+	})
+	srv.RegisterCloser(c1)
+	srv.RegisterCloser(c2)
+	srv.RegisterCloser(c3)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	}()
+
+	err := srv.ListenAndServe()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("expected error wrapping both closer errors, got %v", err)
+	}
+	if !c1.closed || !c2.closed || !c3.closed {
+		t.Fatal("every closer should run even after one fails")
+	}
+}
+
 func TestServerClosesResources(t *testing.T) {
 	c1 := &testCloser{}
 	c2 := &testCloser{}
@@ -112,3 +201,403 @@ func TestServerClosesResources(t *testing.T) {
 		t.Fatal("all registered resources should be closed on shutdown")
 	}
 }
+
+// selfSignedCert returns a PEM cert/key pair valid for 127.0.0.1.
+func selfSignedCert(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway-test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
+
+func TestServerTLS(t *testing.T) {
+	certPEM, keyPEM := selfSignedCert(t)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, certPEM, 0o600)
+	os.WriteFile(keyFile, keyPEM, 0o600)
+
+	srv := New(Config{
+		Addr: "127.0.0.1:19878",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("secure"))
+		}),
+		DrainTimeout: 1 * time.Second,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe() }()
+	time.Sleep(100 * time.Millisecond) // wait for server to start
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	resp, err := client.Get("https://127.0.0.1:19878/")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secure" {
+		t.Fatalf("expected 'secure', got %q", string(body))
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Fatal("expected a TLS 1.2+ connection")
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	if err := <-done; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+}
+
+func TestServerTLSMinVersion(t *testing.T) {
+	certPEM, keyPEM := selfSignedCert(t)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("load key pair: %v", err)
+	}
+
+	srv := New(Config{
+		Addr: "127.0.0.1:19879",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		DrainTimeout:  1 * time.Second,
+		TLSConfig:     &tls.Config{Certificates: []tls.Certificate{cert}},
+		MinTLSVersion: tls.VersionTLS13,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe() }()
+	time.Sleep(100 * time.Millisecond) // wait for server to start
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	tls12Only := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:    pool,
+		MaxVersion: tls.VersionTLS12,
+	}}}
+	if resp, err := tls12Only.Get("https://127.0.0.1:19879/"); err == nil {
+		resp.Body.Close()
+		t.Fatal("TLS 1.2 client should be rejected when MinTLSVersion is 1.3")
+	}
+
+	tls13 := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := tls13.Get("https://127.0.0.1:19879/")
+	if err != nil {
+		t.Fatalf("TLS 1.3 request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS.Version != tls.VersionTLS13 {
+		t.Fatalf("expected TLS 1.3, got %x", resp.TLS.Version)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	<-done
+}
+
+func TestServerDropsSlowHeaders(t *testing.T) {
+	srv := New(Config{
+		Addr: "127.0.0.1:19880",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		DrainTimeout:      1 * time.Second,
+		ReadHeaderTimeout: 200 * time.Millisecond,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe() }()
+	time.Sleep(100 * time.Millisecond) // wait for server to start
+
+	conn, err := net.Dial("tcp", "127.0.0.1:19880")
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Send a partial header block and then stall, Slowloris-style
+	start := time.Now()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n"))
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	io.ReadAll(conn) // returns once the server closes the connection
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("slow client should be dropped after ~200ms, still connected after %v", elapsed)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	<-done
+}
+
+func TestServerOnShutdownAndPreDrainDelay(t *testing.T) {
+	hookFired := make(chan time.Time, 1)
+
+	srv := New(Config{
+		Addr: "127.0.0.1:19882",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+		DrainTimeout:  1 * time.Second,
+		OnShutdown:    func() { hookFired <- time.Now() },
+		PreDrainDelay: 300 * time.Millisecond,
+	})
+
+	done := make(chan time.Time, 1)
+	go func() {
+		srv.ListenAndServe()
+		done <- time.Now()
+	}()
+	time.Sleep(100 * time.Millisecond) // wait for server to start
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+
+	var fired time.Time
+	select {
+	case fired = <-hookFired:
+	case <-time.After(time.Second):
+		t.Fatal("OnShutdown should fire on signal")
+	}
+
+	// Still serving new requests during the pre-drain delay
+	resp, err := http.Get("http://127.0.0.1:19882/")
+	if err != nil {
+		t.Fatalf("request during pre-drain delay should succeed: %v", err)
+	}
+	resp.Body.Close()
+
+	finished := <-done
+	if gap := finished.Sub(fired); gap < 300*time.Millisecond {
+		t.Fatalf("shutdown finished %v after the hook, expected at least the 300ms delay", gap)
+	}
+}
+
+func TestServerH2C(t *testing.T) {
+	srv := New(Config{
+		Addr: "127.0.0.1:19883",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+		DrainTimeout: 1 * time.Second,
+		EnableH2C:    true,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe() }()
+	time.Sleep(100 * time.Millisecond) // wait for server to start
+
+	// Client speaks only cleartext HTTP/2 with prior knowledge
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	resp, err := client.Get("http://127.0.0.1:19883/")
+	if err != nil {
+		t.Fatalf("h2c request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Fatalf("expected HTTP/2 on both ends, client got %s, server saw %q", resp.Proto, body)
+	}
+
+	// HTTP/1.1 clients still work
+	resp, err = http.Get("http://127.0.0.1:19883/")
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("expected HTTP/1.1, got %s", resp.Proto)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("h2c server should shut down gracefully")
+	}
+}
+
+// waitForAddrs polls until srv has bound all n of its addresses.
+func waitForAddrs(t *testing.T, srv *Server, n int) []net.Addr {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if addrs := srv.Addrs(); len(addrs) == n {
+			return addrs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not bind %d addresses in time", n)
+	return nil
+}
+
+func TestServerMultipleAddrs(t *testing.T) {
+	slowStarted := make(chan struct{})
+	srv := New(Config{
+		Addr:  "127.0.0.1:0",
+		Addrs: []string{"127.0.0.1:0"},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				close(slowStarted)
+				time.Sleep(300 * time.Millisecond)
+			}
+			w.Write([]byte("ok"))
+		}),
+		DrainTimeout: 2 * time.Second,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe() }()
+	addrs := waitForAddrs(t, srv, 2)
+	if addrs[0].String() == addrs[1].String() {
+		t.Fatalf("expected two distinct addresses, got %v", addrs)
+	}
+
+	// One connection per request. A pooling client can dial a spare
+	// connection it then never uses; the server counts a connection that
+	// hasn't sent a request as active for 5s, past DrainTimeout.
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	// Both addresses answer before the drain starts
+	for _, addr := range addrs {
+		resp, err := client.Get("http://" + addr.String() + "/")
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", addr, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", addr, resp.StatusCode)
+		}
+	}
+
+	// An in-flight request on the second address survives the drain
+	slowDone := make(chan error, 1)
+	go func() {
+		resp, err := client.Get("http://" + addrs[1].String() + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		slowDone <- err
+	}()
+	<-slowStarted
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+
+	if err := <-slowDone; err != nil {
+		t.Fatalf("in-flight request should complete during drain: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("server should shut down after draining both addresses")
+	}
+	for _, addr := range addrs {
+		if conn, err := net.Dial("tcp", addr.String()); err == nil {
+			conn.Close()
+			t.Fatalf("%s still accepting connections after shutdown", addr)
+		}
+	}
+}
+
+func TestServerListenAndServeContext(t *testing.T) {
+	slowStarted := make(chan struct{})
+	srv := New(Config{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(slowStarted)
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("ok"))
+		}),
+		DrainTimeout: 2 * time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServeContext(ctx) }()
+	addr := waitForAddrs(t, srv, 1)[0].String()
+
+	slowDone := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		slowDone <- err
+	}()
+	<-slowStarted
+	cancel()
+
+	// Cancelling drains like a signal does
+	if err := <-slowDone; err != nil {
+		t.Fatalf("in-flight request should complete during drain: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("server should shut down once ctx is done")
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Fatal("still accepting connections after shutdown")
+	}
+}
+
+func TestServerMultipleAddrsBindError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	srv := New(Config{
+		Addr:    "127.0.0.1:0",
+		Addrs:   []string{taken.Addr().String()},
+		Handler: http.NotFoundHandler(),
+	})
+
+	// Fails fast without waiting for a signal, naming the address in use
+	err = srv.ListenAndServe()
+	if err == nil || !strings.Contains(err.Error(), taken.Addr().String()) {
+		t.Fatalf("expected bind error for %s, got %v", taken.Addr(), err)
+	}
+	if len(srv.Addrs()) != 0 {
+		t.Fatalf("no address should stay bound after a failed start, got %v", srv.Addrs())
+	}
+}